@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+const (
+	redacted             = "[REDACTED]"
+	auditHTTPSinkTimeout = 5 * time.Second
+)
+
+// sensitiveArgs are substrings of argument names whose values are redacted
+// from audit records.
+var sensitiveArgs = []string{"token", "secret", "password", "private_key", "authorization", "api_key", "credential"} //nolint:gochecknoglobals
+
+// Outcomes of audited tool calls.
+const (
+	// auditOutcomeExecuted is a call that ran the tool, also in dry-run mode.
+	auditOutcomeExecuted = "executed"
+	// auditOutcomeDenied is a call rejected before running the tool by the
+	// tool access rules, the safety mode or the user.
+	auditOutcomeDenied = "denied"
+	// auditOutcomePendingConfirmation is a call that returned a
+	// confirmation token instead of running the tool.
+	auditOutcomePendingConfirmation = "pending_confirmation"
+)
+
+// auditRecord is a single line of the audit log.
+type auditRecord struct {
+	Time           time.Time      `json:"time"`
+	Tool           string         `json:"tool"`
+	Arguments      map[string]any `json:"arguments"`
+	PATFingerprint string         `json:"pat_fingerprint,omitempty"`
+	// ClientCertSubject is the subject of the TLS client certificate, when
+	// the HTTP transport uses mutual TLS.
+	ClientCertSubject string `json:"client_cert_subject,omitempty"`
+	Transport         string `json:"transport"`
+	Outcome           string `json:"outcome"`
+	DryRun            bool   `json:"dry_run,omitempty"`
+	// UpstreamStatus is the status of the last Bitrise API response, 0 when
+	// the tool didn't get a response from Bitrise.
+	UpstreamStatus int     `json:"upstream_status"`
+	UpstreamCalls  int     `json:"upstream_calls"`
+	IsError        bool    `json:"is_error"`
+	Error          string  `json:"error,omitempty"`
+	DurationMS     float64 `json:"duration_ms"`
+}
+
+// auditSink receives encoded audit records, one JSON object per call.
+type auditSink interface {
+	Write(ctx context.Context, record []byte) error
+	Close() error
+}
+
+// writerSink appends records as lines to a writer, such as a file or stdout.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *writerSink) Write(_ context.Context, record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(append(record, '\n'))
+	return err
+}
+
+func (s *writerSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok && s.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+// httpSink posts each record to a collector as application/x-ndjson.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Write(ctx context.Context, record []byte) error {
+	// The tool call may be cancelled right after it returns; the record
+	// should still be delivered.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditHTTPSinkTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(append(record, '\n')))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
+
+// newAuditSinks parses a comma-separated list of sinks: "stdout",
+// "file:<path>" or an http(s) collector URL.
+func newAuditSinks(spec string, stdio bool) ([]auditSink, error) {
+	var sinks []auditSink
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+			continue
+		case s == "stdout":
+			if stdio {
+				return nil, errors.New("the stdout audit log sink can't be used with the stdio transport")
+			}
+			sinks = append(sinks, &writerSink{w: os.Stdout})
+		case strings.HasPrefix(s, "file:"):
+			f, err := os.OpenFile(strings.TrimPrefix(s, "file:"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				return nil, fmt.Errorf("open audit log file: %w", err)
+			}
+			sinks = append(sinks, &writerSink{w: f})
+		case strings.HasPrefix(s, "http://"), strings.HasPrefix(s, "https://"):
+			sinks = append(sinks, &httpSink{url: s, client: &http.Client{}})
+		default:
+			return nil, fmt.Errorf("invalid audit log sink %q: must be stdout, file:<path> or an http(s) URL", s)
+		}
+	}
+	return sinks, nil
+}
+
+// auditor records every tool call that is not read-only to its sinks.
+type auditor struct {
+	sinks     []auditSink
+	readOnly  func(name string) bool
+	transport string
+	logger    *zap.SugaredLogger
+	now       func() time.Time
+}
+
+func newAuditor(sinks []auditSink, readOnly func(name string) bool, transport string, logger *zap.SugaredLogger) *auditor {
+	return &auditor{
+		sinks:     sinks,
+		readOnly:  readOnly,
+		transport: transport,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// auditCall is passed from the rejections middleware to the middleware of
+// the auditor through the context.
+type auditCall struct {
+	reached bool
+	outcome string
+}
+
+type auditCallKey struct{}
+
+// setAuditOutcome records why a call didn't reach the tool. It is a no-op for
+// calls that are not audited.
+func setAuditOutcome(ctx context.Context, outcome string) {
+	if call, ok := ctx.Value(auditCallKey{}).(*auditCall); ok {
+		call.outcome = outcome
+	}
+}
+
+// rejections records the calls that never reached middleware, e.g. because
+// the tool access rules, the safety mode or the confirmation of destructive
+// tools stopped them. It must wrap those middlewares, which wrap middleware.
+func (a *auditor) rejections(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if a.readOnly(request.Params.Name) {
+			return fn(ctx, request)
+		}
+		record := a.newRecord(ctx, request)
+		call := &auditCall{outcome: auditOutcomeDenied}
+
+		result, err := fn(context.WithValue(ctx, auditCallKey{}, call), request)
+
+		if !call.reached {
+			record.Outcome = call.outcome
+			a.finish(ctx, record, result, err)
+		}
+		return result, err
+	}
+}
+
+// middleware records the calls that run the tool, with the Bitrise API calls
+// the tool made.
+func (a *auditor) middleware(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if a.readOnly(request.Params.Name) {
+			return fn(ctx, request)
+		}
+		if call, ok := ctx.Value(auditCallKey{}).(*auditCall); ok {
+			call.reached = true
+		}
+		record := a.newRecord(ctx, request)
+		record.Outcome = auditOutcomeExecuted
+		var mu sync.Mutex
+		ctx = bitrise.ContextWithAPICallObserver(ctx, func(call bitrise.APICall) {
+			mu.Lock()
+			defer mu.Unlock()
+			record.UpstreamStatus = call.StatusCode
+			record.UpstreamCalls++
+		})
+
+		result, err := fn(ctx, request)
+
+		mu.Lock()
+		defer mu.Unlock()
+		a.finish(ctx, record, result, err)
+		return result, err
+	}
+}
+
+func (a *auditor) newRecord(ctx context.Context, request mcp.CallToolRequest) auditRecord {
+	return auditRecord{
+		Time:              a.now().UTC(),
+		Tool:              request.Params.Name,
+		Arguments:         redactArgs(request.GetArguments()),
+		PATFingerprint:    bitrise.PATFingerprint(ctx),
+		ClientCertSubject: bitrise.ClientCertSubjectFromCtx(ctx),
+		Transport:         a.transport,
+		DryRun:            bitrise.DryRunFromCtx(ctx),
+	}
+}
+
+// finish fills in the result of the call and writes the record.
+func (a *auditor) finish(ctx context.Context, record auditRecord, result *mcp.CallToolResult, err error) {
+	record.DurationMS = float64(a.now().Sub(record.Time).Microseconds()) / 1000
+	switch {
+	case err != nil:
+		record.IsError = true
+		record.Error = err.Error()
+	case result != nil && result.IsError:
+		record.IsError = true
+		record.Error = resultText(result)
+	}
+	a.write(ctx, record)
+}
+
+func (a *auditor) write(ctx context.Context, record auditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		a.logger.Errorw("marshal audit record", "error", err, "tool", record.Tool)
+		return
+	}
+	for _, sink := range a.sinks {
+		if err := sink.Write(ctx, line); err != nil {
+			a.logger.Errorw("write audit record", "error", err, "tool", record.Tool)
+		}
+	}
+}
+
+func (a *auditor) Close() error {
+	var errs []error
+	for _, sink := range a.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// redactArgs returns a copy of args with the values of sensitive arguments
+// replaced. Header values are always redacted, their names are kept.
+func redactArgs(args map[string]any) map[string]any {
+	out := make(map[string]any, len(args))
+	for key, value := range args {
+		switch {
+		case isSensitiveArg(key):
+			out[key] = redacted
+		case key == "headers":
+			if headers, ok := value.(map[string]any); ok {
+				masked := make(map[string]any, len(headers))
+				for name := range headers {
+					masked[name] = redacted
+				}
+				out[key] = masked
+			} else {
+				out[key] = redacted
+			}
+		default:
+			out[key] = redactValue(value)
+		}
+	}
+	return out
+}
+
+func redactValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		return redactArgs(t)
+	case []any:
+		out := make([]any, len(t))
+		for i, elem := range t {
+			out[i] = redactValue(elem)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func isSensitiveArg(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveArgs {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// resultText returns the text content of a tool result, as used for error
+// results.
+func resultText(result *mcp.CallToolResult) string {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type memorySink struct {
+	records []auditRecord
+}
+
+func (s *memorySink) Write(_ context.Context, record []byte) error {
+	var r auditRecord
+	if err := json.Unmarshal(record, &r); err != nil {
+		return err
+	}
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestRedactArgs(t *testing.T) {
+	got := redactArgs(map[string]any{
+		"app_slug":             "abc",
+		"secret":               "s3cr3t",
+		"auth_ssh_private_key": "-----BEGIN",
+		"confirmation_token":   "123.abc",
+		"headers":              map[string]any{"X-Api-Key": "key"},
+		"environments":         []any{map[string]any{"mapped_to": "PASSWORD", "password": "hunter2"}},
+	})
+	assert.Equal(t, map[string]any{
+		"app_slug":             "abc",
+		"secret":               redacted,
+		"auth_ssh_private_key": redacted,
+		"confirmation_token":   redacted,
+		"headers":              map[string]any{"X-Api-Key": redacted},
+		"environments":         []any{map[string]any{"mapped_to": "PASSWORD", "password": redacted}},
+	}, got)
+}
+
+func TestAuditorMiddleware(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/apps/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer api.Close()
+
+	sink := &memorySink{}
+	a := newAuditor([]auditSink{sink}, func(name string) bool { return name == "list_apps" }, "http", zap.NewNop().Sugar())
+	handler := a.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		_, err := bitrise.CallAPI(bitrise.ContextWithBaseURLs(ctx, bitrise.BaseURLs{API: api.URL}), bitrise.CallAPIParams{
+			Method: http.MethodPost,
+			Path:   "/apps/" + request.GetString("app_slug", ""),
+		})
+		if err != nil {
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
+		}
+		return mcp.NewToolResultText("ok"), nil
+	})
+	call := func(tool string, args map[string]any) {
+		var request mcp.CallToolRequest
+		request.Params.Name = tool
+		request.Params.Arguments = args
+		ctx := bitrise.ContextWithClientCertSubject(bitrise.ContextWithPAT(t.Context(), "pat"), "CN=ci-runner")
+		_, err := handler(ctx, request)
+		assert.NoError(t, err)
+	}
+
+	call("list_apps", map[string]any{"app_slug": "abc"})
+	assert.Empty(t, sink.records)
+
+	call("update_app", map[string]any{"app_slug": "abc", "secret": "s3cr3t"})
+	call("update_app", map[string]any{"app_slug": "missing"})
+	if !assert.Len(t, sink.records, 2) {
+		return
+	}
+
+	ok := sink.records[0]
+	assert.Equal(t, "update_app", ok.Tool)
+	assert.Equal(t, map[string]any{"app_slug": "abc", "secret": redacted}, ok.Arguments)
+	assert.Equal(t, bitrise.PATFingerprint(bitrise.ContextWithPAT(t.Context(), "pat")), ok.PATFingerprint)
+	assert.Equal(t, "CN=ci-runner", ok.ClientCertSubject)
+	assert.Equal(t, "http", ok.Transport)
+	assert.Equal(t, auditOutcomeExecuted, ok.Outcome)
+	assert.Equal(t, http.StatusCreated, ok.UpstreamStatus)
+	assert.Equal(t, 1, ok.UpstreamCalls)
+	assert.False(t, ok.IsError)
+
+	failed := sink.records[1]
+	assert.Equal(t, http.StatusNotFound, failed.UpstreamStatus)
+	assert.True(t, failed.IsError)
+	assert.Contains(t, failed.Error, "not_found")
+}
+
+func TestAuditorRejections(t *testing.T) {
+	sink := &memorySink{}
+	a := newAuditor([]auditSink{sink}, func(name string) bool { return name == "list_apps" }, "http", zap.NewNop().Sugar())
+	tool := a.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("deleted"), nil
+	})
+	// Stands in for the tool access rules, the safety mode and the confirmer.
+	handler := a.rejections(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		switch request.GetString("app_slug", "") {
+		case "forbidden":
+			return mcp.NewToolResultError("tool is disabled"), nil
+		case "unconfirmed":
+			setAuditOutcome(ctx, auditOutcomePendingConfirmation)
+			return mcp.NewToolResultStructuredOnly(map[string]any{"confirmation_required": true}), nil
+		}
+		return tool(ctx, request)
+	})
+	call := func(tool, appSlug string) {
+		var request mcp.CallToolRequest
+		request.Params.Name = tool
+		request.Params.Arguments = map[string]any{"app_slug": appSlug}
+		_, err := handler(t.Context(), request)
+		assert.NoError(t, err)
+	}
+
+	call("list_apps", "forbidden")
+	call("delete_app", "forbidden")
+	call("delete_app", "unconfirmed")
+	call("delete_app", "abc")
+	if !assert.Len(t, sink.records, 3) {
+		return
+	}
+
+	denied := sink.records[0]
+	assert.Equal(t, auditOutcomeDenied, denied.Outcome)
+	assert.True(t, denied.IsError)
+	assert.Equal(t, "tool is disabled", denied.Error)
+
+	pending := sink.records[1]
+	assert.Equal(t, auditOutcomePendingConfirmation, pending.Outcome)
+	assert.False(t, pending.IsError)
+	assert.Zero(t, pending.UpstreamCalls)
+
+	executed := sink.records[2]
+	assert.Equal(t, auditOutcomeExecuted, executed.Outcome)
+	assert.Equal(t, map[string]any{"app_slug": "abc"}, executed.Arguments)
+}
+
+func TestNewAuditSinks(t *testing.T) {
+	var received []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	sinks, err := newAuditSinks("file:"+path+", "+collector.URL, true)
+	assert.NoError(t, err)
+	if !assert.Len(t, sinks, 2) {
+		return
+	}
+	for _, sink := range sinks {
+		assert.NoError(t, sink.Write(t.Context(), []byte(`{"tool":"a"}`)))
+		assert.NoError(t, sink.Write(t.Context(), []byte(`{"tool":"b"}`)))
+		assert.NoError(t, sink.Close())
+	}
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"tool\":\"a\"}\n{\"tool\":\"b\"}\n", string(content))
+	assert.Equal(t, "{\"tool\":\"b\"}\n", string(received))
+
+	_, err = newAuditSinks("stdout", true)
+	assert.Error(t, err)
+	_, err = newAuditSinks("syslog", false)
+	assert.Error(t, err)
+}
@@ -5,30 +5,36 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/oauth"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/ttlcache"
 	"go.uber.org/zap"
 )
 
+const oauthProtectedResourcePath = "/.well-known/oauth-protected-resource"
+
 // oauthProtectedResourceHandler serves RFC 9728 Protected Resource Metadata,
 // telling OAuth clients which authorization server issues tokens for this resource.
+// An empty issuer means the built-in authorization server at the server's
+// own base URL.
 func oauthProtectedResourceHandler(issuer string) http.HandlerFunc {
 	issuer = strings.TrimRight(issuer, "/")
 	return func(w http.ResponseWriter, r *http.Request) {
-		scheme := "http"
-		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
-			scheme = "https"
+		authServer := issuer
+		if authServer == "" {
+			authServer = serverBaseURL(r)
 		}
-		serverBase := scheme + "://" + r.Host
 		metadata := map[string]any{
-			"resource":                 serverBase,
-			"authorization_servers":    []string{issuer},
+			"resource":                 serverBaseURL(r),
+			"authorization_servers":    []string{authServer},
 			"bearer_methods_supported": []string{"header"},
 		}
 		body, _ := json.Marshal(metadata)
@@ -38,41 +44,152 @@ func oauthProtectedResourceHandler(issuer string) http.HandlerFunc {
 	}
 }
 
-type cacheEntry struct {
-	pat       string
-	expiresAt time.Time
+// serverBaseURL returns the scheme and host the client used to reach the
+// server.
+func serverBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// bearerAuth resolves the PAT of MCP requests from their Bearer token,
+// exchanging JWTs when an exchanger is configured.
+type bearerAuth struct {
+	exchanger *jwtExchanger
+	// oauthServer resolves the access tokens of the built-in authorization
+	// server, when enabled.
+	oauthServer *oauth.Server
+	// advertisesOAuth tells that the server serves its protected resource
+	// metadata. Requests without a token are then rejected with a challenge
+	// pointing at it, so MCP clients can start the OAuth flow. Otherwise
+	// they are passed through and fail when a tool calls the API.
+	advertisesOAuth bool
+	logger          *zap.SugaredLogger
+}
+
+func (a *bearerAuth) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			if a.advertisesOAuth {
+				a.challenge(w, r, "", "")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		pat := token
+		var err error
+		switch {
+		case a.oauthServer != nil && oauth.IsAccessToken(token):
+			pat, err = a.oauthServer.PAT(r.Context(), token)
+			if err != nil {
+				a.challenge(w, r, "invalid_token", "the access token is invalid or expired")
+				return
+			}
+		case a.exchanger != nil && isJWT(token):
+			pat, err = a.exchanger.exchange(r.Context(), token)
+			if err != nil {
+				switch {
+				case errors.Is(err, errJWKSUnavailable):
+					// Not the client's fault, don't make it drop the token.
+					a.logger.Errorw("JWT verification failed", "error", err)
+					http.Error(w, "the token can't be verified right now", http.StatusServiceUnavailable)
+					return
+				case errors.Is(err, errInvalidToken):
+					a.logger.Warnw("rejected invalid JWT", "error", err)
+				default:
+					a.logger.Warnw("JWT→PAT exchange failed", "error", err)
+				}
+				a.challenge(w, r, "invalid_token", "the token could not be exchanged for a Bitrise PAT")
+				return
+			}
+		}
+		// The HTTP context func derives its context from the request's.
+		next.ServeHTTP(w, r.WithContext(bitrise.ContextWithPAT(r.Context(), pat)))
+	})
+}
+
+// challenge answers with 401 and an RFC 6750 Bearer challenge, which points
+// at the resource metadata (RFC 9728) when it's served.
+func (a *bearerAuth) challenge(w http.ResponseWriter, r *http.Request, errorCode, description string) {
+	var params []string
+	if a.advertisesOAuth {
+		params = append(params, fmt.Sprintf("resource_metadata=%q", serverBaseURL(r)+oauthProtectedResourcePath))
+	}
+	if errorCode != "" {
+		params = append(params, fmt.Sprintf("error=%q", errorCode), fmt.Sprintf("error_description=%q", description))
+	}
+	challenge := "Bearer"
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	message := "authorization required"
+	if description != "" {
+		message = description
+	}
+	http.Error(w, message, http.StatusUnauthorized)
 }
 
+const (
+	// jwtCacheEvictionInterval is how often expired PATs are dropped from
+	// the exchange cache.
+	jwtCacheEvictionInterval = time.Minute
+)
+
 // jwtExchanger calls an OIDC token exchange endpoint (RFC 8693) to trade an
 // external JWT for a Bitrise PAT, caching results until the JWT expires.
 type jwtExchanger struct {
 	tokenEndpoint string
-	logger        *zap.SugaredLogger
-	cache         sync.Map
+	// verifier checks JWTs before they are exchanged. Without it, JWTs are
+	// only checked by the token endpoint.
+	verifier *jwtVerifier
+	logger   *zap.SugaredLogger
+	metrics  *serverMetrics
+	cache    *ttlcache.Cache[string]
+}
+
+// newJWTExchanger creates an exchanger caching up to cacheSize PATs. Call
+// Close to stop the cache's background eviction.
+func newJWTExchanger(tokenEndpoint string, cacheSize int, logger *zap.SugaredLogger, metrics *serverMetrics) *jwtExchanger {
+	return &jwtExchanger{
+		tokenEndpoint: tokenEndpoint,
+		logger:        logger,
+		metrics:       metrics,
+		cache: ttlcache.New[string](ttlcache.Options{
+			MaxEntries:       cacheSize,
+			EvictionInterval: jwtCacheEvictionInterval,
+			OnEvict:          metrics.jwtCacheEviction,
+		}),
+	}
 }
 
 func (e *jwtExchanger) exchange(ctx context.Context, jwt string) (string, error) {
-	key := cacheKey(jwt)
-	if v, ok := e.cache.Load(key); ok {
-		entry := v.(cacheEntry) //nolint:forcetypeassert
-		if time.Now().Before(entry.expiresAt) {
-			return entry.pat, nil
+	if e.verifier != nil {
+		if _, err := e.verifier.verify(ctx, jwt); err != nil {
+			return "", err
 		}
-		e.cache.Delete(key)
 	}
 
-	pat, err := e.callExchangeEndpoint(ctx, jwt)
+	pat, result, err := e.cache.GetOrLoad(ctx, cacheKey(jwt), func(ctx context.Context) (string, time.Duration, error) {
+		pat, err := e.callExchangeEndpoint(ctx, jwt)
+		return pat, jwtTTL(jwt), err
+	})
+	e.metrics.jwtCacheLookup(result)
 	if err != nil {
 		return "", err
 	}
-
-	e.cache.Store(key, cacheEntry{
-		pat:       pat,
-		expiresAt: time.Now().Add(jwtTTL(jwt)),
-	})
 	return pat, nil
 }
 
+// Close stops the background eviction of the cache.
+func (e *jwtExchanger) Close() {
+	e.cache.Close()
+}
+
 func (e *jwtExchanger) callExchangeEndpoint(ctx context.Context, jwt string) (string, error) {
 	body := url.Values{
 		"grant_type":         {"urn:ietf:params:oauth:grant-type:token-exchange"},
@@ -156,3 +273,14 @@ func cacheKey(jwt string) string {
 	h := sha256.Sum256([]byte(jwt))
 	return fmt.Sprintf("%x", h[:8])
 }
+
+// validatePAT checks a PAT pasted into the consent page of the built-in
+// authorization server by fetching the user it belongs to.
+func validatePAT(ctx context.Context, pat string) error {
+	_, err := bitrise.CallAPI(bitrise.ContextWithPAT(ctx, pat), bitrise.CallAPIParams{
+		Method: http.MethodGet,
+		API:    bitrise.APIMain,
+		Path:   "/me",
+	})
+	return err
+}
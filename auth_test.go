@@ -9,6 +9,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/oauth"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -96,7 +98,8 @@ func TestJwtExchangerExchange(t *testing.T) {
 		}))
 		defer srv.Close()
 
-		exchanger := &jwtExchanger{tokenEndpoint: srv.URL, logger: nopLogger}
+		exchanger := newJWTExchanger(srv.URL, 0, nopLogger, nil)
+		defer exchanger.Close()
 		jwt := makeTestJWT(time.Now().Add(10 * time.Minute).Unix())
 		pat, err := exchanger.exchange(t.Context(), jwt)
 		assert.NoError(t, err)
@@ -113,7 +116,8 @@ func TestJwtExchangerExchange(t *testing.T) {
 		}))
 		defer srv.Close()
 
-		exchanger := &jwtExchanger{tokenEndpoint: srv.URL, logger: nopLogger}
+		exchanger := newJWTExchanger(srv.URL, 0, nopLogger, nil)
+		defer exchanger.Close()
 		jwt := makeTestJWT(time.Now().Add(10 * time.Minute).Unix())
 
 		pat1, err := exchanger.exchange(t.Context(), jwt)
@@ -132,7 +136,8 @@ func TestJwtExchangerExchange(t *testing.T) {
 		}))
 		defer srv.Close()
 
-		exchanger := &jwtExchanger{tokenEndpoint: srv.URL, logger: nopLogger}
+		exchanger := newJWTExchanger(srv.URL, 0, nopLogger, nil)
+		defer exchanger.Close()
 		jwt := makeTestJWT(time.Now().Add(10 * time.Minute).Unix())
 		_, err := exchanger.exchange(t.Context(), jwt)
 		assert.Error(t, err)
@@ -147,7 +152,8 @@ func TestJwtExchangerExchange(t *testing.T) {
 		}))
 		defer srv.Close()
 
-		exchanger := &jwtExchanger{tokenEndpoint: srv.URL, logger: nopLogger}
+		exchanger := newJWTExchanger(srv.URL, 0, nopLogger, nil)
+		defer exchanger.Close()
 		jwt := makeTestJWT(time.Now().Add(10 * time.Minute).Unix())
 		_, err := exchanger.exchange(t.Context(), jwt)
 		assert.Error(t, err)
@@ -190,3 +196,108 @@ func TestOauthProtectedResourceHandler(t *testing.T) {
 		}
 	})
 }
+
+func TestBearerAuth(t *testing.T) {
+	tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		if r.FormValue("subject_token") == makeTestJWT(1) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"exchanged-pat"}`))
+	}))
+	defer tokenEndpoint.Close()
+	exchanger := newJWTExchanger(tokenEndpoint.URL, 0, zap.NewNop().Sugar(), nil)
+	defer exchanger.Close()
+
+	oauthServer := &oauth.Server{Store: oauth.NewMemoryStore()}
+
+	cases := map[string]struct {
+		advertisesOAuth bool
+		oauthServer     *oauth.Server
+		authorization   string
+		wantStatus      int
+		wantChallenge   string
+		wantPAT         string
+	}{
+		"PAT": {
+			authorization: "Bearer my-pat",
+			wantStatus:    http.StatusOK,
+			wantPAT:       "my-pat",
+		},
+		"exchanged JWT": {
+			authorization: "Bearer " + makeTestJWT(time.Now().Add(time.Hour).Unix()),
+			wantStatus:    http.StatusOK,
+			wantPAT:       "exchanged-pat",
+		},
+		"no token without OAuth": {
+			wantStatus: http.StatusOK,
+		},
+		"no token with OAuth": {
+			advertisesOAuth: true,
+			wantStatus:      http.StatusUnauthorized,
+			wantChallenge:   `Bearer resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource"`,
+		},
+		"failed exchange with OAuth": {
+			advertisesOAuth: true,
+			authorization:   "Bearer " + makeTestJWT(1),
+			wantStatus:      http.StatusUnauthorized,
+			wantChallenge:   `Bearer resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource", error="invalid_token", error_description="the token could not be exchanged for a Bitrise PAT"`,
+		},
+		"unknown access token of the built-in server": {
+			advertisesOAuth: true,
+			oauthServer:     oauthServer,
+			authorization:   "Bearer " + oauth.AccessTokenPrefix + "unknown",
+			wantStatus:      http.StatusUnauthorized,
+			wantChallenge:   `Bearer resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource", error="invalid_token", error_description="the access token is invalid or expired"`,
+		},
+		"PAT with the built-in server": {
+			advertisesOAuth: true,
+			oauthServer:     oauthServer,
+			authorization:   "Bearer my-pat",
+			wantStatus:      http.StatusOK,
+			wantPAT:         "my-pat",
+		},
+		"failed exchange without OAuth": {
+			authorization: "Bearer " + makeTestJWT(1),
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token", error_description="the token could not be exchanged for a Bitrise PAT"`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var gotPAT string
+			auth := &bearerAuth{exchanger: exchanger, oauthServer: tc.oauthServer, advertisesOAuth: tc.advertisesOAuth, logger: zap.NewNop().Sugar()}
+			handler := auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPAT = bitrise.PATFingerprint(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Host = "mcp.example.com"
+			req.Header.Set("X-Forwarded-Proto", "https")
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatus, w.Code)
+			assert.Equal(t, tc.wantChallenge, w.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, bitrise.PATFingerprint(bitrise.ContextWithPAT(t.Context(), tc.wantPAT)), gotPAT)
+		})
+	}
+}
+
+func TestOauthProtectedResourceHandlerBuiltInServer(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/oauth-protected-resource", nil)
+	req.Host = "mcp.example.com"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	oauthProtectedResourceHandler("")(w, req)
+
+	var body map[string]any
+	if assert.NoError(t, json.NewDecoder(w.Body).Decode(&body)) {
+		assert.Equal(t, []any{"https://mcp.example.com"}, body["authorization_servers"])
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const confirmationTokenTTL = 5 * time.Minute
+
+// toolCatalog is the subset of tool.Belt the confirmer needs.
+type toolCatalog interface {
+	Destructive(name string) bool
+	Definition(name string) (mcp.Tool, bool)
+}
+
+// confirmer asks the user to confirm destructive tool calls. It uses MCP
+// elicitation when the client supports it and falls back to a two-step flow
+// with a signed, single-use confirmation token otherwise.
+type confirmer struct {
+	mcpServer *server.MCPServer
+	tools     toolCatalog
+	secret    []byte
+	now       func() time.Time
+	// describeApp resolves an app slug for the summary; replaced in tests.
+	describeApp func(ctx context.Context, appSlug string) string
+	// used holds the tokens already redeemed until they expire.
+	used sync.Map
+}
+
+func newConfirmer(mcpServer *server.MCPServer, tools toolCatalog, secret []byte) *confirmer {
+	return &confirmer{
+		mcpServer:   mcpServer,
+		tools:       tools,
+		secret:      secret,
+		now:         time.Now,
+		describeApp: describeApp,
+	}
+}
+
+func (c *confirmer) middleware(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := request.Params.Name
+		// Nothing is changed in dry-run mode, so there is nothing to confirm.
+		if !c.tools.Destructive(name) || bitrise.DryRunFromCtx(ctx) {
+			return fn(ctx, request)
+		}
+		args := request.GetArguments()
+
+		if token, ok := args["confirmation_token"].(string); ok && token != "" {
+			if err := c.redeem(ctx, name, args, token); err != nil {
+				return mcp.NewToolResultErrorf("invalid confirmation token: %s. Call the tool again without confirmation_token to get a new one.", err), nil
+			}
+			return fn(ctx, request)
+		}
+
+		summary := c.summary(ctx, name, args)
+		if supportsElicitation(ctx) {
+			confirmed, err := c.elicit(ctx, summary)
+			if err == nil {
+				if !confirmed {
+					return mcp.NewToolResultError("The user did not confirm the action, it was not performed. Do not retry unless the user asks for it."), nil
+				}
+				return fn(ctx, request)
+			}
+			// Fall back to the token flow if the client failed to answer.
+		}
+
+		token, expiresAt := c.issue(ctx, name, args)
+		setAuditOutcome(ctx, auditOutcomePendingConfirmation)
+		return mcp.NewToolResultStructuredOnly(map[string]any{
+			"confirmation_required": true,
+			"summary":               summary,
+			"confirmation_token":    token,
+			"expires_at":            expiresAt.UTC().Format(time.RFC3339),
+			"message": fmt.Sprintf(
+				"The action was not performed. Show the summary to the user and ask for explicit confirmation. Only if the user confirms, call %s again with the same arguments and confirmation_token set to the token above.",
+				name,
+			),
+		}), nil
+	}
+}
+
+func supportsElicitation(ctx context.Context) bool {
+	session := server.ClientSessionFromContext(ctx)
+	if _, ok := session.(server.SessionWithElicitation); !ok {
+		return false
+	}
+	withInfo, ok := session.(server.SessionWithClientInfo)
+	return ok && withInfo.GetClientCapabilities().Elicitation != nil
+}
+
+func (c *confirmer) elicit(ctx context.Context, summary string) (bool, error) {
+	res, err := c.mcpServer.RequestElicitation(ctx, mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: summary + "\n\nDo you want to continue?",
+			RequestedSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"confirm": map[string]any{
+						"type":        "boolean",
+						"title":       "Confirm",
+						"description": "Perform this action on Bitrise",
+					},
+				},
+				"required": []string{"confirm"},
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if res.Action != mcp.ElicitationResponseActionAccept {
+		return false, nil
+	}
+	content, _ := res.Content.(map[string]any)
+	confirmed, _ := content["confirm"].(bool)
+	return confirmed, nil
+}
+
+// summary describes the tool call for the user, resolving the affected app
+// when the call targets one.
+func (c *confirmer) summary(ctx context.Context, name string, args map[string]any) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The assistant wants to run %q", name)
+	if definition, ok := c.tools.Definition(name); ok && definition.Description != "" {
+		fmt.Fprintf(&b, " (%s)", firstSentence(definition.Description))
+	}
+	b.WriteString(", which may modify or delete data on Bitrise.")
+
+	if appSlug, ok := args["app_slug"].(string); ok && appSlug != "" {
+		if app := c.describeApp(ctx, appSlug); app != "" {
+			fmt.Fprintf(&b, "\nApp: %s", app)
+		}
+	}
+
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		if key != "confirmation_token" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		b.WriteString("\nArguments:")
+		for _, key := range keys {
+			value, _ := json.Marshal(args[key])
+			fmt.Fprintf(&b, "\n- %s: %s", key, value)
+		}
+	}
+	return b.String()
+}
+
+func firstSentence(s string) string {
+	if i := strings.Index(s, ". "); i >= 0 {
+		return s[:i]
+	}
+	return strings.TrimSuffix(s, ".")
+}
+
+// describeApp returns the title and repository of an app, or "" if it can't
+// be fetched. It is only used to make the confirmation summary readable.
+func describeApp(ctx context.Context, appSlug string) string {
+	res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
+		Method: http.MethodGet,
+		API:    bitrise.APIMain,
+		Path:   fmt.Sprintf("/apps/%s", appSlug),
+	})
+	if err != nil {
+		return ""
+	}
+	var app struct {
+		Data struct {
+			Title   string `json:"title"`
+			RepoURL string `json:"repo_url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(res), &app); err != nil || app.Data.Title == "" {
+		return ""
+	}
+	if app.Data.RepoURL == "" {
+		return app.Data.Title
+	}
+	return fmt.Sprintf("%s (%s)", app.Data.Title, app.Data.RepoURL)
+}
+
+// issue returns a token that confirms exactly this call: same tool, same
+// arguments and same PAT, until it expires.
+func (c *confirmer) issue(ctx context.Context, name string, args map[string]any) (string, time.Time) {
+	expiresAt := c.now().Add(confirmationTokenTTL).Truncate(time.Second)
+	exp := strconv.FormatInt(expiresAt.Unix(), 10)
+	return exp + "." + c.sign(ctx, name, args, exp), expiresAt
+}
+
+func (c *confirmer) redeem(ctx context.Context, name string, args map[string]any, token string) error {
+	exp, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return errors.New("malformed token")
+	}
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if !hmac.Equal([]byte(mac), []byte(c.sign(ctx, name, args, exp))) {
+		return errors.New("the token was issued for a different tool call")
+	}
+	now := c.now()
+	if now.After(time.Unix(expUnix, 0)) {
+		return errors.New("the token has expired")
+	}
+
+	c.used.Range(func(key, value any) bool {
+		if now.After(value.(time.Time)) { //nolint:forcetypeassert
+			c.used.Delete(key)
+		}
+		return true
+	})
+	if _, loaded := c.used.LoadOrStore(token, time.Unix(expUnix, 0)); loaded {
+		return errors.New("the token has already been used")
+	}
+	return nil
+}
+
+func (c *confirmer) sign(ctx context.Context, name string, args map[string]any, exp string) string {
+	args = maps.Clone(args)
+	delete(args, "confirmation_token")
+	// json.Marshal sorts map keys, so equal arguments encode identically.
+	encodedArgs, _ := json.Marshal(args)
+
+	h := hmac.New(sha256.New, c.secret)
+	for _, part := range []string{name, string(encodedArgs), bitrise.PATFingerprint(ctx), exp} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
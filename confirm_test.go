@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCatalog map[string]bool
+
+func (f fakeCatalog) Destructive(name string) bool { return f[name] }
+
+func (f fakeCatalog) Definition(name string) (mcp.Tool, bool) {
+	return mcp.NewTool(name, mcp.WithDescription("Delete an app. Really.")), true
+}
+
+func TestConfirmerMiddleware(t *testing.T) {
+	c := newConfirmer(nil, fakeCatalog{"delete_app": true}, []byte("secret"))
+	c.describeApp = func(ctx context.Context, appSlug string) string { return "My App (git@github.com:org/my-app.git)" }
+	var calls int
+	handler := c.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls++
+		return mcp.NewToolResultText("done"), nil
+	})
+	call := func(tool string, args map[string]any) *mcp.CallToolResult {
+		var request mcp.CallToolRequest
+		request.Params.Name = tool
+		request.Params.Arguments = args
+		res, err := handler(bitrise.ContextWithPAT(t.Context(), "pat"), request)
+		assert.NoError(t, err)
+		return res
+	}
+
+	t.Run("non-destructive tools run immediately", func(t *testing.T) {
+		calls = 0
+		call("list_apps", nil)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("destructive tool requires a token and accepts it once", func(t *testing.T) {
+		calls = 0
+		res := call("delete_app", map[string]any{"app_slug": "abc"})
+		assert.Equal(t, 0, calls)
+		structured := res.StructuredContent.(map[string]any)
+		assert.Equal(t, true, structured["confirmation_required"])
+		assert.Contains(t, structured["summary"], `"delete_app" (Delete an app)`)
+		assert.Contains(t, structured["summary"], "App: My App (git@github.com:org/my-app.git)")
+		assert.Contains(t, structured["summary"], `- app_slug: "abc"`)
+		token := structured["confirmation_token"].(string)
+
+		res = call("delete_app", map[string]any{"app_slug": "abc", "confirmation_token": token})
+		assert.False(t, res.IsError)
+		assert.Equal(t, 1, calls)
+
+		res = call("delete_app", map[string]any{"app_slug": "abc", "confirmation_token": token})
+		assert.True(t, res.IsError)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("token is bound to the arguments", func(t *testing.T) {
+		calls = 0
+		res := call("delete_app", map[string]any{"app_slug": "abc"})
+		token := res.StructuredContent.(map[string]any)["confirmation_token"].(string)
+
+		res = call("delete_app", map[string]any{"app_slug": "other", "confirmation_token": token})
+		assert.True(t, res.IsError)
+		assert.Equal(t, 0, calls)
+	})
+
+	t.Run("dry-run skips confirmation", func(t *testing.T) {
+		calls = 0
+		var request mcp.CallToolRequest
+		request.Params.Name = "delete_app"
+		_, err := handler(bitrise.ContextWithDryRun(t.Context()), request)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestConfirmerRedeem(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newConfirmer(nil, fakeCatalog{}, []byte("secret"))
+	c.now = func() time.Time { return now }
+	ctx := bitrise.ContextWithPAT(t.Context(), "pat")
+	args := map[string]any{"app_slug": "abc"}
+
+	t.Run("expired token is rejected", func(t *testing.T) {
+		token, _ := c.issue(ctx, "delete_app", args)
+		now = now.Add(confirmationTokenTTL + time.Second)
+		assert.ErrorContains(t, c.redeem(ctx, "delete_app", args, token), "expired")
+	})
+
+	t.Run("token of another PAT is rejected", func(t *testing.T) {
+		token, _ := c.issue(ctx, "delete_app", args)
+		other := bitrise.ContextWithPAT(t.Context(), "other-pat")
+		assert.ErrorContains(t, c.redeem(other, "delete_app", args, token), "different tool call")
+	})
+
+	t.Run("malformed token is rejected", func(t *testing.T) {
+		assert.ErrorContains(t, c.redeem(ctx, "delete_app", args, "nope"), "malformed")
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const tokenCommandTimeout = 30 * time.Second
+
+// tokenProvider returns the PAT used by the stdio transport.
+type tokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// staticToken is a PAT given directly in the configuration.
+type staticToken string
+
+func (t staticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// envToken reads the PAT from an environment variable on every call.
+type envToken string
+
+func (name envToken) Token(context.Context) (string, error) {
+	if token := os.Getenv(string(name)); token != "" {
+		return token, nil
+	}
+	return "", fmt.Errorf("environment variable %s is not set", string(name))
+}
+
+// cachedToken fetches the PAT with fetch and caches it for refresh. When a
+// refresh fails, the failure is logged and the previous token keeps being
+// used until a later refresh succeeds.
+type cachedToken struct {
+	fetch   func(ctx context.Context) (string, error)
+	refresh time.Duration
+	now     func() time.Time
+	logger  *zap.SugaredLogger
+
+	mu        sync.Mutex
+	token     string
+	fetchedAt time.Time
+	// fetching is closed when the fetch in flight is done, nil without one.
+	fetching chan struct{}
+	// fetchErr is the error of the last fetch, for the callers waiting on it.
+	fetchErr error
+}
+
+func newCachedToken(fetch func(ctx context.Context) (string, error), refresh time.Duration, logger *zap.SugaredLogger) *cachedToken {
+	return &cachedToken{fetch: fetch, refresh: refresh, now: time.Now, logger: logger}
+}
+
+// Token returns the cached token, fetching it when it is due. Only one fetch
+// runs at a time: while it runs, the other callers get the previous token, or
+// wait for the fetch when there is none.
+func (c *cachedToken) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if c.token != "" && (c.fetching != nil || c.refresh <= 0 || c.now().Sub(c.fetchedAt) < c.refresh) {
+		defer c.mu.Unlock()
+		return c.token, nil
+	}
+	if fetching := c.fetching; fetching != nil {
+		c.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.token == "" {
+			return "", c.fetchErr
+		}
+		return c.token, nil
+	}
+	fetching := make(chan struct{})
+	c.fetching = fetching
+	c.mu.Unlock()
+
+	token, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetching = nil
+	close(fetching)
+	c.fetchErr = err
+	if err != nil {
+		if c.token != "" {
+			c.logger.Errorw("refresh bitrise token, using the previous token", "error", err)
+			return c.token, nil
+		}
+		return "", err
+	}
+	c.token, c.fetchedAt = token, c.now()
+	return token, nil
+}
+
+// tokenFromFile returns a fetch function reading the PAT from a file, e.g. a
+// secret mounted by a vault agent.
+func tokenFromFile(path string) func(ctx context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read token file: %w", err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", path)
+		}
+		return token, nil
+	}
+}
+
+// tokenFromCommand returns a fetch function running a credential helper,
+// e.g. "pass show bitrise" or "op read op://Private/Bitrise/token", and
+// using its standard output as the PAT.
+func tokenFromCommand(command string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, tokenCommandTimeout)
+		defer cancel()
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", command)
+		}
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("run token command: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		token := strings.TrimSpace(stdout.String())
+		if token == "" {
+			return "", errors.New("token command printed no token")
+		}
+		return token, nil
+	}
+}
+
+// tokenSource is one of the ways of configuring a PAT. At most one of its
+// fields may be set.
+type tokenSource struct {
+	Token   string
+	Env     string
+	File    string
+	Command string
+}
+
+// provider returns the provider of the source, or nil if no source is set.
+func (s tokenSource) provider(refresh time.Duration, logger *zap.SugaredLogger) (tokenProvider, error) {
+	var set int
+	for _, value := range []string{s.Token, s.Env, s.File, s.Command} {
+		if value != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("only one token source may be set")
+	}
+	switch {
+	case s.Token != "":
+		return staticToken(s.Token), nil
+	case s.Env != "":
+		return envToken(s.Env), nil
+	case s.File != "":
+		return newCachedToken(tokenFromFile(s.File), refresh, logger), nil
+	case s.Command != "":
+		return newCachedToken(tokenFromCommand(s.Command), refresh, logger), nil
+	}
+	return nil, nil //nolint:nilnil
+}
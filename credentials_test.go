@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCachedToken(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var fetches int
+	var fetchErr error
+	c := newCachedToken(func(context.Context) (string, error) {
+		fetches++
+		if fetchErr != nil {
+			return "", fetchErr
+		}
+		return "pat-" + string(rune('0'+fetches)), nil
+	}, time.Minute, zap.NewNop().Sugar())
+	c.now = func() time.Time { return now }
+
+	token, err := c.Token(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, "pat-1", token)
+
+	now = now.Add(30 * time.Second)
+	token, _ = c.Token(t.Context())
+	assert.Equal(t, "pat-1", token)
+	assert.Equal(t, 1, fetches)
+
+	now = now.Add(time.Minute)
+	token, _ = c.Token(t.Context())
+	assert.Equal(t, "pat-2", token)
+
+	// A failed refresh keeps the previous token.
+	now = now.Add(2 * time.Minute)
+	fetchErr = errors.New("helper failed")
+	token, err = c.Token(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, "pat-2", token)
+	assert.Equal(t, 3, fetches)
+}
+
+func TestCachedTokenRefreshInBackground(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&logs), zap.DebugLevel))
+	started, release := make(chan struct{}), make(chan struct{})
+	var fetches atomic.Int32
+	c := newCachedToken(func(context.Context) (string, error) {
+		if fetches.Add(1) == 1 {
+			return "pat-1", nil
+		}
+		close(started)
+		<-release
+		return "", errors.New("helper failed")
+	}, time.Minute, logger.Sugar())
+	c.now = func() time.Time { return now }
+	_, err := c.Token(t.Context())
+	assert.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	done := make(chan string)
+	go func() {
+		token, _ := c.Token(t.Context())
+		done <- token
+	}()
+	<-started
+	token, err := c.Token(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, "pat-1", token, "callers don't wait for a refresh")
+	assert.Equal(t, int32(2), fetches.Load(), "one refresh at a time")
+
+	close(release)
+	assert.Equal(t, "pat-1", <-done)
+	assert.Contains(t, logs.String(), "helper failed", "failed refreshes are logged")
+}
+
+func TestCachedTokenFirstFetchFails(t *testing.T) {
+	c := newCachedToken(func(context.Context) (string, error) {
+		return "", errors.New("helper failed")
+	}, time.Minute, zap.NewNop().Sugar())
+	_, err := c.Token(t.Context())
+	assert.EqualError(t, err, "helper failed")
+}
+
+func TestTokenSourceProvider(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("file-pat\n"), 0o600))
+	emptyFile := filepath.Join(dir, "empty")
+	assert.NoError(t, os.WriteFile(emptyFile, nil, 0o600))
+	t.Setenv("TEST_BITRISE_PAT", "env-pat")
+
+	cases := map[string]struct {
+		source     tokenSource
+		wantNil    bool
+		wantToken  string
+		wantErr    bool
+		wantSrcErr bool
+	}{
+		"none":           {wantNil: true},
+		"token":          {source: tokenSource{Token: "pat"}, wantToken: "pat"},
+		"env":            {source: tokenSource{Env: "TEST_BITRISE_PAT"}, wantToken: "env-pat"},
+		"missing env":    {source: tokenSource{Env: "TEST_BITRISE_MISSING"}, wantErr: true},
+		"file":           {source: tokenSource{File: tokenFile}, wantToken: "file-pat"},
+		"empty file":     {source: tokenSource{File: emptyFile}, wantErr: true},
+		"missing file":   {source: tokenSource{File: filepath.Join(dir, "missing")}, wantErr: true},
+		"command":        {source: tokenSource{Command: "echo '  command-pat  '"}, wantToken: "command-pat"},
+		"failed command": {source: tokenSource{Command: "echo oops >&2; exit 1"}, wantErr: true},
+		"silent command": {source: tokenSource{Command: "true"}, wantErr: true},
+		"several":        {source: tokenSource{Token: "pat", File: tokenFile}, wantSrcErr: true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			provider, err := tc.source.provider(time.Minute, zap.NewNop().Sugar())
+			if tc.wantSrcErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.wantNil {
+				assert.Nil(t, provider)
+				return
+			}
+			token, err := provider.Token(t.Context())
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantToken, token)
+		})
+	}
+}
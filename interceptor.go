@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/completion"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/session"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	methodResourcesSubscribe   = "resources/subscribe"
+	methodResourcesUnsubscribe = "resources/unsubscribe"
+	methodCompletionComplete   = "completion/complete"
+	// stdioSessionID is the ID of the only session of the stdio transport.
+	stdioSessionID = "stdio"
+)
+
+// interceptor answers the requests mcp-go doesn't dispatch in front of the
+// transports: resources/subscribe and resources/unsubscribe when the
+// transport is stateful, and completion/complete. As mcp-go can't declare the
+// completions capability either, it's added to the initialize result on its
+// way out.
+type interceptor struct {
+	// subs is nil when the transport is stateless.
+	subs      *subscriptions
+	completer *completion.Completer
+	// credentials adds the PAT to the context of a completion request of the
+	// stdio transport, where it's set by tool middlewares otherwise. nil for
+	// the HTTP transports, whose requests carry it already.
+	credentials func(ctx context.Context) (context.Context, error)
+}
+
+type interceptedRequest struct {
+	ID     mcp.RequestId   `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// parse tells whether a JSON-RPC message is a request the interceptor
+// answers.
+func (i *interceptor) parse(message []byte) (interceptedRequest, bool) {
+	var request interceptedRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return interceptedRequest{}, false
+	}
+	return request, i.intercepts(request.Method)
+}
+
+func (i *interceptor) intercepts(method string) bool {
+	switch method {
+	case methodResourcesSubscribe, methodResourcesUnsubscribe:
+		return i.subs != nil
+	case methodCompletionComplete:
+		return true
+	}
+	return false
+}
+
+func (i *interceptor) handle(ctx context.Context, sessionID string, request interceptedRequest) mcp.JSONRPCMessage {
+	if request.Method == methodCompletionComplete {
+		return i.complete(ctx, request)
+	}
+	return i.subs.handle(ctx, sessionID, request)
+}
+
+// complete answers a completion/complete request.
+func (i *interceptor) complete(ctx context.Context, request interceptedRequest) mcp.JSONRPCMessage {
+	var params struct {
+		Ref      completion.Ref `json:"ref"`
+		Argument struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"argument"`
+		Context struct {
+			Arguments map[string]string `json:"arguments"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(request.Params, &params); err != nil || params.Argument.Name == "" {
+		return mcp.NewJSONRPCError(request.ID, mcp.INVALID_PARAMS, "missing argument name", nil)
+	}
+	if i.credentials != nil {
+		var err error
+		if ctx, err = i.credentials(ctx); err != nil {
+			return mcp.NewJSONRPCError(request.ID, mcp.INTERNAL_ERROR, err.Error(), nil)
+		}
+	}
+	values, total, err := i.completer.Complete(ctx, params.Ref, params.Argument.Name, params.Argument.Value, params.Context.Arguments)
+	if errors.Is(err, completion.ErrInvalidRef) {
+		return mcp.NewJSONRPCError(request.ID, mcp.INVALID_PARAMS, err.Error(), nil)
+	}
+	if err != nil {
+		return mcp.NewJSONRPCError(request.ID, mcp.INTERNAL_ERROR, err.Error(), nil)
+	}
+	var result mcp.CompleteResult
+	result.Completion.Values = values
+	result.Completion.Total = total
+	result.Completion.HasMore = total > len(values)
+	return mcp.NewJSONRPCResultResponse(request.ID, result)
+}
+
+// streamableMiddleware answers the intercepted requests of the streamable
+// HTTP transport. sessions is nil when the transport is stateless.
+func (i *interceptor) streamableMiddleware(sessions *session.Manager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := peekRequest(r)
+		if !i.intercepts(request.Method) {
+			if request.Method == string(mcp.MethodInitialize) {
+				w = &completionsResponseWriter{ResponseWriter: w}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		sessionID := r.Header.Get(server.HeaderKeySessionID)
+		if sessions != nil {
+			if sessionID == "" {
+				http.Error(w, "Missing session ID", http.StatusBadRequest)
+				return
+			}
+			terminated, err := sessions.Validate(sessionID, bitrise.PATFingerprint(r.Context()))
+			if err != nil {
+				http.Error(w, "Invalid session ID", http.StatusBadRequest)
+				return
+			}
+			if terminated {
+				http.Error(w, "Session terminated", http.StatusNotFound)
+				return
+			}
+		}
+		response := i.handle(httpContextFunc(r.Context(), r), sessionID, request)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	})
+}
+
+// sseMiddleware answers the intercepted requests posted to the message
+// endpoint of the legacy HTTP+SSE transport. Like every response of the
+// transport, the response is sent on the session's SSE stream.
+func (i *interceptor) sseMiddleware(sseServer *server.SSEServer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// The SSE stream, where the initialize result is sent.
+			next.ServeHTTP(&completionsResponseWriter{ResponseWriter: w}, r)
+			return
+		}
+		sessionID := r.URL.Query().Get("sessionId")
+		request := peekRequest(r)
+		if !i.intercepts(request.Method) || sessionID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		ctx := context.WithoutCancel(httpContextFunc(r.Context(), r))
+		go func() {
+			if err := sseServer.SendEventToSession(sessionID, i.handle(ctx, sessionID, request)); err != nil && i.subs != nil {
+				// Not a session of this server, or it's gone already.
+				i.subs.scheduler.EndSession(sessionID)
+			}
+		}()
+	})
+}
+
+// peekRequest reads the JSON-RPC request posted to an HTTP transport, the
+// zero request if it isn't one. The body is left for the next handler.
+func peekRequest(r *http.Request) interceptedRequest {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return interceptedRequest{}
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return interceptedRequest{}
+	}
+	var request interceptedRequest
+	_ = json.Unmarshal(body, &request)
+	return request
+}
+
+// stdioInput answers the intercepted requests read from in and returns the
+// rest of the input for the stdio server. Responses are written to out, which
+// must be shared with the stdio server.
+func (i *interceptor) stdioInput(ctx context.Context, in io.Reader, out io.Writer) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if request, ok := i.parse(line); ok {
+				go func() {
+					response, _ := json.Marshal(i.handle(ctx, stdioSessionID, request))
+					_, _ = out.Write(append(response, '\n'))
+				}()
+			} else if len(line) > 0 {
+				if _, err := pw.Write(line); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+// stdioOutput is the writer shared by the stdio server and the interceptor.
+// Writes are serialized, so their messages don't interleave, and the
+// completions capability is added to the initialize result.
+type stdioOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (o *stdioOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := o.w.Write(declareCompletions(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// completionsResponseWriter adds the completions capability to the
+// initialize result written to an HTTP response, as a JSON body or an SSE
+// event. mcp-go writes each message with a single Write.
+type completionsResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *completionsResponseWriter) Write(p []byte) (int, error) {
+	if _, err := w.ResponseWriter.Write(declareCompletions(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *completionsResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// declareCompletions adds the completions capability to the server
+// capabilities of an initialize result. p is a JSON-RPC message, possibly
+// framed as a line or an SSE event. Other messages are returned unchanged.
+func declareCompletions(p []byte) []byte {
+	if !bytes.Contains(p, []byte(`"serverInfo"`)) {
+		return p
+	}
+	start, end := bytes.IndexByte(p, '{'), bytes.LastIndexByte(p, '}')
+	if start < 0 || end < start {
+		return p
+	}
+	var message struct {
+		JSONRPC string                     `json:"jsonrpc"`
+		ID      json.RawMessage            `json:"id"`
+		Result  map[string]json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(p[start:end+1], &message); err != nil || message.Result["serverInfo"] == nil {
+		return p
+	}
+	var capabilities map[string]json.RawMessage
+	if err := json.Unmarshal(message.Result["capabilities"], &capabilities); err != nil || capabilities == nil {
+		capabilities = map[string]json.RawMessage{}
+	}
+	capabilities["completions"] = json.RawMessage(`{}`)
+	var err error
+	if message.Result["capabilities"], err = json.Marshal(capabilities); err != nil {
+		return p
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return p
+	}
+	return append(append(append([]byte{}, p[:start]...), data...), p[end+1:]...)
+}
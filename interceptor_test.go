@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/completion"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeclareCompletions(t *testing.T) {
+	cases := map[string]struct {
+		message string
+		want    string
+	}{
+		"stdio line": {
+			message: `{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-06-18","capabilities":{"prompts":{}},"serverInfo":{"name":"bitrise","version":"1"}}}` + "\n",
+			want:    `{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"completions":{},"prompts":{}},"protocolVersion":"2025-06-18","serverInfo":{"name":"bitrise","version":"1"}}}` + "\n",
+		},
+		"sse event": {
+			message: "event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":\"a\",\"result\":{\"serverInfo\":{\"name\":\"bitrise\"}}}\n\n",
+			want:    "event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":\"a\",\"result\":{\"capabilities\":{\"completions\":{}},\"serverInfo\":{\"name\":\"bitrise\"}}}\n\n",
+		},
+		"other result": {
+			message: `{"jsonrpc":"2.0","id":2,"result":{"content":[{"type":"text","text":"\"serverInfo\""}]}}`,
+			want:    `{"jsonrpc":"2.0","id":2,"result":{"content":[{"type":"text","text":"\"serverInfo\""}]}}`,
+		},
+		"not json": {
+			message: `: ping "serverInfo"`,
+			want:    `: ping "serverInfo"`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, string(declareCompletions([]byte(tc.message))))
+		})
+	}
+}
+
+func TestInterceptorStreamable(t *testing.T) {
+	mcpServer := server.NewMCPServer("test", "1", server.WithToolCapabilities(false))
+	mcpServer.AddTool(mcp.NewTool("list_apps"), func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(`{"data":[{"slug":"app1","title":"Mobile App"},{"slug":"app2","title":"Website"}]}`), nil
+	})
+	completer := completion.New(tool.ServerCaller(mcpServer), time.Minute)
+	t.Cleanup(completer.Close)
+	intercept := &interceptor{completer: completer}
+	handler := intercept.streamableMiddleware(nil, server.NewStreamableHTTPServer(
+		mcpServer,
+		server.WithSessionIdManager(&server.StatelessSessionIdManager{}),
+		server.WithDisableStreaming(true),
+	))
+
+	post := func(body string) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(w, r)
+		data, _ := io.ReadAll(w.Result().Body)
+		return string(data)
+	}
+
+	cases := map[string]struct {
+		body string
+		want string
+	}{
+		"initialize": {
+			body: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+			want: `"completions":{}`,
+		},
+		"complete app by title": {
+			body: `{"jsonrpc":"2.0","id":2,"method":"completion/complete","params":{"ref":{"type":"ref/prompt","name":"diagnose_failed_build"},"argument":{"name":"app_slug","value":"web"}}}`,
+			want: `{"jsonrpc":"2.0","id":2,"result":{"completion":{"values":["app2"],"total":1}}}`,
+		},
+		"invalid ref": {
+			body: `{"jsonrpc":"2.0","id":3,"method":"completion/complete","params":{"ref":{"type":"ref/unknown"},"argument":{"name":"app_slug"}}}`,
+			want: `"code":-32602`,
+		},
+		"no subscriptions when stateless": {
+			body: `{"jsonrpc":"2.0","id":4,"method":"resources/subscribe","params":{"uri":"bitrise://apps/app1/builds/build1"}}`,
+			want: `"code":-32601`,
+		},
+		"other requests": {
+			body: `{"jsonrpc":"2.0","id":5,"method":"ping"}`,
+			want: `{"jsonrpc":"2.0","id":5,"result":{}}`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Contains(t, post(tc.body), tc.want)
+		})
+	}
+}
@@ -12,24 +12,41 @@ import (
 	"time"
 
 	httptrace "github.com/DataDog/dd-trace-go/contrib/net/http/v2"
+	"github.com/cenkalti/backoff/v5"
 )
 
 // APIBaseURL, APIRMBaseURL, and APICodePushBaseURL are vars so main can override
 // them via environment variables to point at non-production API instances.
 var (
-	APIBaseURL         = "https://api.bitrise.io/v0.1"                          //nolint:gochecknoglobals
-	APIRMBaseURL       = "https://api.bitrise.io/release-management/v1"         //nolint:gochecknoglobals
+	APIBaseURL         = "https://api.bitrise.io/v0.1"                               //nolint:gochecknoglobals
+	APIRMBaseURL       = "https://api.bitrise.io/release-management/v1"              //nolint:gochecknoglobals
 	APICodePushBaseURL = "https://api.bitrise.io/release-management/v2/code-push/v1" //nolint:gochecknoglobals
 )
 
+// API selects one of the Bitrise APIs. Its base URL can be overridden for
+// the calls made with a context, see ContextWithBaseURLs.
+type API int
+
+const (
+	// APIMain is the v0.1 API at APIBaseURL.
+	APIMain API = iota
+	// APIRM is the Release Management API at APIRMBaseURL.
+	APIRM
+	// APICodePush is the CodePush API at APICodePushBaseURL.
+	APICodePush
+)
+
 const userAgent = "bitrise-mcp/1.0"
 
 type CallAPIParams struct {
-	Method  string
-	BaseURL string
-	Path    string
-	Params  map[string]any
-	Body    any
+	Method string
+	API    API
+	Path   string
+	Params map[string]any
+	Body   any
+	// IdempotencyKey is sent as the Idempotency-Key header. Setting it allows
+	// CallAPI to retry non-idempotent requests (e.g. POST) on transient errors.
+	IdempotencyKey string
 }
 
 func CallAPI(ctx context.Context, p CallAPIParams) (string, error) {
@@ -38,25 +55,119 @@ func CallAPI(ctx context.Context, p CallAPIParams) (string, error) {
 		return "", errors.New("set authorization header to your bitrise pat")
 	}
 
-	var reqBody io.Reader
+	var body []byte
 	if p.Body != nil {
-		a, err := json.Marshal(p.Body)
+		body, err = json.Marshal(p.Body)
 		if err != nil {
 			return "", fmt.Errorf("marshal request body: %w", err)
 		}
-		reqBody = bytes.NewBuffer(a)
 	}
 
-	fullURL := p.BaseURL
-	if !strings.HasPrefix(p.Path, "/") {
-		fullURL += "/"
+	path := p.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
 	}
-	fullURL += p.Path
+	fullURL := resolveBaseURL(ctx, p.API) + path
 
-	req, err := http.NewRequestWithContext(ctx, p.Method, fullURL, reqBody)
+	if DryRunFromCtx(ctx) && !isSafeMethod(p.Method) {
+		req, err := newRequest(ctx, p, fullURL, body, apiKey)
+		if err != nil {
+			return "", err
+		}
+		return "", newDryRunRequest(req, body)
+	}
+
+	ctx, span := startAPISpan(ctx, p.Method, path)
+	start := time.Now()
+	res, status, err := send(ctx, p, path, fullURL, body, apiKey)
+	EndSpan(span, status, err)
+	notifyAPICall(ctx, APICall{
+		Method:       p.Method,
+		Path:         path,
+		PathTemplate: PathTemplate(path),
+		StatusCode:   status,
+		Duration:     time.Since(start),
+	})
+	return res, err
+}
+
+// send executes the request, retrying it according to APIRetryPolicy. It
+// returns the status code of the last response, or 0 if none was received.
+func send(ctx context.Context, p CallAPIParams, path, fullURL string, body []byte, apiKey string) (string, int, error) {
+	httpClient := http.Client{Timeout: APITimeout}
+	client := httptrace.WrapClient(&httpClient)
+
+	policy := APIRetryPolicy
+	if !canRetry(p) {
+		policy.MaxRetries = 0
+	}
+	expBackOff := backoff.NewExponentialBackOff()
+	expBackOff.InitialInterval = policy.InitialInterval
+	expBackOff.MaxInterval = policy.MaxInterval
+
+	// lastErr keeps the error of the latest attempt: when the API asked for a
+	// specific wait, backoff.Retry only sees a *backoff.RetryAfterError.
+	var (
+		lastErr    error
+		lastStatus int
+	)
+	res, err := backoff.Retry(ctx, func() (string, error) {
+		req, err := newRequest(ctx, p, fullURL, body, apiKey)
+		if err != nil {
+			return "", backoff.Permanent(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("execute request: %w", err)
+			return "", lastErr
+		}
+		defer res.Body.Close()
+		lastStatus = res.StatusCode
+		resBody, err := io.ReadAll(res.Body)
+		if res.StatusCode >= 400 {
+			apiErr := newAPIError(p.Method, path, res.StatusCode, resBody)
+			lastErr = apiErr
+			if !apiErr.Retryable {
+				return "", backoff.Permanent(lastErr)
+			}
+			if wait := retryAfter(res.Header, time.Now()); wait > 0 {
+				if wait > policy.MaxInterval {
+					// Waiting that long would stall the tool call; report
+					// the rate limit instead.
+					return "", backoff.Permanent(lastErr)
+				}
+				return "", &backoff.RetryAfterError{Duration: wait}
+			}
+			return "", lastErr
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("read response body: %w", err)
+			return "", lastErr
+		}
+		return string(resBody), nil
+	},
+		backoff.WithBackOff(expBackOff),
+		backoff.WithMaxTries(uint(policy.MaxRetries+1)), //nolint:gosec
+		backoff.WithMaxElapsedTime(policy.MaxElapsedTime),
+	)
+	if err != nil {
+		var retryAfterErr *backoff.RetryAfterError
+		if errors.As(err, &retryAfterErr) && lastErr != nil {
+			return "", lastStatus, lastErr
+		}
+		return "", lastStatus, err
+	}
+	return res, lastStatus, nil
+}
 
+func newRequest(ctx context.Context, p CallAPIParams, fullURL string, body []byte, apiKey string) (*http.Request, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, p.Method, fullURL, reqBody)
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 	if p.Params != nil {
 		q := req.URL.Query()
@@ -78,24 +189,8 @@ func CallAPI(ctx context.Context, p CallAPIParams) (string, error) {
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", apiKey)
-
-	httpClient := http.Client{Timeout: 30 * time.Second}
-	client := httptrace.WrapClient(&httpClient)
-	res, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("execute request: %w", err)
-	}
-	defer res.Body.Close()
-	if res.StatusCode >= 400 {
-		resBody, _ := io.ReadAll(res.Body)
-		return "", fmt.Errorf(
-			"unexpected status code %d; response body: %s",
-			res.StatusCode, resBody,
-		)
-	}
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return "", fmt.Errorf("read response body: %w", err)
+	if p.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", p.IdempotencyKey)
 	}
-	return string(resBody), nil
+	return req, nil
 }
@@ -1,7 +1,9 @@
 package bitrise
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
 	"fmt"
 )
 
@@ -10,6 +12,14 @@ type ctxKey int
 const (
 	keyPAT ctxKey = iota
 	keyEnabledGroups
+	keyEnabledTools
+	keyDisabledTools
+	keySafetyMode
+	keyDryRun
+	keyAPICallObserver
+	keyBaseURLs
+	keyClientCertSubject
+	keyClientIP
 )
 
 func patFromCtx(ctx context.Context) (string, error) {
@@ -25,6 +35,17 @@ func ContextWithPAT(ctx context.Context, s string) context.Context {
 	return context.WithValue(ctx, keyPAT, s)
 }
 
+// PATFingerprint returns a short stable identifier of the PAT in ctx without
+// exposing the token itself, or "" when ctx has no PAT.
+func PATFingerprint(ctx context.Context) string {
+	pat, err := patFromCtx(ctx)
+	if err != nil || pat == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(pat))
+	return fmt.Sprintf("%x", h[:8])
+}
+
 func EnabledGroupsFromCtx(ctx context.Context) ([]string, error) {
 	v := ctx.Value(keyEnabledGroups)
 	u, ok := v.([]string)
@@ -37,3 +58,101 @@ func EnabledGroupsFromCtx(ctx context.Context) ([]string, error) {
 func ContextWithEnabledGroups(ctx context.Context, a []string) context.Context {
 	return context.WithValue(ctx, keyEnabledGroups, a)
 }
+
+func EnabledToolsFromCtx(ctx context.Context) ([]string, error) {
+	v := ctx.Value(keyEnabledTools)
+	u, ok := v.([]string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T", v)
+	}
+	return u, nil
+}
+
+func ContextWithEnabledTools(ctx context.Context, a []string) context.Context {
+	return context.WithValue(ctx, keyEnabledTools, a)
+}
+
+func DisabledToolsFromCtx(ctx context.Context) ([]string, error) {
+	v := ctx.Value(keyDisabledTools)
+	u, ok := v.([]string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T", v)
+	}
+	return u, nil
+}
+
+func ContextWithDisabledTools(ctx context.Context, a []string) context.Context {
+	return context.WithValue(ctx, keyDisabledTools, a)
+}
+
+func SafetyModeFromCtx(ctx context.Context) (string, error) {
+	v := ctx.Value(keySafetyMode)
+	u, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected type %T", v)
+	}
+	return u, nil
+}
+
+func ContextWithSafetyMode(ctx context.Context, s string) context.Context {
+	return context.WithValue(ctx, keySafetyMode, s)
+}
+
+func DryRunFromCtx(ctx context.Context) bool {
+	v, _ := ctx.Value(keyDryRun).(bool)
+	return v
+}
+
+// ContextWithDryRun makes CallAPI return a *DryRunRequest instead of sending
+// requests that may modify data.
+func ContextWithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keyDryRun, true)
+}
+
+// ClientCertSubjectFromCtx returns the subject of the verified TLS client
+// certificate of the request, or "" without mutual TLS.
+func ClientCertSubjectFromCtx(ctx context.Context) string {
+	v, _ := ctx.Value(keyClientCertSubject).(string)
+	return v
+}
+
+func ContextWithClientCertSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, keyClientCertSubject, subject)
+}
+
+// ClientIPFromCtx returns the IP address of the HTTP client, or "" with
+// the stdio transport.
+func ClientIPFromCtx(ctx context.Context) string {
+	v, _ := ctx.Value(keyClientIP).(string)
+	return v
+}
+
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, keyClientIP, ip)
+}
+
+// BaseURLs overrides the Bitrise API base URLs for the calls made with a
+// context. Empty fields keep the package-level defaults.
+type BaseURLs struct {
+	API      string
+	RM       string
+	CodePush string
+}
+
+func ContextWithBaseURLs(ctx context.Context, u BaseURLs) context.Context {
+	return context.WithValue(ctx, keyBaseURLs, u)
+}
+
+// resolveBaseURL returns the base URL of api, overridden by the context's
+// BaseURLs when set.
+func resolveBaseURL(ctx context.Context, api API) string {
+	u, _ := ctx.Value(keyBaseURLs).(BaseURLs)
+	switch api {
+	case APIRM:
+		return cmp.Or(u.RM, APIRMBaseURL)
+	case APICodePush:
+		return cmp.Or(u.CodePush, APICodePushBaseURL)
+	default:
+		return cmp.Or(u.API, APIBaseURL)
+	}
+}
@@ -0,0 +1,32 @@
+package bitrise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveBaseURL(t *testing.T) {
+	// A single gateway serving every API.
+	api, rm, codePush := APIBaseURL, APIRMBaseURL, APICodePushBaseURL
+	APIBaseURL, APIRMBaseURL, APICodePushBaseURL = "https://gateway.example.com", "https://gateway.example.com", "https://gateway.example.com"
+	t.Cleanup(func() { APIBaseURL, APIRMBaseURL, APICodePushBaseURL = api, rm, codePush })
+
+	cases := map[string]struct {
+		urls BaseURLs
+		api  API
+		want string
+	}{
+		"default":              {api: APIRM, want: "https://gateway.example.com"},
+		"main API override":    {urls: BaseURLs{API: "https://api.example.com"}, api: APIMain, want: "https://api.example.com"},
+		"RM override":          {urls: BaseURLs{RM: "https://rm.example.com"}, api: APIRM, want: "https://rm.example.com"},
+		"CodePush override":    {urls: BaseURLs{CodePush: "https://cp.example.com"}, api: APICodePush, want: "https://cp.example.com"},
+		"other API's override": {urls: BaseURLs{RM: "https://rm.example.com"}, api: APIMain, want: "https://gateway.example.com"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := ContextWithBaseURLs(t.Context(), tc.urls)
+			assert.Equal(t, tc.want, resolveBaseURL(ctx, tc.api))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package bitrise
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DryRunRequest describes a request CallAPI would have sent if the context
+// wasn't in dry-run mode. It is returned as an error so handlers stop before
+// acting on a response that doesn't exist.
+type DryRunRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+func (r *DryRunRequest) Error() string {
+	return fmt.Sprintf("dry run: %s %s was not sent", r.Method, r.URL)
+}
+
+func newDryRunRequest(req *http.Request, body []byte) *DryRunRequest {
+	headers := make(map[string]string, len(req.Header))
+	for key := range req.Header {
+		headers[key] = req.Header.Get(key)
+	}
+	if _, ok := headers["Authorization"]; ok {
+		headers["Authorization"] = "[REDACTED]"
+	}
+	return &DryRunRequest{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: headers,
+		Body:    body,
+	}
+}
+
+// isSafeMethod reports whether requests with this method only read data.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package bitrise
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallAPIDryRun(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	ctx := ContextWithDryRun(ContextWithPAT(t.Context(), "secret-pat"))
+
+	t.Run("mutating request is not sent", func(t *testing.T) {
+		calls = 0
+		_, err := CallAPI(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), CallAPIParams{
+			Method: http.MethodPost,
+			Path:   "apps/abc/builds",
+			Params: map[string]any{"x": "1"},
+			Body:   map[string]any{"branch": "main"},
+		})
+		var dryRun *DryRunRequest
+		if assert.True(t, errors.As(err, &dryRun)) {
+			assert.Equal(t, http.MethodPost, dryRun.Method)
+			assert.Equal(t, srv.URL+"/apps/abc/builds?x=1", dryRun.URL)
+			assert.Equal(t, "[REDACTED]", dryRun.Headers["Authorization"])
+			assert.JSONEq(t, `{"branch":"main"}`, string(dryRun.Body))
+		}
+		assert.Equal(t, 0, calls)
+
+		res := NewToolResultErrorFromErr("call api", err)
+		assert.False(t, res.IsError)
+	})
+
+	t.Run("read request is sent", func(t *testing.T) {
+		calls = 0
+		_, err := CallAPI(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), CallAPIParams{Method: http.MethodGet, Path: "/apps"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,168 @@
+package bitrise
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// APIError is returned by CallAPI when the Bitrise API responds with an error
+// status code.
+type APIError struct {
+	StatusCode int
+	// Message is the error message reported by the API, or the raw response
+	// body when it could not be parsed.
+	Message string
+	Method  string
+	// Path is the request path relative to the API base URL.
+	Path string
+	// Retryable is true when the same request may succeed later (rate
+	// limiting, transient server errors).
+	Retryable bool
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status code %d for %s %s: %s", e.StatusCode, e.Method, e.Path, e.Message)
+}
+
+func newAPIError(method, path string, statusCode int, body []byte) *APIError {
+	return &APIError{
+		StatusCode: statusCode,
+		Message:    errorMessage(body),
+		Method:     method,
+		Path:       path,
+		Retryable:  isRetryableStatus(statusCode),
+	}
+}
+
+// errorMessage extracts the human readable message from the error response
+// formats used across the Bitrise APIs, falling back to the raw body.
+func errorMessage(body []byte) string {
+	var res struct {
+		Message  string `json:"message"`
+		ErrorMsg string `json:"error_msg"`
+		Error    any    `json:"error"`
+		Errors   any    `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &res); err == nil {
+		switch {
+		case res.Message != "":
+			return res.Message
+		case res.ErrorMsg != "":
+			return res.ErrorMsg
+		case res.Error != nil:
+			return fmt.Sprint(res.Error)
+		case res.Errors != nil:
+			return fmt.Sprint(res.Errors)
+		}
+	}
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return msg
+	}
+	return "empty response body"
+}
+
+// ToolError is the machine-readable error object returned to the client when
+// a tool fails because of a Bitrise API error.
+type ToolError struct {
+	Kind       string `json:"kind"`
+	StatusCode int    `json:"status_code"`
+	Message    string `json:"message"`
+	Path       string `json:"path"`
+	Retryable  bool   `json:"retryable"`
+	Hint       string `json:"hint"`
+}
+
+// Kind classifies the error so the model can decide how to react without
+// parsing the message.
+func (e *APIError) Kind() string {
+	switch {
+	case e.StatusCode == http.StatusBadRequest, e.StatusCode == http.StatusUnprocessableEntity:
+		return "invalid_input"
+	case e.StatusCode == http.StatusUnauthorized:
+		return "unauthorized"
+	case e.StatusCode == http.StatusForbidden:
+		return "forbidden"
+	case e.StatusCode == http.StatusNotFound:
+		return "not_found"
+	case e.StatusCode == http.StatusConflict:
+		return "conflict"
+	case e.StatusCode == http.StatusTooManyRequests:
+		return "rate_limited"
+	case e.StatusCode >= 500:
+		return "server_error"
+	default:
+		return "request_failed"
+	}
+}
+
+// Hint suggests how the caller can remediate the error.
+func (e *APIError) Hint() string {
+	resource := "resource"
+	switch {
+	case strings.HasPrefix(e.Path, "/apps/"):
+		resource = "app"
+	case strings.HasPrefix(e.Path, "/organizations/") || strings.HasPrefix(e.Path, "/workspaces/"):
+		resource = "workspace"
+	case strings.HasPrefix(e.Path, "/connected-apps/"):
+		resource = "connected app"
+	}
+
+	switch e.Kind() {
+	case "invalid_input":
+		return "The request was rejected as invalid. Check the arguments against the tool's input schema and the error message, then fix them before retrying."
+	case "unauthorized":
+		return "The Bitrise personal access token is missing, invalid or expired. Ask the user to provide a valid token; retrying will not help."
+	case "forbidden":
+		return fmt.Sprintf("The PAT lacks access to this %s. The user may not be a member of the owning workspace or may not have a sufficient role; retrying will not help.", resource)
+	case "not_found":
+		return fmt.Sprintf("The %s does not exist or is not visible to this PAT. Verify the identifiers, for example with the corresponding list tool.", resource)
+	case "conflict":
+		return "The request conflicts with the current state of the resource. Fetch the latest state and try again."
+	case "rate_limited":
+		return "The Bitrise API rate limit was reached. Wait before retrying and avoid issuing many calls in a loop."
+	case "server_error":
+		return "The Bitrise API failed temporarily. Retrying later may succeed."
+	default:
+		return "The request failed. Check the error message for details."
+	}
+}
+
+// ToolError converts the error into its client-facing representation.
+func (e *APIError) ToolError() ToolError {
+	return ToolError{
+		Kind:       e.Kind(),
+		StatusCode: e.StatusCode,
+		Message:    e.Message,
+		Path:       e.Path,
+		Retryable:  e.Retryable,
+		Hint:       e.Hint(),
+	}
+}
+
+// NewToolResultErrorFromErr is like mcp.NewToolResultErrorFromErr, but
+// returns a structured error object with remediation hints when err wraps an
+// *APIError. When err is a *DryRunRequest, the request that would have been
+// sent is returned as a successful result.
+func NewToolResultErrorFromErr(text string, err error) *mcp.CallToolResult {
+	var dryRun *DryRunRequest
+	if errors.As(err, &dryRun) {
+		return mcp.NewToolResultStructuredOnly(map[string]any{
+			"dry_run": true,
+			"message": "The server is in dry-run mode: this request was not sent to Bitrise.",
+			"request": dryRun,
+		})
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return mcp.NewToolResultErrorFromErr(text, err)
+	}
+	structured := map[string]any{"error": apiErr.ToolError()}
+	res := mcp.NewToolResultStructuredOnly(structured)
+	res.IsError = true
+	return res
+}
@@ -0,0 +1,90 @@
+package bitrise
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorMessage(t *testing.T) {
+	cases := map[string]struct {
+		body string
+		want string
+	}{
+		"message field":   {body: `{"message":"Not Found"}`, want: "Not Found"},
+		"error_msg field": {body: `{"error_msg":"app not found"}`, want: "app not found"},
+		"error field":     {body: `{"error":"invalid_token"}`, want: "invalid_token"},
+		"plain text":      {body: "Bad Gateway\n", want: "Bad Gateway"},
+		"empty body":      {body: "", want: "empty response body"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, errorMessage([]byte(tc.body)))
+		})
+	}
+}
+
+func TestAPIErrorToolError(t *testing.T) {
+	cases := map[string]struct {
+		err  *APIError
+		kind string
+		hint string
+	}{
+		"forbidden app": {
+			err:  newAPIError(http.MethodGet, "/apps/abc", http.StatusForbidden, nil),
+			kind: "forbidden",
+			hint: "The PAT lacks access to this app.",
+		},
+		"not found": {
+			err:  newAPIError(http.MethodGet, "/builds", http.StatusNotFound, nil),
+			kind: "not_found",
+			hint: "The resource does not exist",
+		},
+		"invalid input": {
+			err:  newAPIError(http.MethodPost, "/apps/abc/builds", http.StatusUnprocessableEntity, nil),
+			kind: "invalid_input",
+			hint: "rejected as invalid",
+		},
+		"rate limited": {
+			err:  newAPIError(http.MethodGet, "/apps", http.StatusTooManyRequests, nil),
+			kind: "rate_limited",
+			hint: "Wait before retrying",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.err.ToolError()
+			assert.Equal(t, tc.kind, got.Kind)
+			assert.Contains(t, got.Hint, tc.hint)
+		})
+	}
+}
+
+func TestNewToolResultErrorFromErr(t *testing.T) {
+	t.Run("api error is structured", func(t *testing.T) {
+		apiErr := newAPIError(http.MethodDelete, "/apps/abc", http.StatusServiceUnavailable, []byte(`{"message":"down"}`))
+		res := NewToolResultErrorFromErr("call api", fmt.Errorf("wrapped: %w", apiErr))
+		assert.True(t, res.IsError)
+		structured, ok := res.StructuredContent.(map[string]any)
+		if assert.True(t, ok) {
+			assert.Equal(t, ToolError{
+				Kind:       "server_error",
+				StatusCode: http.StatusServiceUnavailable,
+				Message:    "down",
+				Path:       "/apps/abc",
+				Retryable:  true,
+				Hint:       "The Bitrise API failed temporarily. Retrying later may succeed.",
+			}, structured["error"])
+		}
+	})
+
+	t.Run("other errors fall back to text", func(t *testing.T) {
+		res := NewToolResultErrorFromErr("call api", fmt.Errorf("boom"))
+		assert.True(t, res.IsError)
+		assert.Nil(t, res.StructuredContent)
+	})
+}
@@ -0,0 +1,83 @@
+package bitrise
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// APICall describes a Bitrise API call made by CallAPI, including retries.
+type APICall struct {
+	Method string
+	// Path is the request path relative to the base URL, without query.
+	Path string
+	// PathTemplate is Path with identifiers replaced by placeholders, e.g.
+	// "/apps/{app_slug}/builds/{build_slug}", to group calls by endpoint.
+	PathTemplate string
+	// StatusCode is the status of the last response, or 0 if no response
+	// was received.
+	StatusCode int
+	Duration   time.Duration
+}
+
+// ContextWithAPICallObserver makes CallAPI report every call made with the
+// returned context to fn. Observers already registered in ctx keep being
+// notified.
+func ContextWithAPICallObserver(ctx context.Context, fn func(APICall)) context.Context {
+	if parent, ok := ctx.Value(keyAPICallObserver).(func(APICall)); ok {
+		next := fn
+		fn = func(call APICall) {
+			parent(call)
+			next(call)
+		}
+	}
+	return context.WithValue(ctx, keyAPICallObserver, fn)
+}
+
+func notifyAPICall(ctx context.Context, call APICall) {
+	if fn, ok := ctx.Value(keyAPICallObserver).(func(APICall)); ok {
+		fn(call)
+	}
+}
+
+// pathParams maps a collection path segment to the placeholder of the
+// identifier following it.
+var pathParams = map[string]string{ //nolint:gochecknoglobals
+	"apps":                  "{app_slug}",
+	"builds":                "{build_slug}",
+	"artifacts":             "{artifact_slug}",
+	"cache":                 "{cache_item_id}",
+	"cache-items":           "{cache_item_id}",
+	"outgoing-webhooks":     "{webhook_slug}",
+	"pipelines":             "{pipeline_id}",
+	"roles":                 "{role_name}",
+	"organizations":         "{workspace_slug}",
+	"groups":                "{group_slug}",
+	"members":               "{user_slug}",
+	"connected-apps":        "{connected_app_id}",
+	"installable-artifacts": "{installable_artifact_id}",
+	"tester-groups":         "{tester_group_id}",
+	"deployments":           "{deployment_id}",
+	"updates":               "{update_id}",
+}
+
+// pathActions are segments that follow a collection without being an
+// identifier, e.g. "/apps/register".
+var pathActions = map[string]bool{ //nolint:gochecknoglobals
+	"register": true,
+}
+
+// PathTemplate replaces the identifiers in a Bitrise API path with
+// placeholders, so that the path can be used as a low-cardinality label.
+func PathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		param, ok := pathParams[segments[i-1]]
+		if !ok || segments[i] == "" || pathActions[segments[i]] {
+			continue
+		}
+		segments[i] = param
+		i++ // an identifier is never followed by another one
+	}
+	return strings.Join(segments, "/")
+}
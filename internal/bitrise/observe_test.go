@@ -0,0 +1,27 @@
+package bitrise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathTemplate(t *testing.T) {
+	cases := map[string]struct {
+		path string
+		want string
+	}{
+		"collection":                         {path: "/apps", want: "/apps"},
+		"action":                             {path: "/apps/register", want: "/apps/register"},
+		"nested identifiers":                 {path: "/apps/abc/builds/def/artifacts/ghi", want: "/apps/{app_slug}/builds/{build_slug}/artifacts/{artifact_slug}"},
+		"trailing action":                    {path: "/apps/abc/pipelines/def/abort", want: "/apps/{app_slug}/pipelines/{pipeline_id}/abort"},
+		"identifier looks like a collection": {path: "/apps/builds/builds", want: "/apps/{app_slug}/builds"},
+		"release management":                 {path: "/connected-apps/abc/tester-groups/def/notify", want: "/connected-apps/{connected_app_id}/tester-groups/{tester_group_id}/notify"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, PathTemplate(tc.path))
+		})
+	}
+}
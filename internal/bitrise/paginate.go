@@ -0,0 +1,155 @@
+package bitrise
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// DefaultMaxItems is the number of items collected by all_pages when the
+	// caller doesn't set max_items.
+	DefaultMaxItems = 200
+	// MaxItemsLimit is the hard cap on items collected by all_pages,
+	// regardless of max_items, to protect the client's context window.
+	MaxItemsLimit = 1000
+	// maxPages guards against endpoints that keep returning a cursor.
+	maxPages = 100
+)
+
+// Paging describes how a list endpoint paginates its results.
+type Paging int
+
+const (
+	// CursorPaging is used by the v0.1 API: items are under "data" and the
+	// next page is requested with the "next" param taken from "paging.next".
+	CursorPaging Paging = iota
+	// PageNumberPaging is used by the Release Management APIs: items are
+	// under "items" and pages are requested with the "page" param until
+	// "pagination.total_pages" is reached.
+	PageNumberPaging
+)
+
+// WithAllPages adds the all_pages and max_items arguments to a list tool.
+func WithAllPages() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithBoolean("all_pages",
+			mcp.Description("Follow pagination and return the items of all pages in a single response, up to max_items. The response reports whether it was truncated."),
+		)(t)
+		mcp.WithNumber("max_items",
+			mcp.Description(fmt.Sprintf("Maximum number of items to return when all_pages is set, a positive number (default: %d, hard limit: %d)", DefaultMaxItems, MaxItemsLimit)),
+		)(t)
+	}
+}
+
+// CallAPIPaginated calls a list endpoint. When the request sets all_pages,
+// it follows pagination and merges the items of all pages into a single
+// response in the shape of the first page, with an added "truncated" field.
+// Otherwise it behaves like CallAPI.
+func CallAPIPaginated(ctx context.Context, request mcp.CallToolRequest, paging Paging, p CallAPIParams) (string, error) {
+	if !request.GetBool("all_pages", false) {
+		return CallAPI(ctx, p)
+	}
+	maxItems := request.GetInt("max_items", DefaultMaxItems)
+	if maxItems <= 0 {
+		return "", fmt.Errorf("max_items must be a positive number, got %d", maxItems)
+	}
+	maxItems = min(maxItems, MaxItemsLimit)
+	res, err := fetchAllPages(ctx, paging, p, maxItems)
+	if err != nil {
+		return "", err
+	}
+	a, err := json.Marshal(res)
+	if err != nil {
+		return "", fmt.Errorf("marshal merged pages: %w", err)
+	}
+	return string(a), nil
+}
+
+func fetchAllPages(ctx context.Context, paging Paging, p CallAPIParams, maxItems int) (map[string]any, error) {
+	params := maps.Clone(p.Params)
+	if params == nil {
+		params = map[string]any{}
+	}
+	p.Params = params
+
+	itemsKey := "data"
+	if paging == PageNumberPaging {
+		itemsKey = "items"
+	}
+	page := 1
+	if paging == PageNumberPaging {
+		if v, err := strconv.Atoi(fmt.Sprint(params["page"])); err == nil && v > 0 {
+			page = v
+		}
+	} else if limit, err := strconv.Atoi(fmt.Sprint(params["limit"])); err == nil && limit > maxItems {
+		params["limit"] = strconv.Itoa(maxItems)
+	}
+
+	var (
+		response map[string]any
+		items    []any
+		more     bool
+	)
+	for range maxPages {
+		res, err := CallAPI(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		response = nil
+		if err := json.Unmarshal([]byte(res), &response); err != nil {
+			return nil, fmt.Errorf("unmarshal page: %w", err)
+		}
+		pageItems, ok := response[itemsKey].([]any)
+		if !ok {
+			// Not a paginated list response; hand back the page as is.
+			if items == nil {
+				return response, nil
+			}
+			break
+		}
+		items = append(items, pageItems...)
+
+		switch paging {
+		case CursorPaging:
+			pagingInfo, _ := response["paging"].(map[string]any)
+			next, _ := pagingInfo["next"].(string)
+			more = next != ""
+			if more {
+				params["next"] = next
+				// Shrink the last page so the cursor stays exact and no
+				// items are silently skipped.
+				if remaining := maxItems - len(items); remaining > 0 && remaining < len(pageItems) {
+					params["limit"] = strconv.Itoa(remaining)
+				}
+			}
+		case PageNumberPaging:
+			pagination, _ := response["pagination"].(map[string]any)
+			totalPages, ok := pagination["total_pages"].(float64)
+			if ok {
+				more = page < int(totalPages)
+			} else {
+				more = len(pageItems) > 0
+			}
+			page++
+			params["page"] = strconv.Itoa(page)
+		}
+
+		if !more || len(items) >= maxItems {
+			break
+		}
+	}
+
+	truncated := more
+	if len(items) > maxItems {
+		items = items[:maxItems]
+		truncated = true
+	}
+	response[itemsKey] = items
+	response["truncated"] = truncated
+	return response, nil
+}
@@ -0,0 +1,113 @@
+package bitrise
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func allPagesRequest(args map[string]any) mcp.CallToolRequest {
+	var request mcp.CallToolRequest
+	request.Params.Arguments = args
+	return request
+}
+
+func TestCallAPIPaginated(t *testing.T) {
+	ctx := ContextWithPAT(t.Context(), "pat")
+
+	// cursorServer serves total items in pages of up to 3, honouring limit.
+	cursorServer := func(total int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start, _ := strconv.Atoi(r.URL.Query().Get("next"))
+			limit := 3
+			if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v < limit {
+				limit = v
+			}
+			end := min(start+limit, total)
+			var data []map[string]any
+			for i := start; i < end; i++ {
+				data = append(data, map[string]any{"slug": strconv.Itoa(i)})
+			}
+			next := ""
+			if end < total {
+				next = strconv.Itoa(end)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": data, "paging": map[string]any{"next": next}})
+		}))
+	}
+
+	t.Run("without all_pages returns a single page", func(t *testing.T) {
+		srv := cursorServer(7)
+		defer srv.Close()
+
+		res, err := CallAPIPaginated(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), allPagesRequest(nil), CursorPaging, CallAPIParams{Method: http.MethodGet, Path: "/apps"})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"data":[{"slug":"0"},{"slug":"1"},{"slug":"2"}],"paging":{"next":"3"}}`, res)
+	})
+
+	t.Run("rejects non-positive max_items", func(t *testing.T) {
+		srv := cursorServer(7)
+		defer srv.Close()
+
+		_, err := CallAPIPaginated(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), allPagesRequest(map[string]any{"all_pages": true, "max_items": 0}), CursorPaging, CallAPIParams{Method: http.MethodGet, Path: "/apps"})
+		assert.EqualError(t, err, "max_items must be a positive number, got 0")
+	})
+
+	t.Run("follows cursor until the last page", func(t *testing.T) {
+		srv := cursorServer(7)
+		defer srv.Close()
+
+		res, err := CallAPIPaginated(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), allPagesRequest(map[string]any{"all_pages": true}), CursorPaging, CallAPIParams{Method: http.MethodGet, Path: "/apps"})
+		assert.NoError(t, err)
+		var got struct {
+			Data      []any `json:"data"`
+			Truncated bool  `json:"truncated"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(res), &got))
+		assert.Len(t, got.Data, 7)
+		assert.False(t, got.Truncated)
+	})
+
+	t.Run("stops at max_items with an exact cursor", func(t *testing.T) {
+		srv := cursorServer(10)
+		defer srv.Close()
+
+		res, err := CallAPIPaginated(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), allPagesRequest(map[string]any{"all_pages": true, "max_items": 5}), CursorPaging, CallAPIParams{Method: http.MethodGet, Path: "/apps"})
+		assert.NoError(t, err)
+		var got struct {
+			Data      []map[string]any `json:"data"`
+			Paging    map[string]any   `json:"paging"`
+			Truncated bool             `json:"truncated"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(res), &got))
+		assert.Len(t, got.Data, 5)
+		assert.Equal(t, "4", got.Data[4]["slug"])
+		assert.Equal(t, "5", got.Paging["next"])
+		assert.True(t, got.Truncated)
+	})
+
+	t.Run("follows page numbers", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			_, _ = fmt.Fprintf(w, `{"items":[{"page":%d},{"page":%d}],"pagination":{"total_pages":3}}`, page, page)
+		}))
+		defer srv.Close()
+
+		res, err := CallAPIPaginated(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), allPagesRequest(map[string]any{"all_pages": true, "max_items": 5}), PageNumberPaging, CallAPIParams{Method: http.MethodGet, Path: "/connected-apps", Params: map[string]any{"page": "1"}})
+		assert.NoError(t, err)
+		var got struct {
+			Items     []map[string]any `json:"items"`
+			Truncated bool             `json:"truncated"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(res), &got))
+		assert.Len(t, got.Items, 5)
+		assert.InDelta(t, 3, got.Items[4]["page"], 0)
+		assert.True(t, got.Truncated)
+	})
+}
@@ -0,0 +1,277 @@
+package bitrise
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// WithFields adds the fields argument to a tool, letting the caller shrink
+// the response to an allowlist of fields.
+func WithFields() mcp.ToolOption {
+	return mcp.WithArray("fields",
+		mcp.Description(`Only return these fields of each item (or of the returned object). Use dots for nested fields, e.g. ["slug", "status_text", "repository.title"]. Returns all fields when omitted.`),
+		mcp.WithStringItems(),
+	)
+}
+
+// WithWhere adds the where argument to a list tool, letting the caller filter
+// the returned items.
+func WithWhere() mcp.ToolOption {
+	return mcp.WithArray("where",
+		mcp.Description(`Only return items matching all of these conditions. Each condition is "<field><op><value>" where op is one of = != ~ (contains, case-insensitive) !~ > >= < <=, e.g. ["status=2", "triggered_workflow~deploy"]. Use dots for nested fields.`),
+		mcp.WithStringItems(),
+	)
+}
+
+// Predicate is a single condition of the where argument.
+type Predicate struct {
+	Path  []string
+	Op    string
+	Value string
+}
+
+// predicateOps is ordered so that two-character operators are tried before
+// their one-character prefixes.
+var predicateOps = []string{"!=", "!~", ">=", "<=", "=", "~", ">", "<"} //nolint:gochecknoglobals
+
+// ParsePredicate parses a condition like "status=2".
+func ParsePredicate(s string) (Predicate, error) {
+	idx, op := -1, ""
+	for _, candidate := range predicateOps {
+		i := strings.Index(s, candidate)
+		if i < 0 {
+			continue
+		}
+		if idx < 0 || i < idx {
+			idx, op = i, candidate
+		}
+	}
+	if idx <= 0 {
+		return Predicate{}, fmt.Errorf("invalid condition %q: expected <field><op><value>", s)
+	}
+	field := strings.TrimSpace(s[:idx])
+	if field == "" {
+		return Predicate{}, fmt.Errorf("invalid condition %q: missing field", s)
+	}
+	return Predicate{
+		Path:  strings.Split(field, "."),
+		Op:    op,
+		Value: strings.TrimSpace(s[idx+len(op):]),
+	}, nil
+}
+
+// Match reports whether the item satisfies the predicate.
+func (p Predicate) Match(item any) bool {
+	v, ok := lookup(item, p.Path)
+	if !ok {
+		return p.Op == "!=" || p.Op == "!~"
+	}
+	s := scalarString(v)
+	switch p.Op {
+	case "=":
+		return s == p.Value
+	case "!=":
+		return s != p.Value
+	case "~":
+		return strings.Contains(strings.ToLower(s), strings.ToLower(p.Value))
+	case "!~":
+		return !strings.Contains(strings.ToLower(s), strings.ToLower(p.Value))
+	}
+
+	cmp := strings.Compare(s, p.Value)
+	if a, err := strconv.ParseFloat(s, 64); err == nil {
+		if b, err := strconv.ParseFloat(p.Value, 64); err == nil {
+			switch {
+			case a < b:
+				cmp = -1
+			case a > b:
+				cmp = 1
+			default:
+				cmp = 0
+			}
+		}
+	}
+	switch p.Op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Projection narrows a decoded JSON API response to the items matching Where
+// and the fields listed in Fields.
+type Projection struct {
+	Fields [][]string
+	Where  []Predicate
+}
+
+// ProjectionFromRequest reads the fields and where arguments of a tool call.
+func ProjectionFromRequest(request mcp.CallToolRequest) (Projection, error) {
+	var p Projection
+	for _, f := range request.GetStringSlice("fields", nil) {
+		if f = strings.TrimSpace(f); f != "" {
+			p.Fields = append(p.Fields, strings.Split(f, "."))
+		}
+	}
+	for _, w := range request.GetStringSlice("where", nil) {
+		pred, err := ParsePredicate(w)
+		if err != nil {
+			return Projection{}, err
+		}
+		p.Where = append(p.Where, pred)
+	}
+	return p, nil
+}
+
+// Empty reports whether the projection leaves responses unchanged.
+func (p Projection) Empty() bool {
+	return len(p.Fields) == 0 && len(p.Where) == 0
+}
+
+// Apply filters and projects the list under "data" or "items" when the
+// response has one, otherwise the object under "data" or the response itself.
+// Sibling fields such as paging information are kept.
+func (p Projection) Apply(response any) any {
+	if p.Empty() {
+		return response
+	}
+	obj, ok := response.(map[string]any)
+	if !ok {
+		if list, ok := response.([]any); ok {
+			return p.applyList(list)
+		}
+		return response
+	}
+	for _, key := range []string{"data", "items"} {
+		switch v := obj[key].(type) {
+		case []any:
+			obj[key] = p.applyList(v)
+			return obj
+		case map[string]any:
+			obj[key] = p.applyItem(v)
+			return obj
+		}
+	}
+	return p.applyItem(obj)
+}
+
+func (p Projection) applyList(list []any) []any {
+	out := make([]any, 0, len(list))
+	for _, item := range list {
+		if p.matches(item) {
+			out = append(out, p.applyItem(item))
+		}
+	}
+	return out
+}
+
+func (p Projection) matches(item any) bool {
+	for _, pred := range p.Where {
+		if !pred.Match(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p Projection) applyItem(item any) any {
+	if len(p.Fields) == 0 {
+		return item
+	}
+	v, _ := project(item, p.Fields)
+	return v
+}
+
+// ToolResult applies the projection to a raw JSON API response. The response
+// is returned as text when the projection is empty or it isn't valid JSON.
+func (p Projection) ToolResult(res string) *mcp.CallToolResult {
+	if p.Empty() {
+		return mcp.NewToolResultText(res)
+	}
+	var response any
+	if err := json.Unmarshal([]byte(res), &response); err != nil {
+		return mcp.NewToolResultText(res)
+	}
+	return mcp.NewToolResultStructuredOnly(p.Apply(response))
+}
+
+// project keeps only the given paths of v. Arrays are projected element-wise
+// so paths can reach into lists of objects.
+func project(v any, paths [][]string) (any, bool) {
+	for _, path := range paths {
+		if len(path) == 0 {
+			return v, true
+		}
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		groups := map[string][][]string{}
+		var order []string
+		for _, path := range paths {
+			if _, ok := groups[path[0]]; !ok {
+				order = append(order, path[0])
+			}
+			groups[path[0]] = append(groups[path[0]], path[1:])
+		}
+		out := map[string]any{}
+		for _, key := range order {
+			child, ok := t[key]
+			if !ok {
+				continue
+			}
+			if projected, ok := project(child, groups[key]); ok {
+				out[key] = projected
+			}
+		}
+		return out, len(out) > 0
+	case []any:
+		out := make([]any, 0, len(t))
+		for _, elem := range t {
+			if projected, ok := project(elem, paths); ok {
+				out = append(out, projected)
+			}
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+func lookup(v any, path []string) (any, bool) {
+	for _, key := range path {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func scalarString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		a, _ := json.Marshal(t)
+		return string(a)
+	}
+}
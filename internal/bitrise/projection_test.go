@@ -0,0 +1,95 @@
+package bitrise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePredicate(t *testing.T) {
+	cases := map[string]struct {
+		given   string
+		want    Predicate
+		wantErr bool
+	}{
+		"equals":           {given: "status=2", want: Predicate{Path: []string{"status"}, Op: "=", Value: "2"}},
+		"not equals":       {given: "status!=2", want: Predicate{Path: []string{"status"}, Op: "!=", Value: "2"}},
+		"contains":         {given: "triggered_workflow~deploy", want: Predicate{Path: []string{"triggered_workflow"}, Op: "~", Value: "deploy"}},
+		"greater or equal": {given: "build_number >= 10", want: Predicate{Path: []string{"build_number"}, Op: ">=", Value: "10"}},
+		"nested field":     {given: "repository.title=my-app", want: Predicate{Path: []string{"repository", "title"}, Op: "=", Value: "my-app"}},
+		"value with op":    {given: "commit_message~a=b", want: Predicate{Path: []string{"commit_message"}, Op: "~", Value: "a=b"}},
+		"missing op":       {given: "status", wantErr: true},
+		"missing field":    {given: "=2", wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParsePredicate(tc.given)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestProjectionApply(t *testing.T) {
+	newResponse := func() map[string]any {
+		return map[string]any{
+			"data": []any{
+				map[string]any{"slug": "a", "status": float64(1), "triggered_workflow": "primary", "repository": map[string]any{"title": "app", "slug": "x"}},
+				map[string]any{"slug": "b", "status": float64(2), "triggered_workflow": "Deploy-Staging", "repository": map[string]any{"title": "app", "slug": "x"}},
+				map[string]any{"slug": "c", "status": float64(2), "triggered_workflow": "test", "repository": map[string]any{"title": "app", "slug": "x"}},
+			},
+			"paging": map[string]any{"next": "d"},
+		}
+	}
+
+	t.Run("empty projection keeps response", func(t *testing.T) {
+		assert.Equal(t, newResponse(), Projection{}.Apply(newResponse()))
+	})
+
+	t.Run("where filters items and keeps paging", func(t *testing.T) {
+		p := Projection{Where: []Predicate{
+			{Path: []string{"status"}, Op: "=", Value: "2"},
+			{Path: []string{"triggered_workflow"}, Op: "~", Value: "deploy"},
+		}}
+		got := p.Apply(newResponse()).(map[string]any)
+		assert.Len(t, got["data"], 1)
+		assert.Equal(t, map[string]any{"next": "d"}, got["paging"])
+	})
+
+	t.Run("fields project items including nested fields", func(t *testing.T) {
+		p := Projection{Fields: [][]string{{"slug"}, {"repository", "title"}}}
+		got := p.Apply(newResponse()).(map[string]any)
+		assert.Equal(t, map[string]any{"slug": "a", "repository": map[string]any{"title": "app"}}, got["data"].([]any)[0])
+	})
+
+	t.Run("fields project a single object", func(t *testing.T) {
+		p := Projection{Fields: [][]string{{"execution", "workflows", "steps", "title"}}}
+		response := map[string]any{
+			"execution": map[string]any{
+				"workflows": []any{
+					map[string]any{"name": "wf", "steps": []any{map[string]any{"title": "clone", "status": "success"}}},
+				},
+			},
+			"cli_info": "x",
+		}
+		got := p.Apply(response)
+		assert.Equal(t, map[string]any{
+			"execution": map[string]any{
+				"workflows": []any{
+					map[string]any{"steps": []any{map[string]any{"title": "clone"}}},
+				},
+			},
+		}, got)
+	})
+
+	t.Run("numeric comparison", func(t *testing.T) {
+		p := Projection{Where: []Predicate{{Path: []string{"status"}, Op: ">", Value: "1"}}}
+		got := p.Apply(newResponse()).(map[string]any)
+		assert.Len(t, got["data"], 2)
+	})
+}
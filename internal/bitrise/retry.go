@@ -0,0 +1,106 @@
+package bitrise
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how CallAPI retries requests that failed with a
+// transient error (network error, 429 or 5xx).
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt. Zero
+	// disables retries.
+	MaxRetries int
+	// InitialInterval is the base wait before the first retry. Subsequent
+	// waits grow exponentially with jitter.
+	InitialInterval time.Duration
+	// MaxInterval caps a single wait, including waits requested by the API
+	// through Retry-After or X-RateLimit-Reset.
+	MaxInterval time.Duration
+	// MaxElapsedTime bounds the total time spent on a call including all
+	// attempts and waits.
+	MaxElapsedTime time.Duration
+}
+
+// DefaultRetryPolicy is used by CallAPI unless main overrides APIRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{ //nolint:gochecknoglobals
+	MaxRetries:      3,
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     30 * time.Second,
+	MaxElapsedTime:  2 * time.Minute,
+}
+
+// APIRetryPolicy and APITimeout are vars so main can override them via
+// configuration.
+var (
+	APIRetryPolicy = DefaultRetryPolicy //nolint:gochecknoglobals
+	APITimeout     = 30 * time.Second   //nolint:gochecknoglobals
+)
+
+// retryableStatusCodes are responses that indicate a transient condition on
+// the API side; the same request may succeed later.
+var retryableStatusCodes = []int{ //nolint:gochecknoglobals
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+func isRetryableStatus(code int) bool {
+	return slices.Contains(retryableStatusCodes, code)
+}
+
+// isIdempotentMethod reports whether repeating a request with this method
+// has the same effect as sending it once (RFC 9110, section 9.2.2).
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// canRetry reports whether a request may be sent more than once. Non
+// idempotent requests are only retried when the caller supplied an
+// idempotency key so the API can deduplicate them.
+func canRetry(p CallAPIParams) bool {
+	return isIdempotentMethod(p.Method) || p.IdempotencyKey != ""
+}
+
+// retryAfter returns how long the API asked us to wait before retrying, based
+// on the Retry-After header or, when the rate limit is exhausted, the
+// X-RateLimit-Reset header. It returns 0 when the response carries no hint.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return positive(at.Sub(now))
+		}
+	}
+	if h.Get("X-RateLimit-Remaining") != "0" {
+		return 0
+	}
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset <= 0 {
+		return 0
+	}
+	// Bitrise sends a unix timestamp, but tolerate a delta in seconds as
+	// other APIs commonly do.
+	if reset > now.Unix()-24*60*60 {
+		return positive(time.Unix(reset, 0).Sub(now))
+	}
+	return time.Duration(reset) * time.Second
+}
+
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,177 @@
+package bitrise
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		header http.Header
+		want   time.Duration
+	}{
+		"no hints": {
+			header: http.Header{},
+			want:   0,
+		},
+		"retry-after seconds": {
+			header: http.Header{"Retry-After": {"7"}},
+			want:   7 * time.Second,
+		},
+		"retry-after http date": {
+			header: http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}},
+			want:   90 * time.Second,
+		},
+		"rate limit exhausted with unix reset": {
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {strconv.FormatInt(now.Add(12*time.Second).Unix(), 10)},
+			},
+			want: 12 * time.Second,
+		},
+		"rate limit exhausted with delta reset": {
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {"5"},
+			},
+			want: 5 * time.Second,
+		},
+		"rate limit not exhausted": {
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"10"},
+				"X-Ratelimit-Reset":     {strconv.FormatInt(now.Add(12*time.Second).Unix(), 10)},
+			},
+			want: 0,
+		},
+		"reset in the past": {
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)},
+			},
+			want: 0,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, retryAfter(tc.header, now))
+		})
+	}
+}
+
+func TestCallAPIRetry(t *testing.T) {
+	policy := APIRetryPolicy
+	APIRetryPolicy = RetryPolicy{
+		MaxRetries:      2,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+		MaxElapsedTime:  time.Second,
+	}
+	t.Cleanup(func() { APIRetryPolicy = policy })
+
+	ctx := ContextWithPAT(t.Context(), "pat")
+
+	t.Run("retries idempotent request until it succeeds", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		}))
+		defer srv.Close()
+
+		res, err := CallAPI(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), CallAPIParams{Method: http.MethodGet, Path: "/apps"})
+		assert.NoError(t, err)
+		assert.Equal(t, `{"ok":true}`, res)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		_, err := CallAPI(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), CallAPIParams{Method: http.MethodGet, Path: "/apps"})
+		assert.ErrorContains(t, err, "unexpected status code 429 for GET /apps")
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer srv.Close()
+
+		_, err := CallAPI(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), CallAPIParams{Method: http.MethodGet, Path: "/apps/x"})
+		assert.ErrorContains(t, err, "unexpected status code 404 for GET /apps/x")
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("does not retry POST without idempotency key", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		_, err := CallAPI(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), CallAPIParams{Method: http.MethodPost, Path: "/apps", Body: map[string]any{}})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("retries POST with idempotency key and resends body", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			assert.Equal(t, "key-1", r.Header.Get("Idempotency-Key"))
+			var buf [64]byte
+			n, _ := r.Body.Read(buf[:])
+			assert.Equal(t, `{"a":1}`, string(buf[:n]))
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer srv.Close()
+
+		_, err := CallAPI(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), CallAPIParams{
+			Method:         http.MethodPost,
+			Path:           "/apps",
+			Body:           map[string]any{"a": 1},
+			IdempotencyKey: "key-1",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("fails fast when requested wait exceeds max interval", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		_, err := CallAPI(ContextWithBaseURLs(ctx, BaseURLs{API: srv.URL}), CallAPIParams{Method: http.MethodGet, Path: "/apps"})
+		assert.ErrorContains(t, err, "unexpected status code 429 for GET /apps")
+		assert.Equal(t, 1, calls)
+	})
+}
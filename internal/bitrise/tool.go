@@ -10,4 +10,7 @@ type Tool struct {
 	APIGroups  []string
 	Definition mcp.Tool
 	Handler    func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	// LongRunning marks tools that wait for something to happen, e.g. a
+	// build to finish, for up to an hour.
+	LongRunning bool
 }
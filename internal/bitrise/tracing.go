@@ -0,0 +1,54 @@
+package bitrise
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation scope of the OpenTelemetry spans created
+// by the server. Spans are only recorded when main installs a tracer provider.
+const TracerName = "github.com/bitrise-io/bitrise-mcp"
+
+// Tracer returns the OpenTelemetry tracer of the server.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// AppSlugAttribute is the span attribute holding the Bitrise app slug.
+func AppSlugAttribute(appSlug string) attribute.KeyValue {
+	return attribute.String("bitrise.app_slug", appSlug)
+}
+
+// EndSpan records the HTTP status (when non-zero) and the error of an HTTP
+// client span, then ends it.
+func EndSpan(span trace.Span, status int, err error) {
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func startAPISpan(ctx context.Context, method, path string) (context.Context, trace.Span) {
+	template := PathTemplate(path)
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", method),
+		attribute.String("url.template", template),
+	}
+	if strings.HasPrefix(template, "/apps/{app_slug}") {
+		appSlug, _, _ := strings.Cut(strings.TrimPrefix(path, "/apps/"), "/")
+		attrs = append(attrs, AppSlugAttribute(appSlug))
+	}
+	return Tracer().Start(ctx, "bitrise.api "+method+" "+template,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
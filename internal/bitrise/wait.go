@@ -0,0 +1,117 @@
+package bitrise
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const methodNotificationProgress = "notifications/progress"
+
+// WaitPolicy controls how the wait tools poll a build or pipeline.
+type WaitPolicy struct {
+	// InitialInterval is the wait between two polls. It grows while the
+	// progress doesn't change, up to MaxInterval, and is reset when it does.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// DefaultTimeout is how long a tool waits unless the call sets
+	// timeout_seconds. MaxTimeout caps timeout_seconds.
+	DefaultTimeout time.Duration
+	MaxTimeout     time.Duration
+}
+
+// WaitPollPolicy is a var so tests can poll faster.
+var WaitPollPolicy = WaitPolicy{ //nolint:gochecknoglobals
+	InitialInterval: 5 * time.Second,
+	MaxInterval:     time.Minute,
+	DefaultTimeout:  30 * time.Minute,
+	MaxTimeout:      time.Hour,
+}
+
+// WithWaitTimeout adds the timeout_seconds argument to a wait tool.
+func WithWaitTimeout() mcp.ToolOption {
+	return mcp.WithNumber("timeout_seconds",
+		mcp.Description(fmt.Sprintf("How long to wait before returning the current status. Default: %d, max: %d",
+			int(WaitPollPolicy.DefaultTimeout.Seconds()), int(WaitPollPolicy.MaxTimeout.Seconds()))),
+	)
+}
+
+// WaitState is the state of what a wait tool waits for, as seen by a poll.
+type WaitState struct {
+	Finished bool
+	// Progress describes the state in progress notifications, e.g. the
+	// running step.
+	Progress string
+}
+
+// Wait calls poll until it reports the state finished or the timeout of the
+// request passes, and returns whether it finished. After each poll, a
+// progress notification is sent with the elapsed time if the client asked
+// for them. It returns early with the error of a poll or of ctx.
+func Wait(ctx context.Context, request mcp.CallToolRequest, poll func(ctx context.Context) (WaitState, error)) (bool, error) {
+	policy := WaitPollPolicy
+	timeout := time.Duration(request.GetInt("timeout_seconds", 0)) * time.Second
+	if timeout <= 0 {
+		timeout = policy.DefaultTimeout
+	}
+	timeout = min(timeout, policy.MaxTimeout)
+
+	start := time.Now()
+	interval := policy.InitialInterval
+	var progress string
+	for {
+		state, err := poll(ctx)
+		if err != nil {
+			return false, err
+		}
+		elapsed := time.Since(start)
+		notifyProgress(ctx, request, state.Progress, elapsed, timeout)
+		if state.Finished {
+			return true, nil
+		}
+		remaining := timeout - elapsed
+		if remaining <= 0 {
+			return false, nil
+		}
+		if state.Progress != progress {
+			progress = state.Progress
+			interval = policy.InitialInterval
+		} else {
+			interval = min(interval*3/2, policy.MaxInterval)
+		}
+		timer := time.NewTimer(min(interval, remaining))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// notifyProgress sends a progress notification to the client of the tool
+// call, if it sent a progress token.
+func notifyProgress(ctx context.Context, request mcp.CallToolRequest, progress string, elapsed, timeout time.Duration) {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return
+	}
+	s := server.ServerFromContext(ctx)
+	if s == nil {
+		return
+	}
+	message := fmt.Sprintf("%s elapsed", elapsed.Round(time.Second))
+	if progress != "" {
+		message = fmt.Sprintf("%s, %s", progress, message)
+	}
+	// Best effort: the client may be gone, or unable to receive
+	// notifications on a stateless transport.
+	_ = s.SendNotificationToClient(ctx, methodNotificationProgress, map[string]any{
+		"progressToken": request.Params.Meta.ProgressToken,
+		"progress":      elapsed.Seconds(),
+		"total":         timeout.Seconds(),
+		"message":       message,
+	})
+}
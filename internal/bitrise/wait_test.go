@@ -0,0 +1,65 @@
+package bitrise
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWait(t *testing.T) {
+	policy := WaitPollPolicy
+	WaitPollPolicy = WaitPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+		DefaultTimeout:  time.Minute,
+		MaxTimeout:      time.Minute,
+	}
+	t.Cleanup(func() { WaitPollPolicy = policy })
+
+	errAPI := errors.New("api error")
+	cases := map[string]struct {
+		timeoutSeconds int
+		finishAfter    int
+		pollErr        error
+		cancel         bool
+		wantFinished   bool
+		wantPolls      int
+		wantErr        error
+	}{
+		"finished at once":  {finishAfter: 1, wantFinished: true, wantPolls: 1},
+		"finished later":    {finishAfter: 4, wantFinished: true, wantPolls: 4},
+		"timed out":         {timeoutSeconds: 1, finishAfter: -1},
+		"poll error":        {pollErr: errAPI, wantPolls: 1, wantErr: errAPI},
+		"cancelled request": {finishAfter: -1, cancel: true, wantPolls: 1, wantErr: context.Canceled},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			request := mcp.CallToolRequest{}
+			if tc.timeoutSeconds > 0 {
+				request.Params.Arguments = map[string]any{"timeout_seconds": tc.timeoutSeconds}
+			}
+			polls := 0
+			finished, err := Wait(ctx, request, func(context.Context) (WaitState, error) {
+				polls++
+				if tc.cancel {
+					cancel()
+				}
+				return WaitState{Finished: polls == tc.finishAfter, Progress: "in-progress"}, tc.pollErr
+			})
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantFinished, finished)
+			if tc.wantPolls > 0 {
+				assert.Equal(t, tc.wantPolls, polls)
+			} else {
+				// Polled until the timeout, with the interval capped.
+				assert.Greater(t, polls, 100)
+			}
+		})
+	}
+}
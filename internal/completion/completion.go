@@ -0,0 +1,278 @@
+// Package completion completes the arguments of tools, prompts and resource
+// templates with the user's Bitrise data, so models don't have to list apps
+// or read bitrise.yml to learn an unguessable slug or a workflow name.
+// Candidates are fetched by calling tools of the server and cached per PAT.
+package completion
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/ttlcache"
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// MaxValues is the maximum number of values of a completion, set by the
+	// MCP specification.
+	MaxValues = 100
+	// cacheSize bounds the number of cached candidate lists.
+	cacheSize = 1000
+)
+
+// Reference types of completion requests. Tools aren't referenced by the MCP
+// specification, RefTool is accepted for clients completing tool arguments.
+const (
+	RefPrompt   = "ref/prompt"
+	RefResource = "ref/resource"
+	RefTool     = "ref/tool"
+)
+
+// ErrInvalidRef is returned for a reference of an unknown type or without
+// the name or URI of what it references.
+var ErrInvalidRef = errors.New("invalid ref")
+
+// Ref is the prompt, resource template or tool whose argument is completed.
+type Ref struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	URI  string `json:"uri,omitempty"`
+}
+
+// candidate is a possible value of an argument. Label is matched too, e.g.
+// the title of an app completing its slug.
+type candidate struct {
+	Value string
+	Label string
+}
+
+// Completer completes arguments. Call Close to stop the background eviction
+// of its cache.
+type Completer struct {
+	callTool tool.CallFunc
+	ttl      time.Duration
+	cache    *ttlcache.Cache[[]candidate]
+}
+
+// New creates a completer caching candidates for ttl.
+func New(callTool tool.CallFunc, ttl time.Duration) *Completer {
+	return &Completer{
+		callTool: callTool,
+		ttl:      ttl,
+		cache:    ttlcache.New[[]candidate](ttlcache.Options{MaxEntries: cacheSize, EvictionInterval: time.Minute}),
+	}
+}
+
+// Close stops the background eviction of the cache.
+func (c *Completer) Close() {
+	c.cache.Close()
+}
+
+// Complete returns the values of an argument matching what was typed so far,
+// and the total number of matches. arguments are the other arguments the
+// client already resolved, e.g. the app_slug a workflow_id belongs to.
+// Arguments without candidates complete to nothing.
+func (c *Completer) Complete(ctx context.Context, ref Ref, name, value string, arguments map[string]string) ([]string, int, error) {
+	switch ref.Type {
+	case RefPrompt, RefTool:
+		if ref.Name == "" {
+			return nil, 0, fmt.Errorf("%w: missing name", ErrInvalidRef)
+		}
+	case RefResource:
+		if ref.URI == "" {
+			return nil, 0, fmt.Errorf("%w: missing uri", ErrInvalidRef)
+		}
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown type %q", ErrInvalidRef, ref.Type)
+	}
+
+	candidates, err := c.candidates(ctx, ref, name, arguments)
+	if err != nil {
+		return nil, 0, err
+	}
+	values := match(candidates, value)
+	total := len(values)
+	if total > MaxValues {
+		values = values[:MaxValues]
+	}
+	return values, total, nil
+}
+
+func (c *Completer) candidates(ctx context.Context, ref Ref, name string, arguments map[string]string) ([]candidate, error) {
+	appSlug := arguments["app_slug"]
+	switch name {
+	case "app_slug":
+		return c.load(ctx, "apps", c.apps)
+	case "workflow_id", "workflow":
+		return c.bitriseYMLKeys(ctx, appSlug, "workflows")
+	case "pipeline":
+		return c.bitriseYMLKeys(ctx, appSlug, "pipelines")
+	case "pipeline_id":
+		// Elsewhere pipeline_id identifies a pipeline run, not a pipeline of
+		// bitrise.yml.
+		if ref.Type == RefTool && ref.Name == "trigger_bitrise_build" {
+			return c.bitriseYMLKeys(ctx, appSlug, "pipelines")
+		}
+	case "branch":
+		if appSlug != "" {
+			return c.load(ctx, "branches/"+appSlug, func(ctx context.Context) ([]candidate, error) {
+				return c.branches(ctx, appSlug)
+			})
+		}
+	case "stack", "stack_id":
+		workspaceSlug := arguments["workspace_slug"]
+		return c.load(ctx, "stacks/"+workspaceSlug, func(ctx context.Context) ([]candidate, error) {
+			return c.stacks(ctx, workspaceSlug)
+		})
+	}
+	return nil, nil
+}
+
+// load returns candidates cached for the PAT of ctx, loading them if needed.
+func (c *Completer) load(ctx context.Context, key string, fetch func(ctx context.Context) ([]candidate, error)) ([]candidate, error) {
+	candidates, _, err := c.cache.GetOrLoad(ctx, bitrise.PATFingerprint(ctx)+"/"+key, func(ctx context.Context) ([]candidate, time.Duration, error) {
+		candidates, err := fetch(ctx)
+		return candidates, c.ttl, err
+	})
+	return candidates, err
+}
+
+func (c *Completer) bitriseYMLKeys(ctx context.Context, appSlug, section string) ([]candidate, error) {
+	if appSlug == "" {
+		return nil, nil
+	}
+	return c.load(ctx, section+"/"+appSlug, func(ctx context.Context) ([]candidate, error) {
+		text, err := c.call(ctx, "get_bitrise_yml", map[string]any{"app_slug": appSlug})
+		if err != nil {
+			return nil, err
+		}
+		var config map[string]any
+		if err := yaml.Unmarshal([]byte(text), &config); err != nil {
+			return nil, fmt.Errorf("parse bitrise.yml: %w", err)
+		}
+		items, _ := config[section].(map[string]any)
+		var candidates []candidate
+		for id := range items {
+			candidates = append(candidates, candidate{Value: id})
+		}
+		return candidates, nil
+	})
+}
+
+func (c *Completer) apps(ctx context.Context) ([]candidate, error) {
+	text, err := c.call(ctx, "list_apps", map[string]any{"all_pages": true})
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Data []struct {
+			Slug  string `json:"slug"`
+			Title string `json:"title"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(text), &list); err != nil {
+		return nil, fmt.Errorf("unmarshal apps: %w", err)
+	}
+	candidates := make([]candidate, 0, len(list.Data))
+	for _, app := range list.Data {
+		candidates = append(candidates, candidate{Value: app.Slug, Label: app.Title})
+	}
+	return candidates, nil
+}
+
+func (c *Completer) branches(ctx context.Context, appSlug string) ([]candidate, error) {
+	text, err := c.call(ctx, "list_branches", map[string]any{"app_slug": appSlug})
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Data []string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(text), &list); err != nil {
+		return nil, fmt.Errorf("unmarshal branches: %w", err)
+	}
+	candidates := make([]candidate, 0, len(list.Data))
+	for _, branch := range list.Data {
+		candidates = append(candidates, candidate{Value: branch})
+	}
+	return candidates, nil
+}
+
+func (c *Completer) stacks(ctx context.Context, workspaceSlug string) ([]candidate, error) {
+	arguments := map[string]any{}
+	if workspaceSlug != "" {
+		arguments["workspace_slug"] = workspaceSlug
+	}
+	text, err := c.call(ctx, "list_available_stacks", arguments)
+	if err != nil {
+		return nil, err
+	}
+	// Both endpoints return the stacks keyed by their ID:
+	// {"osx-xcode-16.0.x": {"title": "Xcode 16.0.x", "project_types": [...]}}
+	var stacks map[string]struct {
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal([]byte(text), &stacks); err != nil {
+		return nil, fmt.Errorf("unmarshal stacks: %w", err)
+	}
+	candidates := make([]candidate, 0, len(stacks))
+	for id, stack := range stacks {
+		candidates = append(candidates, candidate{Value: id, Label: stack.Title})
+	}
+	return candidates, nil
+}
+
+// call calls a tool and returns the text of its result.
+func (c *Completer) call(ctx context.Context, name string, arguments map[string]any) (string, error) {
+	result, err := c.callTool(ctx, name, arguments)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	text := strings.Join(texts, "\n")
+	if result.IsError {
+		return "", fmt.Errorf("%s: %s", name, text)
+	}
+	return text, nil
+}
+
+// match returns the values of the candidates starting with value, then the
+// ones whose value or label contains it, case-insensitively. Each group is
+// sorted by label and value.
+func match(candidates []candidate, value string) []string {
+	value = strings.ToLower(value)
+	var prefixed, contained []candidate
+	for _, c := range candidates {
+		v, label := strings.ToLower(c.Value), strings.ToLower(c.Label)
+		switch {
+		case strings.HasPrefix(v, value), label != "" && strings.HasPrefix(label, value):
+			prefixed = append(prefixed, c)
+		case strings.Contains(v, value), strings.Contains(label, value):
+			contained = append(contained, c)
+		}
+	}
+	byLabel := func(a, b candidate) int {
+		return cmp.Or(strings.Compare(a.Label, b.Label), strings.Compare(a.Value, b.Value))
+	}
+	slices.SortFunc(prefixed, byLabel)
+	slices.SortFunc(contained, byLabel)
+	values := make([]string, 0, len(prefixed)+len(contained))
+	for _, c := range append(prefixed, contained...) {
+		values = append(values, c.Value)
+	}
+	return values
+}
@@ -0,0 +1,154 @@
+package completion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAvailableStacks is a response of GET /available-stacks.
+const testAvailableStacks = `{
+  "osx-xcode-16.0.x": {"title": "Xcode 16.0.x", "project_types": ["ios", "macos", "flutter", "react-native", "cordova", "ionic", "xamarin", "other"]},
+  "osx-xcode-15.4.x": {"title": "Xcode 15.4.x", "project_types": ["ios", "macos", "flutter", "react-native", "cordova", "ionic", "xamarin", "other"]},
+  "ubuntu-noble-24.04-bitrise-2025-android": {"title": "Ubuntu Noble 24.04 - Bitrise 2025 Edition with Android", "project_types": ["android", "flutter", "react-native", "cordova", "ionic", "xamarin", "other"]}
+}`
+
+// testWorkspaceStacks is a response of GET
+// /organizations/{org_slug}/available-stacks with a custom stack.
+const testWorkspaceStacks = `{
+  "osx-xcode-16.0.x": {"title": "Xcode 16.0.x", "project_types": ["ios", "macos", "other"]},
+  "acme-linux-runner": {"title": "ACME self-hosted Linux runner", "project_types": ["android", "other"]}
+}`
+
+const testBitriseYML = `format_version: "13"
+workflows:
+  primary: {}
+  deploy: {}
+  _setup: {}
+pipelines:
+  release: {}
+`
+
+type fakeTools struct {
+	calls []string
+}
+
+func (f *fakeTools) call(_ context.Context, name string, arguments map[string]any) (*mcp.CallToolResult, error) {
+	f.calls = append(f.calls, name)
+	switch name {
+	case "list_apps":
+		return mcp.NewToolResultText(`{"data":[{"slug":"d8db74e2675d54c4","title":"Mobile App"},{"slug":"8eb495d0f6534eed","title":"Website"},{"slug":"0a1b2c3d4e5f6a7b","title":"Mobile SDK"}]}`), nil
+	case "get_bitrise_yml":
+		if arguments["app_slug"] != "d8db74e2675d54c4" {
+			return mcp.NewToolResultError("app not found"), nil
+		}
+		return mcp.NewToolResultText(testBitriseYML), nil
+	case "list_branches":
+		return mcp.NewToolResultText(`{"data":["main","feature/login","release/1.0"]}`), nil
+	case "list_available_stacks":
+		if arguments["workspace_slug"] == "ws1" {
+			return mcp.NewToolResultText(testWorkspaceStacks), nil
+		}
+		return mcp.NewToolResultText(testAvailableStacks), nil
+	}
+	return nil, fmt.Errorf("unknown tool %s", name)
+}
+
+func TestComplete(t *testing.T) {
+	tools := &fakeTools{}
+	c := New(tools.call, time.Minute)
+	t.Cleanup(c.Close)
+	app := map[string]string{"app_slug": "d8db74e2675d54c4"}
+	triggerRef := Ref{Type: RefTool, Name: "trigger_bitrise_build"}
+	promptRef := Ref{Type: RefPrompt, Name: "speed_up_workflow"}
+
+	cases := map[string]struct {
+		ref        Ref
+		name       string
+		value      string
+		arguments  map[string]string
+		want       []string
+		wantErrStr string
+	}{
+		"app by title":           {ref: promptRef, name: "app_slug", value: "mobile", want: []string{"d8db74e2675d54c4", "0a1b2c3d4e5f6a7b"}},
+		"app by slug":            {ref: promptRef, name: "app_slug", value: "8eb", want: []string{"8eb495d0f6534eed"}},
+		"app by title substring": {ref: promptRef, name: "app_slug", value: "sdk", want: []string{"0a1b2c3d4e5f6a7b"}},
+		"workflows":              {ref: triggerRef, name: "workflow_id", arguments: app, want: []string{"_setup", "deploy", "primary"}},
+		"workflow prefix":        {ref: promptRef, name: "workflow_id", value: "pr", arguments: app, want: []string{"primary"}},
+		"workflow without app":   {ref: promptRef, name: "workflow_id", want: []string{}},
+		"pipelines to trigger":   {ref: triggerRef, name: "pipeline_id", arguments: app, want: []string{"release"}},
+		"pipeline runs":          {ref: Ref{Type: RefResource, URI: "bitrise://apps/{app_slug}/pipelines/{pipeline_id}"}, name: "pipeline_id", arguments: app, want: []string{}},
+		"branches":               {ref: triggerRef, name: "branch", value: "rel", arguments: app, want: []string{"release/1.0"}},
+		"stacks":                 {ref: Ref{Type: RefTool, Name: "finish_bitrise_app"}, name: "stack_id", value: "osx", want: []string{"osx-xcode-15.4.x", "osx-xcode-16.0.x"}},
+		"stack by title":         {ref: Ref{Type: RefTool, Name: "finish_bitrise_app"}, name: "stack_id", value: "xcode 16", want: []string{"osx-xcode-16.0.x"}},
+		"workspace stacks":       {ref: Ref{Type: RefTool, Name: "finish_bitrise_app"}, name: "stack_id", value: "linux", arguments: map[string]string{"workspace_slug": "ws1"}, want: []string{"acme-linux-runner"}},
+		"unknown argument":       {ref: promptRef, name: "build_slug", want: []string{}},
+		"tool error":             {ref: promptRef, name: "workflow_id", arguments: map[string]string{"app_slug": "unknown"}, wantErrStr: "app not found"},
+		"invalid ref":            {ref: Ref{Type: "ref/unknown"}, name: "app_slug", wantErrStr: `invalid ref: unknown type "ref/unknown"`},
+		"missing ref name":       {ref: Ref{Type: RefPrompt}, name: "app_slug", wantErrStr: "invalid ref: missing name"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, total, err := c.Complete(t.Context(), tc.ref, tc.name, tc.value, tc.arguments)
+			if tc.wantErrStr != "" {
+				assert.ErrorContains(t, err, tc.wantErrStr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, len(tc.want), total)
+		})
+	}
+}
+
+func TestCompleteCache(t *testing.T) {
+	tools := &fakeTools{}
+	c := New(tools.call, time.Minute)
+	t.Cleanup(c.Close)
+	ref := Ref{Type: RefPrompt, Name: "diagnose_failed_build"}
+
+	ctx1 := bitrise.ContextWithPAT(t.Context(), "pat1")
+	for _, value := range []string{"", "m", "mo"} {
+		_, _, err := c.Complete(ctx1, ref, "app_slug", value, nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"list_apps"}, tools.calls, "apps are cached")
+
+	_, _, err := c.Complete(bitrise.ContextWithPAT(t.Context(), "pat2"), ref, "app_slug", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"list_apps", "list_apps"}, tools.calls, "per PAT")
+
+	c.cache.EvictExpired()
+	c.ttl = 0
+	tools.calls = nil
+	for range 2 {
+		_, _, err := c.Complete(ctx1, ref, "branch", "", map[string]string{"app_slug": "app1"})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"list_branches", "list_branches"}, tools.calls, "expired candidates are fetched again")
+}
+
+func TestCompleteMaxValues(t *testing.T) {
+	branches := make([]string, 0, MaxValues+20)
+	for i := range MaxValues + 20 {
+		branches = append(branches, fmt.Sprintf("branch-%03d", i))
+	}
+	data, _ := json.Marshal(map[string]any{"data": branches})
+	c := New(func(context.Context, string, map[string]any) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(string(data)), nil
+	}, time.Minute)
+	t.Cleanup(c.Close)
+
+	values, total, err := c.Complete(t.Context(), Ref{Type: RefTool, Name: "trigger_bitrise_build"}, "branch", "branch", map[string]string{"app_slug": "app1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, MaxValues+20, total)
+	assert.Equal(t, branches[:MaxValues], values)
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	calls := r.NewCounterVec("calls_total", "Number of calls.", "tool", "result")
+	duration := r.NewHistogramVec("duration_seconds", "Duration\nof calls.", []float64{0.1, 1}, "tool")
+
+	calls.Inc("list_apps", "success")
+	calls.Add(2, "list_apps", "success")
+	calls.Inc(`say "hi"`, "error")
+	duration.Observe(0.05, "list_apps")
+	duration.Observe(0.5, "list_apps")
+	duration.Observe(3, "list_apps")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP calls_total Number of calls.
+# TYPE calls_total counter
+calls_total{tool="list_apps",result="success"} 3
+calls_total{tool="say \"hi\"",result="error"} 1
+# HELP duration_seconds Duration\nof calls.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{tool="list_apps",le="0.1"} 1
+duration_seconds_bucket{tool="list_apps",le="1"} 2
+duration_seconds_bucket{tool="list_apps",le="+Inf"} 3
+duration_seconds_sum{tool="list_apps"} 3.55
+duration_seconds_count{tool="list_apps"} 3
+`, rec.Body.String())
+	assert.Equal(t, float64(3), calls.Value("list_apps", "success"))
+	assert.Equal(t, uint64(3), duration.Count("list_apps"))
+}
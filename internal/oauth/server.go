@@ -0,0 +1,540 @@
+// Package oauth implements a minimal OAuth 2.1 authorization server following
+// the MCP authorization profile. Users authorize a client by pasting a
+// Bitrise PAT, the client then gets opaque tokens standing for that PAT.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// AccessTokenPrefix marks the access tokens issued by the server, which
+	// tells them apart from PATs and JWTs.
+	AccessTokenPrefix  = "bmcp_at_"
+	refreshTokenPrefix = "bmcp_rt_"
+
+	codeTTL = 5 * time.Minute
+
+	MetadataPath  = "/.well-known/oauth-authorization-server"
+	AuthorizePath = "/oauth/authorize"
+	TokenPath     = "/oauth/token"
+	RegisterPath  = "/oauth/register"
+
+	maxRedirectURIs = 10
+	maxClientName   = 200
+
+	// registrationInterval and registrationBurst limit the client
+	// registrations of each IP address to a burst of 10, then one every 6
+	// minutes.
+	registrationInterval = 6 * time.Minute
+	registrationBurst    = 10
+)
+
+// Server serves the authorization server endpoints.
+type Server struct {
+	// Issuer is the public base URL of the server. Derived from each
+	// request when empty.
+	Issuer          string
+	Store           Store
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// ValidatePAT checks a PAT pasted by the user before it's granted, e.g.
+	// by calling the Bitrise API. Optional.
+	ValidatePAT func(ctx context.Context, pat string) error
+
+	now           func() time.Time
+	registrations registrationLimiter
+}
+
+// Register adds the endpoints of the server to mux.
+func (s *Server) Register(mux interface {
+	HandleFunc(string, func(http.ResponseWriter, *http.Request))
+}) {
+	mux.HandleFunc(MetadataPath, s.metadata)
+	mux.HandleFunc(RegisterPath, s.register)
+	mux.HandleFunc(AuthorizePath, s.authorize)
+	mux.HandleFunc(TokenPath, s.token)
+}
+
+// IssuerURL returns the issuer of the server for a request.
+func (s *Server) IssuerURL(r *http.Request) string {
+	if s.Issuer != "" {
+		return strings.TrimRight(s.Issuer, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// PAT returns the PAT an access token stands for, or ErrNotFound when the
+// token is unknown or expired.
+func (s *Server) PAT(ctx context.Context, accessToken string) (string, error) {
+	grant, err := s.Store.Grant(ctx, accessKey(accessToken))
+	if err != nil {
+		return "", err
+	}
+	return grant.PAT, nil
+}
+
+func (s *Server) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// metadata serves RFC 8414 Authorization Server Metadata.
+func (s *Server) metadata(w http.ResponseWriter, r *http.Request) {
+	issuer := s.IssuerURL(r)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + AuthorizePath,
+		"token_endpoint":                        issuer + TokenPath,
+		"registration_endpoint":                 issuer + RegisterPath,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"none"},
+	})
+}
+
+// register implements RFC 7591 Dynamic Client Registration for public
+// clients.
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if !s.registrations.allow(ip, s.clock()) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(registrationInterval.Seconds())))
+		writeError(w, http.StatusTooManyRequests, "temporarily_unavailable", "too many client registrations, try again later")
+		return
+	}
+	var req struct {
+		RedirectURIs []string `json:"redirect_uris"`
+		ClientName   string   `json:"client_name"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_client_metadata", "invalid JSON body")
+		return
+	}
+	if len(req.RedirectURIs) == 0 || len(req.RedirectURIs) > maxRedirectURIs {
+		writeError(w, http.StatusBadRequest, "invalid_redirect_uri", fmt.Sprintf("between 1 and %d redirect_uris are required", maxRedirectURIs))
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+			return
+		}
+	}
+	if len(req.ClientName) > maxClientName {
+		req.ClientName = req.ClientName[:maxClientName]
+	}
+
+	client := Client{
+		ID:           randomToken(""),
+		Name:         req.ClientName,
+		RedirectURIs: req.RedirectURIs,
+		CreatedAt:    s.clock(),
+	}
+	err := s.Store.SaveClient(r.Context(), client)
+	if errors.Is(err, ErrTooManyClients) {
+		writeError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "too many registered clients, try again later")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "could not save the client")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"client_id":                  client.ID,
+		"client_id_issued_at":        client.CreatedAt.Unix(),
+		"client_name":                client.Name,
+		"redirect_uris":              client.RedirectURIs,
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+	})
+}
+
+// validateRedirectURI accepts https URLs, http URLs on the loopback
+// interface and private-use schemes of native apps (e.g. cursor://).
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("invalid redirect URI %q", uri)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect URI %q must not have a fragment", uri)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+		return fmt.Errorf("redirect URI %q must use https unless it's on localhost", uri)
+	case "javascript", "data", "file":
+		return fmt.Errorf("redirect URI %q has a forbidden scheme", uri)
+	}
+	return nil
+}
+
+// authorizeRequest holds the parameters of an authorization request, which
+// the consent form posts back.
+type authorizeRequest struct {
+	client        Client
+	RedirectURI   string
+	State         string
+	Scope         string
+	Resource      string
+	CodeChallenge string
+}
+
+// authorize shows the consent form on GET and issues an authorization code
+// for the pasted PAT on POST.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Errors are only redirected to the client once its redirect URI is
+	// known to be registered.
+	client, err := s.Store.Client(r.Context(), r.Form.Get("client_id"))
+	if err != nil {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	req := authorizeRequest{
+		client:        client,
+		RedirectURI:   r.Form.Get("redirect_uri"),
+		State:         r.Form.Get("state"),
+		Scope:         r.Form.Get("scope"),
+		Resource:      r.Form.Get("resource"),
+		CodeChallenge: r.Form.Get("code_challenge"),
+	}
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		http.Error(w, "redirect_uri is not registered for the client", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("response_type") != "code" {
+		redirectError(w, r, req, "unsupported_response_type", "response_type must be code")
+		return
+	}
+	if req.CodeChallenge == "" || r.Form.Get("code_challenge_method") != "S256" {
+		redirectError(w, r, req, "invalid_request", "PKCE with code_challenge_method S256 is required")
+		return
+	}
+	if req.Resource != "" && !s.isResource(r, req.Resource) {
+		redirectError(w, r, req, "invalid_target", "resource must be this server")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		s.renderConsent(w, req, "")
+		return
+	}
+	if r.Form.Get("action") != "approve" {
+		redirectError(w, r, req, "access_denied", "the user denied the request")
+		return
+	}
+	pat := strings.TrimSpace(r.Form.Get("pat"))
+	if pat == "" {
+		s.renderConsent(w, req, "Paste a Bitrise personal access token.")
+		return
+	}
+	if s.ValidatePAT != nil {
+		if err := s.ValidatePAT(r.Context(), pat); err != nil {
+			s.renderConsent(w, req, "The token was rejected by Bitrise: "+err.Error())
+			return
+		}
+	}
+
+	code := randomToken("")
+	err = s.Store.SaveGrant(r.Context(), codeKey(code), Grant{
+		ClientID:      client.ID,
+		PAT:           pat,
+		Scope:         req.Scope,
+		Resource:      req.Resource,
+		Expires:       s.clock().Add(codeTTL),
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+	})
+	if err != nil {
+		redirectError(w, r, req, "server_error", "could not save the authorization")
+		return
+	}
+	redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// isResource reports whether an RFC 8707 resource indicator names this
+// server: a URL with the scheme and host of the issuer.
+func (s *Server) isResource(r *http.Request, resource string) bool {
+	u, err := url.Parse(resource)
+	if err != nil || u.Fragment != "" {
+		return false
+	}
+	return u.Scheme+"://"+u.Host == s.IssuerURL(r)
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code, description string) {
+	redirect(w, r, req, url.Values{"error": {code}, "error_description": {description}})
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	u, _ := url.Parse(req.RedirectURI) // validated at registration
+	q := u.Query()
+	for key, values := range params {
+		q[key] = values
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// token implements the authorization_code (with PKCE) and refresh_token
+// grants.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+
+	var grant Grant
+	var err error
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "authorization_code":
+		grant, err = s.Store.TakeGrant(r.Context(), codeKey(r.PostForm.Get("code")))
+		// OAuth 2.1 relies on PKCE, redirect_uri only has to match when sent.
+		redirectURI := r.PostForm.Get("redirect_uri")
+		if err != nil || grant.ClientID != clientID || (redirectURI != "" && redirectURI != grant.RedirectURI) ||
+			!verifyPKCE(r.PostForm.Get("code_verifier"), grant.CodeChallenge) {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code, redirect_uri or code_verifier")
+			return
+		}
+	case "refresh_token":
+		grant, err = s.Store.TakeGrant(r.Context(), refreshKey(r.PostForm.Get("refresh_token")))
+		if err != nil || grant.ClientID != clientID {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("unsupported grant_type %q", grantType))
+		return
+	}
+	grant.RedirectURI, grant.CodeChallenge = "", ""
+
+	// Refresh tokens are rotated, as OAuth 2.1 requires for public clients.
+	now := s.clock()
+	accessToken, refreshToken := randomToken(AccessTokenPrefix), randomToken(refreshTokenPrefix)
+	access, refresh := grant, grant
+	access.Expires = now.Add(s.AccessTokenTTL)
+	refresh.Expires = now.Add(s.RefreshTokenTTL)
+	if err := s.Store.SaveGrant(r.Context(), accessKey(accessToken), access); err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "could not save the token")
+		return
+	}
+	if err := s.Store.SaveGrant(r.Context(), refreshKey(refreshToken), refresh); err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "could not save the token")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	response := map[string]any{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(s.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+	}
+	if grant.Scope != "" {
+		response["scope"] = grant.Scope
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	if verifier == "" || challenge == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func randomToken(prefix string) string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b) // never fails
+	return prefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+func codeKey(code string) string {
+	return "code:" + hash(code)
+}
+
+// Access and refresh tokens have their own key namespaces, so neither can be
+// used as the other.
+func accessKey(token string) string {
+	return "access:" + hash(token)
+}
+
+func refreshKey(token string) string {
+	return "refresh:" + hash(token)
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func (s *Server) renderConsent(w http.ResponseWriter, req authorizeRequest, message string) {
+	name := req.client.Name
+	if name == "" {
+		name = "An MCP client"
+	}
+	redirectHost := req.RedirectURI
+	if u, err := url.Parse(req.RedirectURI); err == nil && u.Host != "" {
+		redirectHost = u.Host
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The page takes a secret, it must not be framed by another site.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_ = consentPage.Execute(w, map[string]any{
+		"ClientName":   name,
+		"ClientID":     req.client.ID,
+		"RedirectHost": redirectHost,
+		"Request":      req,
+		"Message":      message,
+	})
+}
+
+//nolint:gochecknoglobals
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize access to Bitrise</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 32rem; margin: 4rem auto; padding: 0 1rem; color: #2b0e3f; }
+input[type=password] { width: 100%; padding: .5rem; box-sizing: border-box; }
+button { padding: .5rem 1rem; margin-top: 1rem; margin-right: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Authorize access to Bitrise</h1>
+<p><strong>{{.ClientName}}</strong> wants to use the Bitrise MCP server on your behalf. After you approve, you will be sent back to <strong>{{.RedirectHost}}</strong>.</p>
+<p>Paste a Bitrise personal access token. You can create one on the <a href="https://app.bitrise.io/me/account/security" target="_blank" rel="noopener">Security page of your Bitrise profile</a>. The client gets its own token standing for it, not the personal access token itself.</p>
+{{if .Message}}<p class="error">{{.Message}}</p>{{end}}
+<form method="post">
+<input type="hidden" name="client_id" value="{{.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="resource" value="{{.Request.Resource}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="S256">
+<input type="hidden" name="response_type" value="code">
+<label for="pat">Personal access token</label>
+<input type="password" id="pat" name="pat" autocomplete="off" autofocus>
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// IsAccessToken reports whether a bearer token was issued by the server.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// registrationLimiter limits the client registrations of each IP address.
+// The zero value is ready to use.
+type registrationLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	swept    time.Time
+}
+
+func (l *registrationLimiter) allow(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limiters == nil {
+		l.limiters = map[string]*rate.Limiter{}
+	}
+	// A limiter that refilled its burst is the same as a new one.
+	if now.Sub(l.swept) >= registrationInterval*registrationBurst {
+		for key, limiter := range l.limiters {
+			if limiter.TokensAt(now) >= registrationBurst {
+				delete(l.limiters, key)
+			}
+		}
+		l.swept = now
+	}
+	limiter, ok := l.limiters[ip]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(registrationInterval), registrationBurst)
+		l.limiters[ip] = limiter
+	}
+	return limiter.AllowN(now, 1)
+}
@@ -0,0 +1,292 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	s := &Server{
+		Store:           NewMemoryStore(),
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 24 * time.Hour,
+		ValidatePAT: func(_ context.Context, pat string) error {
+			if pat == "bad-pat" {
+				return errors.New("401 Unauthorized")
+			}
+			return nil
+		},
+	}
+	mux := http.NewServeMux()
+	s.Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func noRedirectClient() *http.Client {
+	return &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+}
+
+func registerClient(t *testing.T, srv *httptest.Server, redirectURIs ...string) (string, int) {
+	body, _ := json.Marshal(map[string]any{"client_name": "Test client", "redirect_uris": redirectURIs})
+	res, err := http.Post(srv.URL+RegisterPath, "application/json", strings.NewReader(string(body)))
+	if !assert.NoError(t, err) {
+		return "", 0
+	}
+	defer res.Body.Close()
+	var client struct {
+		ClientID string `json:"client_id"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&client)
+	return client.ClientID, res.StatusCode
+}
+
+func pkce(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestMetadata(t *testing.T) {
+	_, srv := newTestServer(t)
+	res, err := http.Get(srv.URL + MetadataPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+	var metadata map[string]any
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&metadata))
+	assert.Equal(t, srv.URL, metadata["issuer"])
+	assert.Equal(t, srv.URL+TokenPath, metadata["token_endpoint"])
+	assert.Equal(t, srv.URL+RegisterPath, metadata["registration_endpoint"])
+	assert.Equal(t, []any{"S256"}, metadata["code_challenge_methods_supported"])
+}
+
+func TestRegister(t *testing.T) {
+	_, srv := newTestServer(t)
+	cases := map[string]struct {
+		redirectURIs []string
+		wantStatus   int
+	}{
+		"https":             {redirectURIs: []string{"https://claude.ai/api/mcp/auth_callback"}, wantStatus: http.StatusCreated},
+		"loopback http":     {redirectURIs: []string{"http://127.0.0.1:33418/callback", "http://localhost:8080/cb"}, wantStatus: http.StatusCreated},
+		"native app scheme": {redirectURIs: []string{"cursor://anysphere.cursor-retrieval/oauth/callback"}, wantStatus: http.StatusCreated},
+		"no redirect URIs":  {wantStatus: http.StatusBadRequest},
+		"remote http":       {redirectURIs: []string{"http://example.com/cb"}, wantStatus: http.StatusBadRequest},
+		"fragment":          {redirectURIs: []string{"https://example.com/cb#frag"}, wantStatus: http.StatusBadRequest},
+		"javascript":        {redirectURIs: []string{"javascript:alert(1)"}, wantStatus: http.StatusBadRequest},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			clientID, status := registerClient(t, srv, tc.redirectURIs...)
+			assert.Equal(t, tc.wantStatus, status)
+			if tc.wantStatus == http.StatusCreated {
+				assert.NotEmpty(t, clientID)
+			}
+		})
+	}
+}
+
+func TestRegisterLimits(t *testing.T) {
+	s, srv := newTestServer(t)
+	for range registrationBurst {
+		_, status := registerClient(t, srv, "https://client.example.com/callback")
+		assert.Equal(t, http.StatusCreated, status)
+	}
+	_, status := registerClient(t, srv, "https://client.example.com/callback")
+	assert.Equal(t, http.StatusTooManyRequests, status, "registrations are rate limited per IP address")
+
+	s.registrations = registrationLimiter{}
+	s.Store.(*MemoryStore).maxClients = registrationBurst + 1
+	_, status = registerClient(t, srv, "https://client.example.com/callback")
+	assert.Equal(t, http.StatusCreated, status)
+	_, status = registerClient(t, srv, "https://client.example.com/callback")
+	assert.Equal(t, http.StatusServiceUnavailable, status, "the number of clients is capped")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	s, srv := newTestServer(t)
+	redirectURI := "http://127.0.0.1:9999/callback"
+	clientID, _ := registerClient(t, srv, redirectURI)
+	verifier := "a-very-long-code-verifier-with-enough-entropy-1234567890"
+	authorizeParams := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURI},
+		"state":                 {"xyz"},
+		"resource":              {srv.URL + "/mcp"},
+		"code_challenge":        {pkce(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	// The consent page is shown.
+	res, err := http.Get(srv.URL + AuthorizePath + "?" + authorizeParams.Encode())
+	if !assert.NoError(t, err) {
+		return
+	}
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "DENY", res.Header.Get("X-Frame-Options"))
+
+	approve := func(pat string) *http.Response {
+		form := url.Values{"action": {"approve"}, "pat": {pat}}
+		for key, values := range authorizeParams {
+			form[key] = values
+		}
+		res, err := noRedirectClient().PostForm(srv.URL+AuthorizePath, form)
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	// A PAT rejected by Bitrise shows the form again.
+	res = approve("bad-pat")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = approve("my-pat")
+	if !assert.Equal(t, http.StatusFound, res.StatusCode) {
+		return
+	}
+	location, _ := url.Parse(res.Header.Get("Location"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	assert.NotEmpty(t, code)
+
+	exchange := func(form url.Values) (int, map[string]any) {
+		res, err := http.PostForm(srv.URL+TokenPath, form)
+		if !assert.NoError(t, err) {
+			return 0, nil
+		}
+		defer res.Body.Close()
+		var body map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&body)
+		return res.StatusCode, body
+	}
+	codeForm := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+
+	// A wrong verifier fails and burns the code.
+	wrongVerifier := url.Values{}
+	for key, values := range codeForm {
+		wrongVerifier[key] = values
+	}
+	wrongVerifier.Set("code_verifier", "wrong")
+	status, body := exchange(wrongVerifier)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+	status, _ = exchange(codeForm)
+	assert.Equal(t, http.StatusBadRequest, status, "codes are single use")
+
+	// A fresh code is exchanged for tokens.
+	res = approve("my-pat")
+	location, _ = url.Parse(res.Header.Get("Location"))
+	codeForm.Set("code", location.Query().Get("code"))
+	status, body = exchange(codeForm)
+	if !assert.Equal(t, http.StatusOK, status) {
+		return
+	}
+	accessToken, _ := body["access_token"].(string)
+	refreshToken, _ := body["refresh_token"].(string)
+	assert.True(t, IsAccessToken(accessToken))
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.InDelta(t, 3600, body["expires_in"], 0)
+
+	pat, err := s.PAT(t.Context(), accessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-pat", pat)
+	_, err = s.PAT(t.Context(), AccessTokenPrefix+"unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Neither kind of token can be used as the other.
+	_, err = s.PAT(t.Context(), refreshToken)
+	assert.ErrorIs(t, err, ErrNotFound)
+	status, body = exchange(url.Values{"grant_type": {"refresh_token"}, "client_id": {clientID}, "refresh_token": {accessToken}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+	pat, err = s.PAT(t.Context(), accessToken)
+	assert.NoError(t, err, "the access token isn't consumed")
+	assert.Equal(t, "my-pat", pat)
+
+	// Refresh tokens are rotated.
+	refreshForm := url.Values{"grant_type": {"refresh_token"}, "client_id": {clientID}, "refresh_token": {refreshToken}}
+	status, body = exchange(refreshForm)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, refreshToken, body["refresh_token"])
+	pat, err = s.PAT(t.Context(), body["access_token"].(string)) //nolint:forcetypeassert
+	assert.NoError(t, err)
+	assert.Equal(t, "my-pat", pat)
+	status, _ = exchange(refreshForm)
+	assert.Equal(t, http.StatusBadRequest, status, "refresh tokens are single use")
+}
+
+func TestAuthorizeErrors(t *testing.T) {
+	_, srv := newTestServer(t)
+	redirectURI := "https://client.example.com/callback"
+	clientID, _ := registerClient(t, srv, redirectURI)
+
+	cases := map[string]struct {
+		params        url.Values
+		wantStatus    int
+		wantErrorCode string
+	}{
+		"unknown client": {
+			params:     url.Values{"client_id": {"nope"}, "redirect_uri": {redirectURI}},
+			wantStatus: http.StatusBadRequest,
+		},
+		"unregistered redirect URI": {
+			params:     url.Values{"client_id": {clientID}, "redirect_uri": {"https://evil.example.com/cb"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		"missing PKCE": {
+			params:        url.Values{"client_id": {clientID}, "redirect_uri": {redirectURI}, "response_type": {"code"}},
+			wantStatus:    http.StatusFound,
+			wantErrorCode: "invalid_request",
+		},
+		"plain PKCE": {
+			params:        url.Values{"client_id": {clientID}, "response_type": {"code"}, "code_challenge": {"abc"}, "code_challenge_method": {"plain"}},
+			wantStatus:    http.StatusFound,
+			wantErrorCode: "invalid_request",
+		},
+		"other resource": {
+			params:        url.Values{"client_id": {clientID}, "response_type": {"code"}, "code_challenge": {"abc"}, "code_challenge_method": {"S256"}, "resource": {"https://other.example.com/mcp"}},
+			wantStatus:    http.StatusFound,
+			wantErrorCode: "invalid_target",
+		},
+		"denied": {
+			params:        url.Values{"client_id": {clientID}, "response_type": {"code"}, "code_challenge": {"abc"}, "code_challenge_method": {"S256"}, "action": {"deny"}},
+			wantStatus:    http.StatusFound,
+			wantErrorCode: "access_denied",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			res, err := noRedirectClient().PostForm(srv.URL+AuthorizePath, tc.params)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res.Body.Close()
+			assert.Equal(t, tc.wantStatus, res.StatusCode)
+			if tc.wantErrorCode != "" {
+				location, _ := url.Parse(res.Header.Get("Location"))
+				assert.Equal(t, "client.example.com", location.Host)
+				assert.Equal(t, tc.wantErrorCode, location.Query().Get("error"))
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxClients caps the registered clients, registration needs no
+	// credentials.
+	maxClients = 10000
+	// unauthorizedClientTTL is how long a client is kept if it never got a
+	// grant.
+	unauthorizedClientTTL = 24 * time.Hour
+)
+
+var (
+	// ErrNotFound is returned for unknown clients and unknown or expired
+	// grants.
+	ErrNotFound = errors.New("not found")
+	// ErrTooManyClients is returned when registering a client while the
+	// store is full.
+	ErrTooManyClients = errors.New("too many clients")
+)
+
+// Client is a dynamically registered OAuth client (RFC 7591). All clients are
+// public clients authenticating with PKCE.
+type Client struct {
+	ID           string    `json:"client_id"`
+	Name         string    `json:"client_name,omitempty"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Authorized is set once the client got a grant. Clients that never do
+	// expire after a day.
+	Authorized bool `json:"authorized,omitempty"`
+}
+
+// Grant is what an authorization code, access token or refresh token stands
+// for: a Bitrise PAT given to a client.
+type Grant struct {
+	ClientID string    `json:"client_id"`
+	PAT      string    `json:"pat"`
+	Scope    string    `json:"scope,omitempty"`
+	Resource string    `json:"resource,omitempty"`
+	Expires  time.Time `json:"expires"`
+	// RedirectURI and CodeChallenge are only set for authorization codes.
+	RedirectURI   string `json:"redirect_uri,omitempty"`
+	CodeChallenge string `json:"code_challenge,omitempty"`
+}
+
+// Store persists clients and grants. Grants are stored under keys derived
+// from a hash of the code or token, never the code or token itself.
+type Store interface {
+	// SaveClient returns ErrTooManyClients when the store is full.
+	SaveClient(ctx context.Context, client Client) error
+	Client(ctx context.Context, id string) (Client, error)
+	SaveGrant(ctx context.Context, key string, grant Grant) error
+	Grant(ctx context.Context, key string) (Grant, error)
+	// TakeGrant returns and deletes a grant, for the single use of codes and
+	// refresh tokens.
+	TakeGrant(ctx context.Context, key string) (Grant, error)
+}
+
+// NewStore creates a store from its spec: "memory", or "file:<path>".
+func NewStore(spec string) (Store, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return NewMemoryStore(), nil
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileStore(strings.TrimPrefix(spec, "file:"))
+	}
+	return nil, fmt.Errorf("invalid OAuth store %q: use memory or file:<path>", spec)
+}
+
+// MemoryStore keeps clients and grants in memory, they are lost on restart.
+type MemoryStore struct {
+	now        func() time.Time
+	maxClients int
+
+	mu      sync.Mutex
+	clients map[string]Client
+	grants  map[string]Grant
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now, maxClients: maxClients, clients: map[string]Client{}, grants: map[string]Grant{}}
+}
+
+func (s *MemoryStore) SaveClient(_ context.Context, client Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	if _, ok := s.clients[client.ID]; !ok && len(s.clients) >= s.maxClients {
+		return ErrTooManyClients
+	}
+	s.clients[client.ID] = client
+	return nil
+}
+
+func (s *MemoryStore) Client(_ context.Context, id string) (Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.clients[id]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (s *MemoryStore) SaveGrant(_ context.Context, key string, grant Grant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.grants[key] = grant
+	if client, ok := s.clients[grant.ClientID]; ok && !client.Authorized {
+		client.Authorized = true
+		s.clients[grant.ClientID] = client
+	}
+	return nil
+}
+
+func (s *MemoryStore) Grant(_ context.Context, key string) (Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.grant(key, false)
+}
+
+func (s *MemoryStore) TakeGrant(_ context.Context, key string) (Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.grant(key, true)
+}
+
+func (s *MemoryStore) grant(key string, take bool) (Grant, error) {
+	grant, ok := s.grants[key]
+	if !ok {
+		return Grant{}, ErrNotFound
+	}
+	if take || !s.now().Before(grant.Expires) {
+		delete(s.grants, key)
+	}
+	if !s.now().Before(grant.Expires) {
+		return Grant{}, ErrNotFound
+	}
+	return grant, nil
+}
+
+// sweep drops expired grants and the clients that never got one, at most
+// once a minute. Must be called with s.mu held.
+func (s *MemoryStore) sweep() {
+	now := s.now()
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	for key, grant := range s.grants {
+		if !now.Before(grant.Expires) {
+			delete(s.grants, key)
+		}
+	}
+	for id, client := range s.clients {
+		if !client.Authorized && now.Sub(client.CreatedAt) >= unauthorizedClientTTL {
+			delete(s.clients, id)
+		}
+	}
+	s.swept = now
+}
+
+// FileStore is a MemoryStore written to a JSON file after every change, so
+// clients and tokens survive restarts. The file holds PATs and is created
+// with 0600 permissions.
+type FileStore struct {
+	*MemoryStore
+	path string
+	// mu serializes writes of the file.
+	mu sync.Mutex
+}
+
+type fileState struct {
+	Clients map[string]Client `json:"clients"`
+	Grants  map[string]Grant  `json:"grants"`
+}
+
+// NewFileStore loads the store from path, which doesn't have to exist yet.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read OAuth store: %w", err)
+	}
+	var state fileState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse OAuth store %s: %w", path, err)
+	}
+	if state.Clients != nil {
+		s.clients = state.Clients
+	}
+	if state.Grants != nil {
+		s.grants = state.Grants
+	}
+	return s, nil
+}
+
+func (s *FileStore) SaveClient(ctx context.Context, client Client) error {
+	if err := s.MemoryStore.SaveClient(ctx, client); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+func (s *FileStore) SaveGrant(ctx context.Context, key string, grant Grant) error {
+	_ = s.MemoryStore.SaveGrant(ctx, key, grant)
+	return s.persist()
+}
+
+func (s *FileStore) TakeGrant(ctx context.Context, key string) (Grant, error) {
+	grant, err := s.MemoryStore.TakeGrant(ctx, key)
+	if err != nil {
+		return grant, err
+	}
+	return grant, s.persist()
+}
+
+// persist writes the state to a temporary file renamed over the store, so
+// a crash never leaves a truncated file behind.
+func (s *FileStore) persist() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.MemoryStore.mu.Lock()
+	data, err := json.Marshal(fileState{Clients: s.clients, Grants: s.grants})
+	s.MemoryStore.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("marshal OAuth store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write OAuth store: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write OAuth store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write OAuth store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write OAuth store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package oauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreGrants(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	assert.NoError(t, s.SaveGrant(t.Context(), "a", Grant{PAT: "pat-a", Expires: now.Add(time.Minute)}))
+	assert.NoError(t, s.SaveGrant(t.Context(), "b", Grant{PAT: "pat-b", Expires: now.Add(time.Hour)}))
+
+	grant, err := s.Grant(t.Context(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "pat-a", grant.PAT)
+
+	grant, err = s.TakeGrant(t.Context(), "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "pat-b", grant.PAT)
+	_, err = s.Grant(t.Context(), "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	now = now.Add(time.Minute)
+	_, err = s.Grant(t.Context(), "a")
+	assert.ErrorIs(t, err, ErrNotFound, "expired grants aren't returned")
+	assert.Empty(t, s.grants)
+}
+
+func TestMemoryStoreClients(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	s.maxClients = 2
+
+	assert.NoError(t, s.SaveClient(t.Context(), Client{ID: "used", CreatedAt: now}))
+	assert.NoError(t, s.SaveClient(t.Context(), Client{ID: "unused", CreatedAt: now}))
+	assert.ErrorIs(t, s.SaveClient(t.Context(), Client{ID: "third", CreatedAt: now}), ErrTooManyClients)
+	assert.NoError(t, s.SaveGrant(t.Context(), "code", Grant{ClientID: "used", Expires: now.Add(time.Minute)}))
+
+	now = now.Add(unauthorizedClientTTL)
+	assert.NoError(t, s.SaveClient(t.Context(), Client{ID: "third", CreatedAt: now}))
+	_, err := s.Client(t.Context(), "unused")
+	assert.ErrorIs(t, err, ErrNotFound, "clients without a grant expire")
+	client, err := s.Client(t.Context(), "used")
+	assert.NoError(t, err)
+	assert.True(t, client.Authorized)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oauth.json")
+	s, err := NewFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	expires := time.Now().Add(time.Hour)
+	assert.NoError(t, s.SaveClient(t.Context(), Client{ID: "client", RedirectURIs: []string{"https://example.com/cb"}}))
+	assert.NoError(t, s.SaveGrant(t.Context(), "token", Grant{ClientID: "client", PAT: "pat", Expires: expires}))
+	assert.NoError(t, s.SaveGrant(t.Context(), "code", Grant{ClientID: "client", PAT: "pat", Expires: expires}))
+	_, err = s.TakeGrant(t.Context(), "code")
+	assert.NoError(t, err)
+
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	// A new store reads the state back.
+	s, err = NewFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client, err := s.Client(t.Context(), "client")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/cb"}, client.RedirectURIs)
+	grant, err := s.Grant(t.Context(), "token")
+	assert.NoError(t, err)
+	assert.Equal(t, "pat", grant.PAT)
+	_, err = s.Grant(t.Context(), "code")
+	assert.ErrorIs(t, err, ErrNotFound, "taken grants are removed from the file")
+}
+
+func TestNewStore(t *testing.T) {
+	s, err := NewStore("memory")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, s)
+
+	s, err = NewStore("file:" + filepath.Join(t.TempDir(), "oauth.json"))
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStore{}, s)
+
+	_, err = NewStore("redis://localhost")
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+// Package prompt provides MCP prompts for common CI workflows. A prompt
+// starts the conversation with the data it needs, fetched by calling tools
+// of the server, so the same middlewares apply as to the client's own tool
+// calls: credentials, enabled tools, safety mode and rate limits.
+package prompt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Prompt is a prompt template. Build fetches the context of the prompt and
+// returns the instructions the conversation starts with.
+type Prompt struct {
+	Name        string
+	Description string
+	Arguments   []Argument
+	Build       func(ctx context.Context, f *Fetcher, args Arguments) string
+}
+
+// Argument is an argument of a prompt. MCP passes prompt arguments as
+// strings; they are checked and converted before Build is called.
+type Argument struct {
+	Name        string
+	Description string
+	Required    bool
+	// Integer arguments are converted to int.
+	Integer bool
+	// Enum lists the allowed values, any value is allowed when empty.
+	Enum []string
+}
+
+// Arguments are the checked arguments of a prompt, by name. Optional
+// arguments that weren't provided are missing.
+type Arguments map[string]any
+
+// String returns a string argument, "" if it wasn't provided.
+func (a Arguments) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Int returns an integer argument, def if it wasn't provided.
+func (a Arguments) Int(name string, def int) int {
+	if i, ok := a[name].(int); ok {
+		return i
+	}
+	return def
+}
+
+// Prompts are the prompts of the server.
+var Prompts = []Prompt{ //nolint:gochecknoglobals
+	DiagnoseFailedBuild,
+	SpeedUpWorkflow,
+	AddStep,
+	ReleaseToTesters,
+	RollBackCodePush,
+}
+
+// RegisterAll adds every prompt to the server. Their tool calls go through
+// the server's tools/call handling.
+func RegisterAll(s *server.MCPServer) {
+	callTool := tool.ServerCaller(s)
+	for _, p := range Prompts {
+		s.AddPrompt(p.Definition(), p.Handler(callTool))
+	}
+}
+
+// Definition is the MCP definition of the prompt.
+func (p Prompt) Definition() mcp.Prompt {
+	opts := []mcp.PromptOption{mcp.WithPromptDescription(p.Description)}
+	for _, arg := range p.Arguments {
+		description := arg.Description
+		if len(arg.Enum) > 0 {
+			description += " One of: " + strings.Join(arg.Enum, ", ") + "."
+		}
+		argOpts := []mcp.ArgumentOption{mcp.ArgumentDescription(description)}
+		if arg.Required {
+			argOpts = append(argOpts, mcp.RequiredArgument())
+		}
+		opts = append(opts, mcp.WithArgument(arg.Name, argOpts...))
+	}
+	return mcp.NewPrompt(p.Name, opts...)
+}
+
+// Handler checks the arguments of a prompts/get request and builds the
+// prompt with the tool results it fetched.
+func (p Prompt) Handler(callTool tool.CallFunc) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		args, err := p.parseArguments(request.Params.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		f := &Fetcher{callTool: callTool}
+		instructions := p.Build(ctx, f, args)
+		messages := append([]mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instructions)),
+		}, f.messages...)
+		return mcp.NewGetPromptResult(p.Description, messages), nil
+	}
+}
+
+func (p Prompt) parseArguments(raw map[string]string) (Arguments, error) {
+	args := Arguments{}
+	for _, arg := range p.Arguments {
+		value := strings.TrimSpace(raw[arg.Name])
+		if value == "" {
+			if arg.Required {
+				return nil, fmt.Errorf("missing required argument %s", arg.Name)
+			}
+			continue
+		}
+		if len(arg.Enum) > 0 && !slices.Contains(arg.Enum, value) {
+			return nil, fmt.Errorf("invalid %s %q: use one of %s", arg.Name, value, strings.Join(arg.Enum, ", "))
+		}
+		if arg.Integer {
+			i, err := strconv.Atoi(value)
+			if err != nil || i < 1 {
+				return nil, fmt.Errorf("invalid %s %q: must be a positive integer", arg.Name, value)
+			}
+			args[arg.Name] = i
+			continue
+		}
+		args[arg.Name] = value
+	}
+	return args, nil
+}
+
+// Fetcher calls tools and attaches their results to the prompt.
+type Fetcher struct {
+	callTool tool.CallFunc
+	messages []mcp.PromptMessage
+}
+
+// Fetch calls a tool and attaches its result to the prompt under title. A
+// failed call is attached as an error, so the prompt still works without
+// some of the data, e.g. when the tool isn't enabled. It returns the
+// structured content of the result for fetching dependent data, nil if the
+// call failed or the result isn't structured.
+func (f *Fetcher) Fetch(ctx context.Context, title, tool string, arguments map[string]any) map[string]any {
+	result, err := f.callTool(ctx, tool, arguments)
+	if err == nil && result.IsError {
+		err = errors.New(resultText(result))
+	}
+	if err != nil {
+		f.attach(fmt.Sprintf("%s could not be fetched with %s: %s", title, tool, err))
+		return nil
+	}
+	text := resultText(result)
+	var structured map[string]any
+	if result.StructuredContent != nil {
+		if data, err := json.MarshalIndent(result.StructuredContent, "", "  "); err == nil {
+			text = string(data)
+			_ = json.Unmarshal(data, &structured)
+		}
+	}
+	f.attach(fmt.Sprintf("%s (%s):\n\n%s", title, tool, text))
+	return structured
+}
+
+func (f *Fetcher) attach(text string) {
+	f.messages = append(f.messages, mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text)))
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,106 @@
+package prompt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArguments(t *testing.T) {
+	p := Prompt{Arguments: []Argument{
+		{Name: "app_slug", Required: true},
+		{Name: "builds", Integer: true},
+		{Name: "platform", Enum: []string{"ios", "android"}},
+	}}
+	cases := map[string]struct {
+		raw        map[string]string
+		want       Arguments
+		wantErrStr string
+	}{
+		"required only":    {raw: map[string]string{"app_slug": "app1"}, want: Arguments{"app_slug": "app1"}},
+		"typed":            {raw: map[string]string{"app_slug": "app1", "builds": "3", "platform": "ios"}, want: Arguments{"app_slug": "app1", "builds": 3, "platform": "ios"}},
+		"missing required": {raw: map[string]string{"app_slug": " "}, wantErrStr: "missing required argument app_slug"},
+		"not an integer":   {raw: map[string]string{"app_slug": "app1", "builds": "many"}, wantErrStr: "invalid builds"},
+		"not in enum":      {raw: map[string]string{"app_slug": "app1", "platform": "web"}, wantErrStr: "use one of ios, android"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := p.parseArguments(tc.raw)
+			if tc.wantErrStr != "" {
+				assert.ErrorContains(t, err, tc.wantErrStr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDiagnoseFailedBuild(t *testing.T) {
+	var calls []string
+	callTool := func(_ context.Context, name string, arguments map[string]any) (*mcp.CallToolResult, error) {
+		calls = append(calls, name)
+		switch name {
+		case "get_build_steps":
+			return mcp.NewToolResultStructuredOnly(map[string]any{"execution": map[string]any{"workflows": []any{
+				map[string]any{"steps": []any{
+					map[string]any{"uuid": "step1", "title": "Clone", "status": "success"},
+					map[string]any{"uuid": "step2", "title": "Test", "status": "failed"},
+				}},
+			}}}), nil
+		case "get_build_log":
+			assert.Equal(t, "step2", arguments["step_uuid"])
+			return mcp.NewToolResultStructuredOnly(map[string]any{"log_lines": "FAIL: TestLogin"}), nil
+		}
+		return mcp.NewToolResultError("get_build is disabled"), nil
+	}
+
+	result, err := DiagnoseFailedBuild.Handler(callTool)(t.Context(), mcp.GetPromptRequest{
+		Params: mcp.GetPromptParams{Arguments: map[string]string{"app_slug": "app1", "build_slug": "build1"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"get_build", "get_build_steps", "get_build_log"}, calls)
+	var texts []string
+	for _, message := range result.Messages {
+		assert.Equal(t, mcp.RoleUser, message.Role)
+		texts = append(texts, message.Content.(mcp.TextContent).Text)
+	}
+	if assert.Len(t, texts, 4) {
+		assert.Contains(t, texts[0], "Diagnose why build build1 of the Bitrise app app1 failed.")
+		assert.Contains(t, texts[1], "could not be fetched with get_build: get_build is disabled")
+		assert.Contains(t, texts[3], `the failed step "Test" (get_build_log)`)
+		assert.Contains(t, texts[3], "FAIL: TestLogin")
+	}
+}
+
+func TestRegisterAll(t *testing.T) {
+	s := server.NewMCPServer("test", "1", server.WithPromptCapabilities(false))
+	s.AddTool(mcp.NewTool("codepush_get_deployment"), func(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultStructuredOnly(map[string]any{"id": request.GetString("id", ""), "name": "Production"}), nil
+	})
+	RegisterAll(s)
+
+	message, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "prompts/get",
+		"params":  map[string]any{"name": "roll_back_codepush", "arguments": map[string]string{"deployment_id": "dep1"}},
+	})
+	res, ok := s.HandleMessage(t.Context(), message).(mcp.JSONRPCResponse)
+	if !assert.True(t, ok) {
+		return
+	}
+	result, ok := res.Result.(mcp.GetPromptResult)
+	if !assert.True(t, ok) || !assert.Len(t, result.Messages, 3) {
+		return
+	}
+	assert.Contains(t, result.Messages[0].Content.(mcp.TextContent).Text, "to the previous update")
+	assert.Contains(t, result.Messages[1].Content.(mcp.TextContent).Text, `"name": "Production"`)
+	assert.Contains(t, result.Messages[2].Content.(mcp.TextContent).Text, "could not be fetched with codepush_list_updates")
+}
@@ -0,0 +1,177 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// failedStepLogs is the number of failed steps whose log is attached
+	// when diagnosing a build.
+	failedStepLogs = 2
+	// failedStepLogLines is the number of lines attached from the end of the
+	// log of a failed step, where failures usually are.
+	failedStepLogLines = 300
+)
+
+var appSlugArgument = Argument{ //nolint:gochecknoglobals
+	Name:        "app_slug",
+	Description: "Identifier of the Bitrise app.",
+	Required:    true,
+}
+
+var DiagnoseFailedBuild = Prompt{ //nolint:gochecknoglobals
+	Name:        "diagnose_failed_build",
+	Description: "Find the root cause of a failed build from its steps and the logs of its failed steps, and propose a fix.",
+	Arguments: []Argument{
+		appSlugArgument,
+		{Name: "build_slug", Description: "Identifier of the failed build.", Required: true},
+	},
+	Build: func(ctx context.Context, f *Fetcher, args Arguments) string {
+		appSlug, buildSlug := args.String("app_slug"), args.String("build_slug")
+		build := map[string]any{"app_slug": appSlug, "build_slug": buildSlug}
+		f.Fetch(ctx, "The build", "get_build", build)
+		summary := f.Fetch(ctx, "The workflows and steps of the build", "get_build_steps", build)
+		for i, step := range failedSteps(summary) {
+			if i == failedStepLogs {
+				break
+			}
+			uuid, _ := step["uuid"].(string)
+			title, _ := step["title"].(string)
+			f.Fetch(ctx, fmt.Sprintf("The end of the log of the failed step %q", title), "get_build_log", map[string]any{
+				"app_slug":   appSlug,
+				"build_slug": buildSlug,
+				"step_uuid":  uuid,
+				"offset":     -1,
+				"limit":      failedStepLogLines,
+			})
+		}
+		return fmt.Sprintf(`Diagnose why build %s of the Bitrise app %s failed.
+
+Use the build, its steps and the logs of its failed steps below. Explain the root cause and quote the log lines that show it. Then propose a fix: a change to the code, or to the bitrise.yml the build ran with (get_build_bitrise_yml). If the failure looks flaky or caused by the infrastructure, say so and suggest rebuilding. Read more of the logs with get_build_log if the attached lines aren't enough.`, buildSlug, appSlug)
+	},
+}
+
+var SpeedUpWorkflow = Prompt{ //nolint:gochecknoglobals
+	Name:        "speed_up_workflow",
+	Description: "Find what makes a workflow slow from the step durations of its recent builds, and propose changes to bitrise.yml.",
+	Arguments: []Argument{
+		appSlugArgument,
+		{Name: "workflow_id", Description: "The workflow to speed up.", Required: true},
+		{Name: "builds", Description: "The number of recent successful builds to compare. Defaults to 5.", Integer: true},
+	},
+	Build: func(ctx context.Context, f *Fetcher, args Arguments) string {
+		appSlug, workflowID := args.String("app_slug"), args.String("workflow_id")
+		f.Fetch(ctx, "The bitrise.yml of the app", "get_bitrise_yml", map[string]any{"app_slug": appSlug})
+		list := f.Fetch(ctx, "Recent successful builds of the workflow", "list_builds", map[string]any{
+			"app_slug": appSlug,
+			"workflow": workflowID,
+			"status":   1,
+			"limit":    args.Int("builds", 5),
+		})
+		if slug, number := latestBuild(list); slug != "" {
+			f.Fetch(ctx, fmt.Sprintf("The step durations of build #%d", number), "get_build_steps", map[string]any{
+				"app_slug":   appSlug,
+				"build_slug": slug,
+			})
+		}
+		return fmt.Sprintf(`Make the %s workflow of the Bitrise app %s faster.
+
+Use the bitrise.yml, the recent successful builds and the step durations below to find where the time goes. Consider caching (key-based cache steps), running independent work in parallel with pipelines, removing or conditionally skipping steps, and a faster stack or machine type. Estimate the saving of each suggestion. Propose the changed bitrise.yml, check it with validate_bitrise_yml, and only update it with update_bitrise_yml once the user agreed.`, workflowID, appSlug)
+	},
+}
+
+var AddStep = Prompt{ //nolint:gochecknoglobals
+	Name:        "add_step",
+	Description: "Add a step to a workflow of bitrise.yml, choosing it from the step library and configuring its inputs.",
+	Arguments: []Argument{
+		appSlugArgument,
+		{Name: "workflow_id", Description: "The workflow to add the step to.", Required: true},
+		{Name: "step", Description: "What the step should do, or its ID, e.g. \"slack\" or \"deploy to App Store\".", Required: true},
+	},
+	Build: func(ctx context.Context, f *Fetcher, args Arguments) string {
+		appSlug, workflowID, step := args.String("app_slug"), args.String("workflow_id"), args.String("step")
+		f.Fetch(ctx, "The bitrise.yml of the app", "get_bitrise_yml", map[string]any{"app_slug": appSlug})
+		f.Fetch(ctx, fmt.Sprintf("Steps matching %q", step), "step_search", map[string]any{"query": step})
+		return fmt.Sprintf(`Add a step to the %s workflow of the Bitrise app %s that does this: %s.
+
+Choose the best matching step from the search results below, look up its inputs with step_inputs, and add it at the right position of the workflow with the inputs it needs, using secrets or env vars for credentials. Propose the changed bitrise.yml, check it with validate_bitrise_yml, and only update it with update_bitrise_yml once the user agreed.`, workflowID, appSlug, step)
+	},
+}
+
+var ReleaseToTesters = Prompt{ //nolint:gochecknoglobals
+	Name:        "release_to_testers",
+	Description: "Send a build of a Release Management connected app to a tester group.",
+	Arguments: []Argument{
+		{Name: "connected_app_id", Description: "Identifier of the Release Management connected app.", Required: true},
+		{Name: "platform", Description: "The platform of the build to release.", Enum: []string{"ios", "android"}},
+		{Name: "version", Description: "The version to release. Defaults to the latest."},
+	},
+	Build: func(ctx context.Context, f *Fetcher, args Arguments) string {
+		connectedAppID := args.String("connected_app_id")
+		artifacts := map[string]any{"connected_app_id": connectedAppID}
+		if platform := args.String("platform"); platform != "" {
+			artifacts["platform"] = platform
+		}
+		if version := args.String("version"); version != "" {
+			artifacts["version"] = version
+			artifacts["distribution_ready"] = true
+		}
+		f.Fetch(ctx, "Recent installable artifacts", "list_installable_artifacts", artifacts)
+		f.Fetch(ctx, "Tester groups", "list_tester_groups", map[string]any{"connected_app_id": connectedAppID})
+		return fmt.Sprintf(`Release a build of the Release Management connected app %s to testers.
+
+Pick the latest distribution ready build from the installable artifacts below that matches the requested platform and version, if any. Find its test build with list_build_distribution_versions and list_build_distribution_version_test_builds. Ask the user which tester groups to notify, then notify them with notify_tester_group. Summarize what was sent to whom.`, connectedAppID)
+	},
+}
+
+var RollBackCodePush = Prompt{ //nolint:gochecknoglobals
+	Name:        "roll_back_codepush",
+	Description: "Roll back a CodePush deployment to a previous update.",
+	Arguments: []Argument{
+		{Name: "deployment_id", Description: "Identifier of the CodePush deployment.", Required: true},
+		{Name: "package_id", Description: "The update to roll back to. Defaults to the previous one."},
+	},
+	Build: func(ctx context.Context, f *Fetcher, args Arguments) string {
+		deploymentID := args.String("deployment_id")
+		f.Fetch(ctx, "The deployment", "codepush_get_deployment", map[string]any{"id": deploymentID})
+		f.Fetch(ctx, "Recent updates of the deployment", "codepush_list_updates", map[string]any{"deployment_id": deploymentID})
+		target := "the previous update"
+		if packageID := args.String("package_id"); packageID != "" {
+			target = "update " + packageID
+		}
+		return fmt.Sprintf(`Roll back the CodePush deployment %s to %s.
+
+Using the deployment and its recent updates below, summarize the current update and the one the deployment will roll back to: label, description, rollout and whether it's mandatory or disabled. Ask the user to confirm, then roll back with codepush_rollback_deployment, and check the result with codepush_get_deployment.`, deploymentID, target)
+	},
+}
+
+// failedSteps returns the failed steps of a build's step summary.
+func failedSteps(summary map[string]any) []map[string]any {
+	execution, _ := summary["execution"].(map[string]any)
+	workflows, _ := execution["workflows"].([]any)
+	var failed []map[string]any
+	for _, wf := range workflows {
+		workflow, _ := wf.(map[string]any)
+		steps, _ := workflow["steps"].([]any)
+		for _, s := range steps {
+			if step, ok := s.(map[string]any); ok && step["status"] == "failed" {
+				failed = append(failed, step)
+			}
+		}
+	}
+	return failed
+}
+
+// latestBuild returns the slug and number of the first build of a build
+// list.
+func latestBuild(list map[string]any) (string, int) {
+	builds, _ := list["data"].([]any)
+	if len(builds) == 0 {
+		return "", 0
+	}
+	build, _ := builds[0].(map[string]any)
+	slug, _ := build["slug"].(string)
+	number, _ := build["build_number"].(float64)
+	return slug, int(number)
+}
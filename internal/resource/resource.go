@@ -0,0 +1,337 @@
+// Package resource exposes bitrise.yml files, build logs and build step
+// summaries as MCP resources, so clients can attach them as context without a
+// tool call. Each resource is backed by the API calls of a tool.
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool/builds"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool/pipelines"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	mimeYAML = "application/yaml"
+	mimeText = "text/plain"
+	mimeJSON = "application/json"
+
+	// appIndexBuilds is the number of recent builds listed by an app's index.
+	appIndexBuilds = 10
+)
+
+// Template is a resource template. It can only be read when Tool, the tool
+// backed by the same API calls, is enabled. Resources with a Status can be
+// subscribed to: Status reads it from their contents, finished resources
+// don't change anymore.
+type Template struct {
+	Tool       string
+	Definition mcp.ResourceTemplate
+	Handler    server.ResourceTemplateHandlerFunc
+	Status     func(contents string) (status string, finished bool, err error)
+}
+
+// Templates are the resource templates of the server.
+var Templates = []Template{ //nolint:gochecknoglobals
+	AppIndex,
+	BitriseYML,
+	Build,
+	BuildBitriseYML,
+	BuildLog,
+	BuildSteps,
+	Pipeline,
+	StepLog,
+}
+
+// RegisterAll adds every resource template to the server.
+func RegisterAll(s *server.MCPServer) {
+	for _, t := range Templates {
+		s.AddResourceTemplate(t.Definition, t.Handler)
+	}
+}
+
+// Match returns the template of a resource URI.
+func Match(uri string) (Template, bool) {
+	for _, t := range Templates {
+		if t.Definition.URITemplate.Regexp().MatchString(uri) {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+var AppIndex = Template{ //nolint:gochecknoglobals
+	Tool: "list_builds",
+	Definition: mcp.NewResourceTemplate("bitrise://apps/{app_slug}", "App resources",
+		mcp.WithTemplateDescription(fmt.Sprintf("Resources of a Bitrise app: its bitrise.yml and the logs, step summaries and bitrise.yml of its %d most recent builds.", appIndexBuilds)),
+		mcp.WithTemplateMIMEType(mimeJSON),
+	),
+	Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		appSlug, err := argument(request, "app_slug")
+		if err != nil {
+			return nil, err
+		}
+		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/builds", appSlug),
+			Params: map[string]any{"limit": appIndexBuilds},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("call api: %w", err)
+		}
+		var list struct {
+			Data []struct {
+				Slug              string `json:"slug"`
+				BuildNumber       int    `json:"build_number"`
+				Branch            string `json:"branch"`
+				TriggeredWorkflow string `json:"triggered_workflow"`
+				StatusText        string `json:"status_text"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(res), &list); err != nil {
+			return nil, fmt.Errorf("unmarshal builds: %w", err)
+		}
+
+		appURI := "bitrise://apps/" + appSlug
+		resources := []mcp.Resource{
+			mcp.NewResource(appURI+"/bitrise.yml", "bitrise.yml", mcp.WithMIMEType(mimeYAML)),
+		}
+		for _, b := range list.Data {
+			buildURI := fmt.Sprintf("%s/builds/%s", appURI, b.Slug)
+			build := fmt.Sprintf("Build #%d", b.BuildNumber)
+			description := fmt.Sprintf("%s of %s on %s, %s", build, b.TriggeredWorkflow, b.Branch, b.StatusText)
+			resources = append(resources,
+				mcp.NewResource(buildURI+"/log", build+" log", mcp.WithResourceDescription(description), mcp.WithMIMEType(mimeText)),
+				mcp.NewResource(buildURI+"/steps", build+" steps", mcp.WithResourceDescription(description), mcp.WithMIMEType(mimeJSON)),
+				mcp.NewResource(buildURI+"/bitrise.yml", build+" bitrise.yml", mcp.WithResourceDescription(description), mcp.WithMIMEType(mimeYAML)),
+			)
+		}
+		return jsonContents(request.Params.URI, map[string]any{"resources": resources})
+	},
+}
+
+var BitriseYML = Template{ //nolint:gochecknoglobals
+	Tool: "get_bitrise_yml",
+	Definition: mcp.NewResourceTemplate("bitrise://apps/{app_slug}/bitrise.yml", "App bitrise.yml",
+		mcp.WithTemplateDescription("The current bitrise.yml of a Bitrise app."),
+		mcp.WithTemplateMIMEType(mimeYAML),
+	),
+	Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		appSlug, err := argument(request, "app_slug")
+		if err != nil {
+			return nil, err
+		}
+		return apiContents(ctx, request.Params.URI, mimeYAML, fmt.Sprintf("/apps/%s/bitrise.yml", appSlug))
+	},
+}
+
+var BuildBitriseYML = Template{ //nolint:gochecknoglobals
+	Tool: "get_build_bitrise_yml",
+	Definition: mcp.NewResourceTemplate("bitrise://apps/{app_slug}/builds/{build_slug}/bitrise.yml", "Build bitrise.yml",
+		mcp.WithTemplateDescription("The bitrise.yml a build ran with."),
+		mcp.WithTemplateMIMEType(mimeYAML),
+	),
+	Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		appSlug, buildSlug, err := buildArguments(request)
+		if err != nil {
+			return nil, err
+		}
+		return apiContents(ctx, request.Params.URI, mimeYAML, fmt.Sprintf("/apps/%s/builds/%s/bitrise.yml", appSlug, buildSlug))
+	},
+}
+
+var BuildLog = Template{ //nolint:gochecknoglobals
+	Tool: "get_build_log",
+	Definition: mcp.NewResourceTemplate("bitrise://apps/{app_slug}/builds/{build_slug}/log", "Build log",
+		mcp.WithTemplateDescription("The full log of a build. Prefer step logs for long builds."),
+		mcp.WithTemplateMIMEType(mimeText),
+	),
+	Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		appSlug, buildSlug, err := buildArguments(request)
+		if err != nil {
+			return nil, err
+		}
+		return logContents(ctx, request.Params.URI, appSlug, buildSlug, "")
+	},
+}
+
+var StepLog = Template{ //nolint:gochecknoglobals
+	Tool: "get_build_log",
+	Definition: mcp.NewResourceTemplate("bitrise://apps/{app_slug}/builds/{build_slug}/steps/{step_uuid}/log", "Step log",
+		mcp.WithTemplateDescription("The log of a step of a build. Step UUIDs are listed by the build's steps resource."),
+		mcp.WithTemplateMIMEType(mimeText),
+	),
+	Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		appSlug, buildSlug, err := buildArguments(request)
+		if err != nil {
+			return nil, err
+		}
+		stepUUID, err := argument(request, "step_uuid")
+		if err != nil {
+			return nil, err
+		}
+		return logContents(ctx, request.Params.URI, appSlug, buildSlug, stepUUID)
+	},
+}
+
+var BuildSteps = Template{ //nolint:gochecknoglobals
+	Tool: "get_build_steps",
+	Definition: mcp.NewResourceTemplate("bitrise://apps/{app_slug}/builds/{build_slug}/steps", "Build steps",
+		mcp.WithTemplateDescription("The workflows and steps of a build with their status, duration and UUID."),
+		mcp.WithTemplateMIMEType(mimeJSON),
+	),
+	Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		appSlug, buildSlug, err := buildArguments(request)
+		if err != nil {
+			return nil, err
+		}
+		return toolContents(ctx, request.Params.URI, builds.GetSteps, map[string]any{"app_slug": appSlug, "build_slug": buildSlug})
+	},
+}
+
+var Build = Template{ //nolint:gochecknoglobals
+	Tool: "get_build",
+	Definition: mcp.NewResourceTemplate("bitrise://apps/{app_slug}/builds/{build_slug}", "Build",
+		mcp.WithTemplateDescription("A build with its status. Subscribe to it to be notified when the status changes, until the build finishes."),
+		mcp.WithTemplateMIMEType(mimeJSON),
+	),
+	Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		appSlug, buildSlug, err := buildArguments(request)
+		if err != nil {
+			return nil, err
+		}
+		return toolContents(ctx, request.Params.URI, builds.Get, map[string]any{"app_slug": appSlug, "build_slug": buildSlug})
+	},
+	Status: func(contents string) (string, bool, error) {
+		var build struct {
+			Data struct {
+				// Status is 0 while the build is not finished.
+				Status     int    `json:"status"`
+				StatusText string `json:"status_text"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(contents), &build); err != nil {
+			return "", false, fmt.Errorf("unmarshal build: %w", err)
+		}
+		return build.Data.StatusText, build.Data.Status != 0, nil
+	},
+}
+
+var Pipeline = Template{ //nolint:gochecknoglobals
+	Tool: "get_pipeline",
+	Definition: mcp.NewResourceTemplate("bitrise://apps/{app_slug}/pipelines/{pipeline_id}", "Pipeline",
+		mcp.WithTemplateDescription("A pipeline with its status and workflows. Subscribe to it to be notified when the status changes, until the pipeline finishes."),
+		mcp.WithTemplateMIMEType(mimeJSON),
+	),
+	Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		appSlug, err := argument(request, "app_slug")
+		if err != nil {
+			return nil, err
+		}
+		pipelineID, err := argument(request, "pipeline_id")
+		if err != nil {
+			return nil, err
+		}
+		return toolContents(ctx, request.Params.URI, pipelines.Get, map[string]any{"app_slug": appSlug, "pipeline_id": pipelineID})
+	},
+	Status: func(contents string) (string, bool, error) {
+		var pipeline struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(contents), &pipeline); err != nil {
+			return "", false, fmt.Errorf("unmarshal pipeline: %w", err)
+		}
+		return pipeline.Status, pipelines.Finished(pipeline.Status), nil
+	},
+}
+
+// argument returns a variable of the URI template. Variables are always
+// strings, as none of the templates use list or map expansions.
+func argument(request mcp.ReadResourceRequest, name string) (string, error) {
+	var value string
+	switch v := request.Params.Arguments[name].(type) {
+	case string:
+		value = v
+	case []string:
+		if len(v) > 0 {
+			value = v[0]
+		}
+	}
+	if value == "" {
+		return "", fmt.Errorf("missing %s in resource URI", name)
+	}
+	return value, nil
+}
+
+func buildArguments(request mcp.ReadResourceRequest) (string, string, error) {
+	appSlug, err := argument(request, "app_slug")
+	if err != nil {
+		return "", "", err
+	}
+	buildSlug, err := argument(request, "build_slug")
+	if err != nil {
+		return "", "", err
+	}
+	return appSlug, buildSlug, nil
+}
+
+func apiContents(ctx context.Context, uri, mimeType, path string) ([]mcp.ResourceContents, error) {
+	res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
+		Method: http.MethodGet,
+		API:    bitrise.APIMain,
+		Path:   path,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("call api: %w", err)
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: mimeType, Text: res}}, nil
+}
+
+func logContents(ctx context.Context, uri, appSlug, buildSlug, stepUUID string) ([]mcp.ResourceContents, error) {
+	log, err := builds.FetchLog(ctx, appSlug, buildSlug, stepUUID)
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: mimeText, Text: log}}, nil
+}
+
+// toolContents reads a resource by calling the handler of a tool returning
+// structured content.
+func toolContents(ctx context.Context, uri string, tool bitrise.Tool, arguments map[string]any) ([]mcp.ResourceContents, error) {
+	var call mcp.CallToolRequest
+	call.Params.Name = tool.Definition.Name
+	call.Params.Arguments = arguments
+	result, err := tool.Handler(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsError {
+		return nil, toolError(result)
+	}
+	return jsonContents(uri, result.StructuredContent)
+}
+
+func jsonContents(uri string, v any) ([]mcp.ResourceContents, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal resource: %w", err)
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: mimeJSON, Text: string(data)}}, nil
+}
+
+// toolError turns the error result of a tool into an error.
+func toolError(result *mcp.CallToolResult) error {
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			return errors.New(text.Text)
+		}
+	}
+	return errors.New("tool call failed")
+}
@@ -0,0 +1,182 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAPI(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /apps/app1/bitrise.yml", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "format_version: \"13\"\n")
+	})
+	mux.HandleFunc("GET /apps/app1/builds/build1", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data":{"slug":"build1","status":0,"status_text":"in-progress"}}`)
+	})
+	mux.HandleFunc("GET /apps/app1/pipelines/pipeline1", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"id":"pipeline1","status":"running"}`)
+	})
+	mux.HandleFunc("GET /apps/app1/builds/build1/bitrise.yml", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "format_version: \"11\"\n")
+	})
+	mux.HandleFunc("GET /apps/app1/builds", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
+		fmt.Fprint(w, `{"data":[{"slug":"build1","build_number":42,"branch":"main","triggered_workflow":"ci","status_text":"failed"}]}`)
+	})
+	mux.HandleFunc("GET /apps/app1/builds/build1/log/summary", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"app_id":"app1","execution":{"workflows":[{"name":"ci","steps":[{"uuid":"step1","status":"failed"}]}]}}`)
+	})
+	mux.HandleFunc("GET /apps/app1/builds/build1/log", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"log_chunks":[{"chunk":"line1\n","position":1},{"chunk":"line2\n","position":2}]}`)
+	})
+	mux.HandleFunc("GET /apps/app1/builds/build1/log/steps/step1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"expiring_raw_log_url":"http://%s/raw/step1"}`, r.Host)
+	})
+	mux.HandleFunc("GET /raw/step1", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"message":"compiling\n"},{"message":"error: boom\n"}]`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func readResource(ctx context.Context, s *server.MCPServer, uri string) (mcp.ReadResourceResult, *mcp.JSONRPCError) {
+	message, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "resources/read",
+		"params":  map[string]any{"uri": uri},
+	})
+	switch res := s.HandleMessage(ctx, message).(type) {
+	case mcp.JSONRPCResponse:
+		result, _ := res.Result.(mcp.ReadResourceResult)
+		return result, nil
+	case mcp.JSONRPCError:
+		return mcp.ReadResourceResult{}, &res
+	}
+	return mcp.ReadResourceResult{}, nil
+}
+
+func TestTemplates(t *testing.T) {
+	api := newTestAPI(t)
+	s := server.NewMCPServer("test", "1", server.WithResourceCapabilities(false, false))
+	RegisterAll(s)
+	ctx := bitrise.ContextWithPAT(t.Context(), "pat")
+	ctx = bitrise.ContextWithBaseURLs(ctx, bitrise.BaseURLs{API: api.URL})
+
+	cases := map[string]struct {
+		uri          string
+		wantMIMEType string
+		wantText     string
+		wantContains []string
+	}{
+		"bitrise.yml": {
+			uri:          "bitrise://apps/app1/bitrise.yml",
+			wantMIMEType: "application/yaml",
+			wantText:     "format_version: \"13\"\n",
+		},
+		"build bitrise.yml": {
+			uri:          "bitrise://apps/app1/builds/build1/bitrise.yml",
+			wantMIMEType: "application/yaml",
+			wantText:     "format_version: \"11\"\n",
+		},
+		"build log": {
+			uri:          "bitrise://apps/app1/builds/build1/log",
+			wantMIMEType: "text/plain",
+			wantText:     "line1\nline2\n",
+		},
+		"step log": {
+			uri:          "bitrise://apps/app1/builds/build1/steps/step1/log",
+			wantMIMEType: "text/plain",
+			wantText:     "compiling\nerror: boom\n",
+		},
+		"build steps": {
+			uri:          "bitrise://apps/app1/builds/build1/steps",
+			wantMIMEType: "application/json",
+			wantContains: []string{`"uuid": "step1"`},
+		},
+		"build": {
+			uri:          "bitrise://apps/app1/builds/build1",
+			wantMIMEType: "application/json",
+			wantContains: []string{`"status_text": "in-progress"`},
+		},
+		"pipeline": {
+			uri:          "bitrise://apps/app1/pipelines/pipeline1",
+			wantMIMEType: "application/json",
+			wantContains: []string{`"status": "running"`},
+		},
+		"app index": {
+			uri:          "bitrise://apps/app1",
+			wantMIMEType: "application/json",
+			wantContains: []string{
+				`"uri": "bitrise://apps/app1/bitrise.yml"`,
+				`"uri": "bitrise://apps/app1/builds/build1/log"`,
+				`"uri": "bitrise://apps/app1/builds/build1/steps"`,
+				`"description": "Build #42 of ci on main, failed"`,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, rpcErr := readResource(ctx, s, tc.uri)
+			if !assert.Nil(t, rpcErr) || !assert.Len(t, result.Contents, 1) {
+				return
+			}
+			contents, ok := result.Contents[0].(mcp.TextResourceContents)
+			if !assert.True(t, ok) {
+				return
+			}
+			assert.Equal(t, tc.uri, contents.URI)
+			assert.Equal(t, tc.wantMIMEType, contents.MIMEType)
+			if tc.wantText != "" {
+				assert.Equal(t, tc.wantText, contents.Text)
+			}
+			for _, want := range tc.wantContains {
+				assert.Contains(t, contents.Text, want)
+			}
+			template, ok := Match(tc.uri)
+			if assert.True(t, ok) {
+				assert.Equal(t, tc.wantMIMEType, template.Definition.MIMEType)
+			}
+		})
+	}
+
+	_, rpcErr := readResource(ctx, s, "bitrise://apps/unknown/bitrise.yml")
+	assert.NotNil(t, rpcErr, "API errors are returned")
+	_, ok := Match("bitrise://apps/app1/artifacts")
+	assert.False(t, ok)
+}
+
+func TestStatus(t *testing.T) {
+	cases := map[string]struct {
+		template     Template
+		contents     string
+		wantStatus   string
+		wantFinished bool
+	}{
+		"running build":      {template: Build, contents: `{"data":{"status":0,"status_text":"in-progress"}}`, wantStatus: "in-progress"},
+		"failed build":       {template: Build, contents: `{"data":{"status":2,"status_text":"error"}}`, wantStatus: "error", wantFinished: true},
+		"pipeline on hold":   {template: Pipeline, contents: `{"status":"on_hold"}`, wantStatus: "on_hold"},
+		"succeeded pipeline": {template: Pipeline, contents: `{"status":"succeeded"}`, wantStatus: "succeeded", wantFinished: true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			status, finished, err := tc.template.Status(tc.contents)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantStatus, status)
+			assert.Equal(t, tc.wantFinished, finished)
+		})
+	}
+
+	_, _, err := Build.Status("not json")
+	assert.Error(t, err)
+}
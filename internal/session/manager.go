@@ -0,0 +1,243 @@
+// Package session manages the sessions of the stateful streamable HTTP
+// transport: it issues session IDs, expires idle sessions and keeps them in a
+// Store that replicas can share.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// IDPrefix starts every session ID.
+	IDPrefix = "bmcp-session-"
+	// touchGranularity limits how often the expiry of an active session is
+	// written to the store.
+	touchGranularity = time.Minute
+	// sweepInterval is how often sessions of this replica are checked for
+	// expiry.
+	sweepInterval = time.Minute
+)
+
+// Manager implements server.SessionIdManagerResolver. Sessions expire after
+// the idle timeout without requests; the client then gets 404 and, as the MCP
+// specification requires, starts a new session. Sessions are bound to the PAT
+// fingerprint of the client that created them: requests of other clients get
+// 404 as if the session didn't exist, and can't terminate it. onEnd is called
+// with the ID of every session of this replica that expires or is terminated,
+// to release what the MCP server holds for it.
+type Manager struct {
+	store       Store
+	idleTimeout time.Duration
+	onEnd       func(id string)
+	now         func() time.Time
+
+	mu sync.Mutex
+	// local holds the sessions seen by this replica and when their expiry was
+	// last written.
+	local map[string]time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+var _ server.SessionIdManagerResolver = (*Manager)(nil)
+
+// NewManager starts a manager sweeping expired sessions in the background
+// until Close is called.
+func NewManager(store Store, idleTimeout time.Duration, onEnd func(id string)) *Manager {
+	m := newManager(store, idleTimeout, onEnd)
+	go m.sweepLoop()
+	return m
+}
+
+func newManager(store Store, idleTimeout time.Duration, onEnd func(id string)) *Manager {
+	if onEnd == nil {
+		onEnd = func(string) {}
+	}
+	return &Manager{
+		store:       store,
+		idleTimeout: idleTimeout,
+		onEnd:       onEnd,
+		now:         time.Now,
+		local:       map[string]time.Time{},
+		stop:        make(chan struct{}),
+	}
+}
+
+// ResolveSessionIdManager binds the sessions to the client of the request,
+// identified by the fingerprint of its PAT.
+func (m *Manager) ResolveSessionIdManager(r *http.Request) server.SessionIdManager {
+	return ownedSessions{m: m, owner: bitrise.PATFingerprint(r.Context())}
+}
+
+// Generate creates a session of owner. A session failing to be saved is
+// unknown on the next request, which makes the client start a new one.
+func (m *Manager) Generate(owner string) string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	id := IDPrefix + hex.EncodeToString(b)
+	now := m.now()
+	session := Session{ID: id, Created: now, Expires: now.Add(m.idleTimeout), Owner: owner}
+	if err := m.store.Save(context.Background(), session); err == nil {
+		m.mu.Lock()
+		m.local[id] = now
+		m.mu.Unlock()
+	}
+	return id
+}
+
+// Validate reports unknown and expired sessions as terminated, so clients
+// get 404 and start a new session, e.g. after the server restarted with a
+// memory store. Sessions of other owners are reported as terminated too,
+// without ending them. It extends the expiry of valid sessions.
+func (m *Manager) Validate(id, owner string) (bool, error) {
+	if !strings.HasPrefix(id, IDPrefix) {
+		return false, fmt.Errorf("invalid session id: %q", id)
+	}
+	ctx := context.Background()
+	session, err := m.store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		m.end(id)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if session.Owner != owner {
+		return true, nil
+	}
+
+	now := m.now()
+	m.mu.Lock()
+	touched, ok := m.local[id]
+	stale := !ok || now.Sub(touched) >= touchGranularity
+	if stale {
+		m.local[id] = now
+	}
+	m.mu.Unlock()
+	if !stale {
+		return false, nil
+	}
+	session.Expires = now.Add(m.idleTimeout)
+	if err := m.store.Save(ctx, session); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// Terminate ends a session on the client's DELETE request. Sessions of other
+// owners can't be terminated.
+func (m *Manager) Terminate(id, owner string) (bool, error) {
+	ctx := context.Background()
+	session, err := m.store.Get(ctx, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	if err == nil && session.Owner != owner {
+		return true, nil
+	}
+	if err := m.store.Delete(ctx, id); err != nil {
+		return false, err
+	}
+	m.end(id)
+	return false, nil
+}
+
+// Middleware validates the session of GET requests opening the
+// notification stream, which the streamable HTTP server doesn't check.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			id := r.Header.Get(server.HeaderKeySessionID)
+			if id == "" {
+				http.Error(w, "Missing session ID", http.StatusBadRequest)
+				return
+			}
+			terminated, err := m.Validate(id, bitrise.PATFingerprint(r.Context()))
+			if err != nil {
+				http.Error(w, "Invalid session ID", http.StatusBadRequest)
+				return
+			}
+			if terminated {
+				http.Error(w, "Session terminated", http.StatusNotFound)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ownedSessions is the server.SessionIdManager of a request, with the
+// sessions of its owner.
+type ownedSessions struct {
+	m     *Manager
+	owner string
+}
+
+func (s ownedSessions) Generate() string {
+	return s.m.Generate(s.owner)
+}
+
+func (s ownedSessions) Validate(id string) (bool, error) {
+	return s.m.Validate(id, s.owner)
+}
+
+func (s ownedSessions) Terminate(id string) (bool, error) {
+	return s.m.Terminate(id, s.owner)
+}
+
+// Close stops the background sweep.
+func (m *Manager) Close() {
+	m.once.Do(func() { close(m.stop) })
+}
+
+// end forgets a session of this replica and calls onEnd for it.
+func (m *Manager) end(id string) {
+	m.mu.Lock()
+	_, ok := m.local[id]
+	delete(m.local, id)
+	m.mu.Unlock()
+	if ok {
+		m.onEnd(id)
+	}
+}
+
+func (m *Manager) sweepLoop() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.sweep(context.Background())
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// sweep ends the sessions of this replica that expired, or were terminated
+// through another replica.
+func (m *Manager) sweep(ctx context.Context) {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.local))
+	for id := range m.local {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	for _, id := range ids {
+		if _, err := m.store.Get(ctx, id); errors.Is(err, ErrNotFound) {
+			m.end(id)
+		}
+	}
+}
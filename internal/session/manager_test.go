@@ -0,0 +1,145 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+const testOwner = "owner-fingerprint"
+
+func newTestManager(now *time.Time) (*Manager, *[]string) {
+	store := NewMemoryStore()
+	store.now = func() time.Time { return *now }
+	var ended []string
+	m := newManager(store, 10*time.Minute, func(id string) { ended = append(ended, id) })
+	m.now = func() time.Time { return *now }
+	return m, &ended
+}
+
+func TestManager(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, ended := newTestManager(&now)
+
+	id := m.Generate(testOwner)
+	assert.Contains(t, id, IDPrefix)
+	assert.NotEqual(t, id, m.Generate(testOwner))
+
+	terminated, err := m.Validate(id, testOwner)
+	assert.NoError(t, err)
+	assert.False(t, terminated)
+
+	// Requests keep the session alive past the idle timeout.
+	for range 3 {
+		now = now.Add(5 * time.Minute)
+		terminated, err = m.Validate(id, testOwner)
+		assert.NoError(t, err)
+		assert.False(t, terminated)
+	}
+
+	now = now.Add(10 * time.Minute)
+	terminated, err = m.Validate(id, testOwner)
+	assert.NoError(t, err)
+	assert.True(t, terminated, "idle sessions expire")
+	assert.Equal(t, []string{id}, *ended)
+
+	terminated, err = m.Validate(IDPrefix+"unknown", testOwner)
+	assert.NoError(t, err)
+	assert.True(t, terminated, "unknown sessions make the client start a new one")
+
+	_, err = m.Validate("mcp-session-123", testOwner)
+	assert.Error(t, err)
+
+	id = m.Generate(testOwner)
+	notAllowed, err := m.Terminate(id, testOwner)
+	assert.NoError(t, err)
+	assert.False(t, notAllowed)
+	terminated, _ = m.Validate(id, testOwner)
+	assert.True(t, terminated)
+	assert.Len(t, *ended, 2)
+}
+
+func TestManagerOwner(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, ended := newTestManager(&now)
+	id := m.Generate(testOwner)
+
+	terminated, err := m.Validate(id, "other-fingerprint")
+	assert.NoError(t, err)
+	assert.True(t, terminated, "other clients can't use the session")
+	notAllowed, err := m.Terminate(id, "other-fingerprint")
+	assert.NoError(t, err)
+	assert.True(t, notAllowed, "other clients can't terminate the session")
+
+	terminated, err = m.Validate(id, testOwner)
+	assert.NoError(t, err)
+	assert.False(t, terminated)
+	assert.Empty(t, *ended)
+
+	// The server resolves the sessions of the request's client.
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r = r.WithContext(bitrise.ContextWithPAT(r.Context(), "pat"))
+	owned := m.ResolveSessionIdManager(r)
+	id = owned.Generate()
+	terminated, _ = owned.Validate(id)
+	assert.False(t, terminated)
+	terminated, _ = m.Validate(id, bitrise.PATFingerprint(r.Context()))
+	assert.False(t, terminated)
+	terminated, _ = m.Validate(id, testOwner)
+	assert.True(t, terminated)
+}
+
+func TestManagerSweep(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, ended := newTestManager(&now)
+	idle, active := m.Generate(testOwner), m.Generate(testOwner)
+
+	now = now.Add(6 * time.Minute)
+	_, _ = m.Validate(active, testOwner)
+	now = now.Add(6 * time.Minute)
+	m.sweep(t.Context())
+	assert.Equal(t, []string{idle}, *ended)
+}
+
+func TestManagerMiddleware(t *testing.T) {
+	now := time.Now()
+	m, _ := newTestManager(&now)
+	id := m.Generate(bitrise.PATFingerprint(bitrise.ContextWithPAT(t.Context(), "pat")))
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := map[string]struct {
+		method     string
+		sessionID  string
+		pat        string
+		wantStatus int
+	}{
+		"stream of a session":      {method: http.MethodGet, sessionID: id, wantStatus: http.StatusOK},
+		"stream without session":   {method: http.MethodGet, wantStatus: http.StatusBadRequest},
+		"stream of unknown":        {method: http.MethodGet, sessionID: IDPrefix + "unknown", wantStatus: http.StatusNotFound},
+		"post is passed through":   {method: http.MethodPost, wantStatus: http.StatusOK},
+		"stream of another client": {method: http.MethodGet, sessionID: id, pat: "other-pat", wantStatus: http.StatusNotFound},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/", nil)
+			if tc.sessionID != "" {
+				r.Header.Set(server.HeaderKeySessionID, tc.sessionID)
+			}
+			pat := "pat"
+			if tc.pat != "" {
+				pat = tc.pat
+			}
+			r = r.WithContext(bitrise.ContextWithPAT(r.Context(), pat))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tc.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for unknown and expired sessions.
+var ErrNotFound = errors.New("session not found")
+
+// Session is the state of a streamable HTTP session shared between replicas.
+// What a session is subscribed to or its in-flight requests live in the
+// replica holding its connection.
+type Session struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	// Owner is the PAT fingerprint of the client that created the session,
+	// only the same client can use it.
+	Owner string `json:"owner,omitempty"`
+}
+
+// Store persists sessions.
+type Store interface {
+	Save(ctx context.Context, s Session) error
+	Get(ctx context.Context, id string) (Session, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// NewStore creates a store from its spec: "memory", or "dir:<path>".
+func NewStore(spec string) (Store, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return NewMemoryStore(), nil
+	case strings.HasPrefix(spec, "dir:"):
+		return NewDirStore(strings.TrimPrefix(spec, "dir:"))
+	}
+	return nil, fmt.Errorf("invalid session store %q: use memory or dir:<path>", spec)
+}
+
+// MemoryStore keeps sessions in memory, only the replica that created a
+// session knows it.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]Session
+	swept    time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now, sessions: map[string]Session{}}
+}
+
+func (s *MemoryStore) Save(_ context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	if !s.now().Before(session.Expires) {
+		delete(s.sessions, id)
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// sweep drops expired sessions, at most once a minute. Must be called with
+// s.mu held.
+func (s *MemoryStore) sweep() {
+	now := s.now()
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	for id, session := range s.sessions {
+		if !now.Before(session.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.swept = now
+}
+
+// DirStore keeps each session in a JSON file of a directory. Replicas
+// sharing the directory, e.g. on a shared volume, accept each other's
+// sessions.
+type DirStore struct {
+	dir string
+	now func() time.Time
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+// NewDirStore creates dir if it doesn't exist yet.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create session store: %w", err)
+	}
+	return &DirStore{dir: dir, now: time.Now}, nil
+}
+
+func (s *DirStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Save writes the session to a temporary file renamed over the previous
+// one, so other replicas never read a truncated file.
+func (s *DirStore) Save(_ context.Context, session Session) error {
+	s.sweep()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, session.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(session.ID)); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	return nil
+}
+
+func (s *DirStore) Get(_ context.Context, id string) (Session, error) {
+	session, err := s.read(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Session{}, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	if !s.now().Before(session.Expires) {
+		_ = os.Remove(s.path(id))
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *DirStore) Delete(_ context.Context, id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+func (s *DirStore) read(path string) (Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Session{}, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return Session{}, fmt.Errorf("parse session %s: %w", path, err)
+	}
+	return session, nil
+}
+
+// sweep removes the files of expired sessions, including those of replicas
+// that are gone, at most once a minute.
+func (s *DirStore) sweep() {
+	s.mu.Lock()
+	now := s.now()
+	if now.Sub(s.swept) < time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.swept = now
+	s.mu.Unlock()
+
+	paths, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	for _, path := range paths {
+		if session, err := s.read(path); err == nil && !now.Before(session.Expires) {
+			_ = os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	memory := NewMemoryStore()
+	memory.now = func() time.Time { return now }
+	dir, err := NewDirStore(filepath.Join(t.TempDir(), "sessions"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	dir.now = func() time.Time { return now }
+
+	for name, s := range map[string]Store{"memory": memory, "dir": dir} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, s.Save(t.Context(), Session{ID: "a", Created: now, Expires: now.Add(time.Minute)}))
+			assert.NoError(t, s.Save(t.Context(), Session{ID: "b", Created: now, Expires: now.Add(time.Second)}))
+
+			session, err := s.Get(t.Context(), "a")
+			assert.NoError(t, err)
+			assert.Equal(t, now.Add(time.Minute), session.Expires.UTC())
+
+			assert.NoError(t, s.Delete(t.Context(), "a"))
+			_, err = s.Get(t.Context(), "a")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.NoError(t, s.Delete(t.Context(), "a"), "deleting an unknown session is a no-op")
+
+			_, err = s.Get(t.Context(), "b")
+			assert.NoError(t, err)
+			now = now.Add(time.Second)
+			_, err = s.Get(t.Context(), "b")
+			assert.ErrorIs(t, err, ErrNotFound, "expired sessions aren't returned")
+		})
+	}
+}
+
+func TestDirStoreShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions")
+	a, _ := NewDirStore(path)
+	b, err := NewDirStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	expires := time.Now().Add(time.Hour)
+	assert.NoError(t, a.Save(t.Context(), Session{ID: "s", Expires: expires}))
+	assert.NoError(t, a.Save(t.Context(), Session{ID: "gone", Expires: time.Now().Add(-time.Second)}))
+
+	session, err := b.Get(t.Context(), "s")
+	assert.NoError(t, err)
+	assert.Equal(t, "s", session.ID)
+
+	info, err := os.Stat(filepath.Join(path, "s.json"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	b.sweep()
+	_, err = os.Stat(filepath.Join(path, "gone.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist, "expired sessions of any replica are swept")
+}
+
+func TestNewStore(t *testing.T) {
+	s, err := NewStore("memory")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, s)
+
+	s, err = NewStore("dir:" + t.TempDir())
+	assert.NoError(t, err)
+	assert.IsType(t, &DirStore{}, s)
+
+	_, err = NewStore("redis://localhost")
+	assert.Error(t, err)
+}
@@ -0,0 +1,240 @@
+// Package subscription polls the resources clients subscribed to and
+// notifies the subscribers when their status changes. Each resource is polled
+// once however many sessions subscribed to it, less often while its status
+// doesn't change, and is dropped once it finished.
+package subscription
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PollFunc reads the status of a resource with the context of one of its
+// subscribers. Finished resources don't change anymore.
+type PollFunc func(ctx context.Context, uri string) (status string, finished bool, err error)
+
+// NotifyFunc tells a session that a resource changed. An error drops the
+// session's subscription, e.g. when the session is gone.
+type NotifyFunc func(sessionID, uri string) error
+
+// Scheduler polls subscribed resources in the background until Close is
+// called.
+type Scheduler struct {
+	poll        PollFunc
+	notify      NotifyFunc
+	minInterval time.Duration
+	maxInterval time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	resources map[string]*resource
+
+	wake chan struct{}
+	stop chan struct{}
+	once sync.Once
+}
+
+type resource struct {
+	uri    string
+	status string
+	// subscribers are polled with the context of the first one, so the
+	// subscription ends with the credentials of the session that made it.
+	subscribers []subscriber
+	interval    time.Duration
+	next        time.Time
+	polling     bool
+}
+
+type subscriber struct {
+	sessionID string
+	ctx       context.Context
+}
+
+// NewScheduler starts polling subscribed resources every minInterval. The
+// interval grows up to maxInterval while a resource doesn't change or can't
+// be polled.
+func NewScheduler(poll PollFunc, notify NotifyFunc, minInterval, maxInterval time.Duration) *Scheduler {
+	s := newScheduler(poll, notify, minInterval, maxInterval)
+	go s.run()
+	return s
+}
+
+func newScheduler(poll PollFunc, notify NotifyFunc, minInterval, maxInterval time.Duration) *Scheduler {
+	return &Scheduler{
+		poll:        poll,
+		notify:      notify,
+		minInterval: minInterval,
+		maxInterval: max(minInterval, maxInterval),
+		now:         time.Now,
+		resources:   map[string]*resource{},
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Subscribe polls the resource with the subscriber's context, which checks
+// that the session can read it, and subscribes the session to its changes.
+// Resources that already finished are not polled, as they won't change.
+func (s *Scheduler) Subscribe(ctx context.Context, sessionID, uri string) error {
+	status, finished, err := s.poll(ctx, uri)
+	if err != nil {
+		return err
+	}
+	if finished {
+		return nil
+	}
+	// The request the subscription came with ends, its values don't.
+	sub := subscriber{sessionID: sessionID, ctx: context.WithoutCancel(ctx)}
+
+	s.mu.Lock()
+	r, ok := s.resources[uri]
+	if !ok {
+		r = &resource{uri: uri, status: status, interval: s.minInterval, next: s.now().Add(s.minInterval)}
+		s.resources[uri] = r
+	}
+	r.subscribers = append(removeSession(r.subscribers, sessionID), sub)
+	s.mu.Unlock()
+	s.signal()
+	return nil
+}
+
+// Unsubscribe ends the session's subscription to the resource.
+func (s *Scheduler) Unsubscribe(sessionID, uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.resources[uri]; ok {
+		s.unsubscribe(r, sessionID)
+	}
+}
+
+// EndSession ends every subscription of the session.
+func (s *Scheduler) EndSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.resources {
+		s.unsubscribe(r, sessionID)
+	}
+}
+
+// Close stops polling.
+func (s *Scheduler) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// unsubscribe must be called with mu held.
+func (s *Scheduler) unsubscribe(r *resource, sessionID string) {
+	r.subscribers = removeSession(r.subscribers, sessionID)
+	if len(r.subscribers) == 0 {
+		delete(s.resources, r.uri)
+	}
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) run() {
+	timer := time.NewTimer(s.maxInterval)
+	defer timer.Stop()
+	for {
+		due, wait := s.due()
+		for _, r := range due {
+			go s.pollResource(r)
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// due marks the resources due for polling as being polled and returns them
+// with the wait until the next one is due.
+func (s *Scheduler) due() ([]*resource, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	wait := s.maxInterval
+	var due []*resource
+	for _, r := range s.resources {
+		if r.polling {
+			continue
+		}
+		if d := r.next.Sub(now); d > 0 {
+			wait = min(wait, d)
+			continue
+		}
+		r.polling = true
+		due = append(due, r)
+	}
+	return due, wait
+}
+
+// pollResource polls a resource due for polling and notifies its
+// subscribers if its status changed.
+func (s *Scheduler) pollResource(r *resource) {
+	s.mu.Lock()
+	if s.resources[r.uri] != r || len(r.subscribers) == 0 {
+		// Every subscriber left since the resource was due.
+		r.polling = false
+		s.mu.Unlock()
+		return
+	}
+	ctx := r.subscribers[0].ctx
+	s.mu.Unlock()
+
+	status, finished, err := s.poll(ctx, r.uri)
+
+	s.mu.Lock()
+	r.polling = false
+	if s.resources[r.uri] != r {
+		// Every subscriber left while polling.
+		s.mu.Unlock()
+		return
+	}
+	var notify []string
+	switch {
+	case err != nil:
+		// Try the credentials of the next subscriber next time, the first
+		// one might have lost access.
+		r.subscribers = append(r.subscribers[1:], r.subscribers[0])
+		r.interval = min(r.interval*2, s.maxInterval)
+	case status != r.status || finished:
+		r.status = status
+		r.interval = s.minInterval
+		for _, sub := range r.subscribers {
+			notify = append(notify, sub.sessionID)
+		}
+	default:
+		r.interval = min(r.interval*3/2, s.maxInterval)
+	}
+	r.next = s.now().Add(r.interval)
+	if finished {
+		delete(s.resources, r.uri)
+	}
+	s.mu.Unlock()
+
+	for _, sessionID := range notify {
+		if err := s.notify(sessionID, r.uri); err != nil {
+			s.Unsubscribe(sessionID, r.uri)
+		}
+	}
+	s.signal()
+}
+
+func removeSession(subscribers []subscriber, sessionID string) []subscriber {
+	kept := subscribers[:0]
+	for _, sub := range subscribers {
+		if sub.sessionID != sessionID {
+			kept = append(kept, sub)
+		}
+	}
+	return kept
+}
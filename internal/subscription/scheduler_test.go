@@ -0,0 +1,193 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sessionKey struct{}
+
+type fakeResources struct {
+	status   map[string]string
+	finished map[string]bool
+	denied   map[string]bool // sessions without access
+	polls    []string        // session of every poll
+	notified []string        // "session uri" of every notification
+	gone     map[string]bool // sessions failing notifications
+}
+
+func newFakeResources() *fakeResources {
+	return &fakeResources{
+		status:   map[string]string{},
+		finished: map[string]bool{},
+		denied:   map[string]bool{},
+		gone:     map[string]bool{},
+	}
+}
+
+func (f *fakeResources) poll(ctx context.Context, uri string) (string, bool, error) {
+	sessionID, _ := ctx.Value(sessionKey{}).(string)
+	f.polls = append(f.polls, sessionID)
+	if f.denied[sessionID] {
+		return "", false, errors.New("forbidden")
+	}
+	return f.status[uri], f.finished[uri], nil
+}
+
+func (f *fakeResources) notify(sessionID, uri string) error {
+	if f.gone[sessionID] {
+		return errors.New("session not found")
+	}
+	f.notified = append(f.notified, sessionID+" "+uri)
+	return nil
+}
+
+func newTestScheduler(f *fakeResources, now *time.Time) *Scheduler {
+	s := newScheduler(f.poll, f.notify, 10*time.Second, time.Minute)
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func sessionContext(t *testing.T, sessionID string) context.Context {
+	return context.WithValue(t.Context(), sessionKey{}, sessionID)
+}
+
+// tick advances the clock and polls the resources that are due.
+func tick(s *Scheduler, now *time.Time, d time.Duration) int {
+	*now = now.Add(d)
+	due, _ := s.due()
+	for _, r := range due {
+		s.pollResource(r)
+	}
+	return len(due)
+}
+
+func TestSchedulerSharesPolls(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newFakeResources()
+	f.status["build"] = "in-progress"
+	s := newTestScheduler(f, &now)
+
+	assert.NoError(t, s.Subscribe(sessionContext(t, "a"), "a", "build"))
+	assert.NoError(t, s.Subscribe(sessionContext(t, "b"), "b", "build"))
+	assert.Equal(t, []string{"a", "b"}, f.polls, "every subscriber's access is checked")
+
+	f.polls = nil
+	assert.Equal(t, 1, tick(s, &now, 10*time.Second), "one poll for both subscribers")
+	assert.Equal(t, []string{"a"}, f.polls)
+	assert.Empty(t, f.notified, "unchanged status")
+
+	f.status["build"] = "on-hold"
+	assert.Equal(t, 0, tick(s, &now, 10*time.Second), "unchanged resources are polled less often")
+	assert.Equal(t, 1, tick(s, &now, 5*time.Second))
+	assert.Equal(t, []string{"a build", "b build"}, f.notified)
+
+	f.notified = nil
+	f.status["build"] = "success"
+	f.finished["build"] = true
+	assert.Equal(t, 1, tick(s, &now, 10*time.Second), "the interval is reset after a change")
+	assert.Equal(t, []string{"a build", "b build"}, f.notified)
+	assert.Equal(t, 0, tick(s, &now, time.Hour), "finished resources are unsubscribed")
+	assert.Empty(t, s.resources)
+}
+
+func TestSchedulerSubscribe(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newFakeResources()
+	f.status["running"] = "in-progress"
+	f.finished["done"] = true
+	f.denied["c"] = true
+	s := newTestScheduler(f, &now)
+
+	assert.Error(t, s.Subscribe(sessionContext(t, "c"), "c", "running"), "no access")
+	assert.NoError(t, s.Subscribe(sessionContext(t, "a"), "a", "done"))
+	assert.NotContains(t, s.resources, "done", "finished resources won't change")
+
+	assert.NoError(t, s.Subscribe(sessionContext(t, "a"), "a", "running"))
+	assert.NoError(t, s.Subscribe(sessionContext(t, "a"), "a", "running"))
+	assert.Len(t, s.resources["running"].subscribers, 1, "subscribing twice is a no-op")
+
+	s.Unsubscribe("a", "running")
+	assert.Empty(t, s.resources)
+	assert.Equal(t, 0, tick(s, &now, time.Hour))
+}
+
+func TestSchedulerDropsSubscribers(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newFakeResources()
+	f.status["build"] = "in-progress"
+	f.status["pipeline"] = "running"
+	s := newTestScheduler(f, &now)
+	for _, sessionID := range []string{"a", "b", "c"} {
+		assert.NoError(t, s.Subscribe(sessionContext(t, sessionID), sessionID, "build"))
+	}
+
+	// a lost access: the poll fails and the next one uses the credentials of b.
+	f.denied["a"] = true
+	f.polls = nil
+	assert.Equal(t, 1, tick(s, &now, 10*time.Second))
+	f.status["build"] = "on-hold"
+	assert.Equal(t, 1, tick(s, &now, 20*time.Second))
+	assert.Equal(t, []string{"a", "b"}, f.polls)
+	assert.Equal(t, []string{"b build", "c build", "a build"}, f.notified)
+
+	assert.NoError(t, s.Subscribe(sessionContext(t, "c"), "c", "pipeline"))
+	s.EndSession("c")
+	assert.Len(t, s.resources["build"].subscribers, 2)
+	assert.NotContains(t, s.resources, "pipeline")
+
+	f.gone["b"] = true
+	f.notified = nil
+	f.status["build"] = "in-progress"
+	assert.Equal(t, 1, tick(s, &now, 10*time.Second))
+	assert.Equal(t, []string{"a build"}, f.notified)
+	assert.Len(t, s.resources["build"].subscribers, 1, "subscribers failing notifications are dropped")
+}
+
+func TestSchedulerUnsubscribeWhileDue(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newFakeResources()
+	f.status["build"] = "in-progress"
+	s := newTestScheduler(f, &now)
+	assert.NoError(t, s.Subscribe(sessionContext(t, "a"), "a", "build"))
+
+	now = now.Add(10 * time.Second)
+	due, _ := s.due()
+	if !assert.Len(t, due, 1) {
+		return
+	}
+	s.EndSession("a")
+	f.polls = nil
+	assert.NotPanics(t, func() { s.pollResource(due[0]) })
+	assert.Empty(t, f.polls, "nobody left to poll for")
+	assert.Empty(t, s.resources)
+}
+
+func TestSchedulerRun(t *testing.T) {
+	var polls atomic.Int32
+	poll := func(context.Context, string) (string, bool, error) {
+		if polls.Add(1) == 1 {
+			return "in-progress", false, nil
+		}
+		return "success", true, nil
+	}
+	notified := make(chan string, 1)
+	s := NewScheduler(poll, func(sessionID, uri string) error {
+		notified <- sessionID + " " + uri
+		return nil
+	}, time.Millisecond, time.Millisecond)
+	t.Cleanup(s.Close)
+
+	assert.NoError(t, s.Subscribe(t.Context(), "a", "build"))
+	select {
+	case got := <-notified:
+		assert.Equal(t, "a build", got)
+	case <-time.After(time.Second):
+		t.Fatal("no notification")
+	}
+}
@@ -17,6 +17,7 @@ var Get = bitrise.Tool{
 			mcp.Description("Identifier of the Bitrise app"),
 			mcp.Required(),
 		),
+		bitrise.WithFields(),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(true),
@@ -28,14 +29,19 @@ var Get = bitrise.Tool{
 			return mcp.NewToolResultError(err.Error()), nil
 		}
 
+		projection, err := bitrise.ProjectionFromRequest(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s", appSlug),
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s", appSlug),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
-		return mcp.NewToolResultText(res), nil
+		return projection.ToolResult(res), nil
 	},
 }
@@ -29,12 +29,12 @@ var GetBitriseYML = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/bitrise.yml", appSlug),
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/bitrise.yml", appSlug),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -31,6 +31,9 @@ var List = bitrise.Tool{
 		mcp.WithString("project_type",
 			mcp.Description("Filter apps by project type (e.g., 'ios', 'android')"),
 		),
+		bitrise.WithFields(),
+		bitrise.WithWhere(),
+		bitrise.WithAllPages(),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(true),
@@ -51,15 +54,20 @@ var List = bitrise.Tool{
 			params["project_type"] = v
 		}
 
-		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    "/apps",
-			Params:  params,
+		projection, err := bitrise.ProjectionFromRequest(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		res, err := bitrise.CallAPIPaginated(ctx, request, bitrise.CursorPaging, bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   "/apps",
+			Params: params,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
-		return mcp.NewToolResultText(res), nil
+		return projection.ToolResult(res), nil
 	},
 }
@@ -29,12 +29,12 @@ var ListBranches = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/branches", appSlug),
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/branches", appSlug),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
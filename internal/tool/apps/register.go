@@ -76,13 +76,13 @@ var Register = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    "/apps/register",
-			Body:    body,
+			Method: http.MethodPost,
+			API:    bitrise.APIMain,
+			Path:   "/apps/register",
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
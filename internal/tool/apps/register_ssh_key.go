@@ -56,13 +56,13 @@ var RegisterSSHKey = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/register-ssh-key", appSlug),
-			Body:    body,
+			Method: http.MethodPost,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/register-ssh-key", appSlug),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
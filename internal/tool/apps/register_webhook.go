@@ -29,12 +29,12 @@ var RegisterWebhook = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/register-webhook", appSlug),
+			Method: http.MethodPost,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/register-webhook", appSlug),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
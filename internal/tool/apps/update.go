@@ -51,13 +51,13 @@ var Update = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPatch,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s", appSlug),
-			Body:    body,
+			Method: http.MethodPatch,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s", appSlug),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
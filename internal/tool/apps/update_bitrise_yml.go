@@ -37,15 +37,15 @@ var UpdateBitriseYML = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/bitrise.yml", appSlug),
+			Method: http.MethodPost,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/bitrise.yml", appSlug),
 			Body: map[string]any{
 				"app_config_datastore_yaml": ymlContent,
 			},
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -28,6 +28,9 @@ var List = bitrise.Tool{
 		mcp.WithNumber("limit",
 			mcp.Description("Max number of elements per page (default: 50)"),
 		),
+		bitrise.WithFields(),
+		bitrise.WithWhere(),
+		bitrise.WithAllPages(),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(true),
@@ -51,15 +54,20 @@ var List = bitrise.Tool{
 			params["limit"] = strconv.Itoa(request.GetInt("limit", 50))
 		}
 
-		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/builds/%s/artifacts", appSlug, buildSlug),
-			Params:  params,
+		projection, err := bitrise.ProjectionFromRequest(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		res, err := bitrise.CallAPIPaginated(ctx, request, bitrise.CursorPaging, bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/builds/%s/artifacts", appSlug, buildSlug),
+			Params: params,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
-		return mcp.NewToolResultText(res), nil
+		return projection.ToolResult(res), nil
 	},
 }
@@ -1,6 +1,7 @@
 package tool
 
 import (
+	"maps"
 	"slices"
 
 	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
@@ -16,9 +17,24 @@ import (
 	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool/user"
 	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool/webhooks"
 	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool/workspaces"
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
+// groupAliases maps the documented names of API groups to the names the
+// tools use.
+var groupAliases = map[string]string{ //nolint:gochecknoglobals
+	"account": "user",
+}
+
+// apiGroup resolves an alias of an API group.
+func apiGroup(name string) string {
+	if group, ok := groupAliases[name]; ok {
+		return group
+	}
+	return name
+}
+
 type Belt struct {
 	tools map[string]bitrise.Tool
 }
@@ -50,6 +66,7 @@ func NewBelt() *Belt {
 		builds.GetBuildLog,
 		builds.GetBuildBitriseYML,
 		builds.ListBuildWorkflows,
+		builds.WaitFor,
 
 		// Artifacts
 		artifacts.List,
@@ -83,6 +100,7 @@ func NewBelt() *Belt {
 		pipelines.Get,
 		pipelines.Abort,
 		pipelines.Rebuild,
+		pipelines.WaitFor,
 
 		// Group Roles
 		grouproles.List,
@@ -137,21 +155,63 @@ func NewBelt() *Belt {
 	return belt
 }
 
-func (b *Belt) RegisterAll(server *server.MCPServer) {
+// RegisterAll adds every tool to the server. With confirmDestructive,
+// destructive tools get the confirmation_token argument.
+func (b *Belt) RegisterAll(server *server.MCPServer, confirmDestructive bool) {
 	for _, tool := range b.tools {
-		server.AddTool(tool.Definition, tool.Handler)
+		definition := tool.Definition
+		if confirmDestructive && b.Destructive(definition.Name) {
+			definition = withConfirmationToken(definition)
+		}
+		server.AddTool(definition, tool.Handler)
 	}
 }
 
+// withConfirmationToken adds the confirmation_token argument used by the
+// two-step confirmation of destructive tools.
+func withConfirmationToken(definition mcp.Tool) mcp.Tool {
+	properties := maps.Clone(definition.InputSchema.Properties)
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	definition.InputSchema.Properties = properties
+	mcp.WithString("confirmation_token",
+		mcp.Description("Token returned by a previous call of this tool when the server requires confirmation. Only pass it after the user explicitly confirmed the action."),
+	)(&definition)
+	return definition
+}
+
 func (b *Belt) ToolEnabled(name string, enabledGroups []string) bool {
 	tool, ok := b.tools[name]
 	if !ok {
 		return false
 	}
 	for _, enabledGroup := range enabledGroups {
-		if slices.Contains(tool.APIGroups, enabledGroup) {
+		if slices.Contains(tool.APIGroups, apiGroup(enabledGroup)) {
 			return true
 		}
 	}
 	return false
 }
+
+// LongRunning reports whether the tool waits for something to happen.
+func (b *Belt) LongRunning(name string) bool {
+	return b.tools[name].LongRunning
+}
+
+// Destructive reports whether the tool is annotated as potentially
+// destructive.
+func (b *Belt) Destructive(name string) bool {
+	tool, ok := b.tools[name]
+	if !ok {
+		return false
+	}
+	hint := tool.Definition.Annotations.DestructiveHint
+	return hint != nil && *hint
+}
+
+// Definition returns the definition of the tool.
+func (b *Belt) Definition(name string) (mcp.Tool, bool) {
+	tool, ok := b.tools[name]
+	return tool.Definition, ok
+}
@@ -63,13 +63,13 @@ var Abort = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/builds/%s/abort", appSlug, buildSlug),
-			Body:    body,
+			Method: http.MethodPost,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/builds/%s/abort", appSlug, buildSlug),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -25,6 +25,7 @@ var Get = bitrise.Tool{
 		mcp.WithBoolean("verbose",
 			mcp.Description("Include all build details. Default: false"),
 		),
+		bitrise.WithFields(),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(true),
@@ -40,13 +41,18 @@ var Get = bitrise.Tool{
 			return mcp.NewToolResultError(err.Error()), nil
 		}
 
+		projection, err := bitrise.ProjectionFromRequest(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/builds/%s", appSlug, buildSlug),
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/builds/%s", appSlug, buildSlug),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 
 		var response map[string]any
@@ -79,6 +85,6 @@ var Get = bitrise.Tool{
 			}
 		}
 
-		return mcp.NewToolResultStructuredOnly(response), nil
+		return mcp.NewToolResultStructuredOnly(projection.Apply(response)), nil
 	},
 }
@@ -11,6 +11,8 @@ import (
 
 	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
 	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type GetBuildLogResponse struct {
@@ -64,24 +66,11 @@ var GetBuildLog = bitrise.Tool{
 			return mcp.NewToolResultError("limit must be greater than 0"), nil
 		}
 
-		path := fmt.Sprintf("/apps/%s/builds/%s/log", appSlug, buildSlug)
-		if stepUUID != "" {
-			path += fmt.Sprintf("/steps/%s", stepUUID)
-		}
-		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    path,
-		})
+		res, err := callLogAPI(ctx, appSlug, buildSlug, stepUUID)
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
-		}
-
-		logGetter := getFullLog
-		if stepUUID != "" {
-			logGetter = getStepLog
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
-		log, err := logGetter(res)
+		log, err := readLog(ctx, res, stepUUID)
 		if err != nil {
 			return mcp.NewToolResultErrorFromErr("get log", err), nil
 		}
@@ -90,7 +79,40 @@ var GetBuildLog = bitrise.Tool{
 	},
 }
 
-func getFullLog(resBitriseRaw string) (string, error) {
+// FetchLog returns the full log of a build, or of one of its steps if
+// stepUUID is set.
+func FetchLog(ctx context.Context, appSlug, buildSlug, stepUUID string) (string, error) {
+	res, err := callLogAPI(ctx, appSlug, buildSlug, stepUUID)
+	if err != nil {
+		return "", fmt.Errorf("call api: %w", err)
+	}
+	log, err := readLog(ctx, res, stepUUID)
+	if err != nil {
+		return "", fmt.Errorf("get log: %w", err)
+	}
+	return log, nil
+}
+
+func callLogAPI(ctx context.Context, appSlug, buildSlug, stepUUID string) (string, error) {
+	path := fmt.Sprintf("/apps/%s/builds/%s/log", appSlug, buildSlug)
+	if stepUUID != "" {
+		path += fmt.Sprintf("/steps/%s", stepUUID)
+	}
+	return bitrise.CallAPI(ctx, bitrise.CallAPIParams{
+		Method: http.MethodGet,
+		API:    bitrise.APIMain,
+		Path:   path,
+	})
+}
+
+func readLog(ctx context.Context, res, stepUUID string) (string, error) {
+	if stepUUID != "" {
+		return getStepLog(ctx, res)
+	}
+	return getFullLog(ctx, res)
+}
+
+func getFullLog(ctx context.Context, resBitriseRaw string) (string, error) {
 	var resBitrise struct {
 		URL       string `json:"expiring_raw_log_url"`
 		LogChunks []struct {
@@ -118,14 +140,14 @@ func getFullLog(resBitriseRaw string) (string, error) {
 		}
 		return log, nil
 	}
-	log, err := httpGet(resBitrise.URL)
+	log, err := httpGet(ctx, resBitrise.URL)
 	if err != nil {
 		return "", fmt.Errorf("get raw log: %w", err)
 	}
 	return log, nil
 }
 
-func getStepLog(resBitriseRaw string) (string, error) {
+func getStepLog(ctx context.Context, resBitriseRaw string) (string, error) {
 	var resBitrise struct {
 		URL string `json:"expiring_raw_log_url"`
 	}
@@ -136,7 +158,7 @@ func getStepLog(resBitriseRaw string) (string, error) {
 		return "[incomplete log: processing is still ongoing]", nil
 	}
 
-	rawLog, err := httpGet(resBitrise.URL)
+	rawLog, err := httpGet(ctx, resBitrise.URL)
 	if err != nil {
 		return "", fmt.Errorf("get step raw log: %w", err)
 	}
@@ -153,13 +175,24 @@ func getStepLog(resBitriseRaw string) (string, error) {
 	return log, nil
 }
 
-func httpGet(url string) (string, error) {
+func httpGet(ctx context.Context, url string) (_ string, err error) {
+	// The URL is pre-signed, so only its host is recorded.
+	ctx, span := bitrise.Tracer().Start(ctx, "bitrise.log_download", trace.WithSpanKind(trace.SpanKindClient))
+	var status int
+	defer func() { bitrise.EndSpan(span, status, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	span.SetAttributes(attribute.String("http.request.method", http.MethodGet), attribute.String("server.address", req.URL.Host))
 	httpClient := http.Client{Timeout: 15 * time.Second}
-	resLog, err := httpClient.Get(url)
+	resLog, err := httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("http get: %w", err)
 	}
 	defer resLog.Body.Close()
+	status = resLog.StatusCode
 	if resLog.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("http status code %d", resLog.StatusCode)
 	}
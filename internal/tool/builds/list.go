@@ -42,6 +42,9 @@ var List = bitrise.Tool{
 		mcp.WithBoolean("verbose",
 			mcp.Description("Include all build details. Default: false"),
 		),
+		bitrise.WithFields(),
+		bitrise.WithWhere(),
+		bitrise.WithAllPages(),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(true),
@@ -74,14 +77,19 @@ var List = bitrise.Tool{
 			path = fmt.Sprintf("/apps/%s/builds", appSlug)
 		}
 
-		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    path,
-			Params:  params,
+		projection, err := bitrise.ProjectionFromRequest(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		res, err := bitrise.CallAPIPaginated(ctx, request, bitrise.CursorPaging, bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   path,
+			Params: params,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 
 		var response map[string]any
@@ -140,6 +148,6 @@ var List = bitrise.Tool{
 			}
 		}
 
-		return mcp.NewToolResultStructuredOnly(response), nil
+		return mcp.NewToolResultStructuredOnly(projection.Apply(response)), nil
 	},
 }
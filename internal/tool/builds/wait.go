@@ -0,0 +1,189 @@
+package builds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// summaryFields are the fields of a build kept in the summary of
+// wait_for_build.
+var summaryFields = []string{ //nolint:gochecknoglobals
+	"slug",
+	"build_number",
+	"status_text",
+	"abort_reason",
+	"triggered_workflow",
+	"branch",
+	"commit_hash",
+	"triggered_at",
+	"started_on_worker_at",
+	"finished_at",
+}
+
+var WaitFor = bitrise.Tool{
+	APIGroups:   []string{"builds", "read-only"},
+	LongRunning: true,
+	Definition: mcp.NewTool("wait_for_build",
+		mcp.WithDescription("Wait until a build finishes, e.g. after trigger_bitrise_build, instead of polling get_build. Sends progress notifications with the latest step while waiting. Returns a summary of the build with its failed steps, whose logs can be read with get_build_log. If the build doesn't finish in time, returns its current status with timed_out set; call again to keep waiting."),
+		mcp.WithString("app_slug",
+			mcp.Description("Identifier of the Bitrise app"),
+			mcp.Required(),
+		),
+		mcp.WithString("build_slug",
+			mcp.Description("Identifier of the build"),
+			mcp.Required(),
+		),
+		bitrise.WithWaitTimeout(),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(true),
+	),
+	Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		appSlug, err := request.RequireString("app_slug")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		buildSlug, err := request.RequireString("build_slug")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		var build map[string]any
+		// The step summary is only fetched again when the build changed.
+		var lastBuild, lastProgress string
+		finished, err := bitrise.Wait(ctx, request, func(ctx context.Context) (bitrise.WaitState, error) {
+			res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
+				Method: http.MethodGet,
+				API:    bitrise.APIMain,
+				Path:   fmt.Sprintf("/apps/%s/builds/%s", appSlug, buildSlug),
+			})
+			if err != nil {
+				return bitrise.WaitState{}, err
+			}
+			var response struct {
+				Data map[string]any `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(res), &response); err != nil {
+				return bitrise.WaitState{}, fmt.Errorf("unmarshal build: %w", err)
+			}
+			build = response.Data
+			// status is 0 while the build is not finished.
+			if status, _ := build["status"].(float64); status != 0 {
+				return bitrise.WaitState{Finished: true}, nil
+			}
+			if res == lastBuild {
+				return bitrise.WaitState{Progress: lastProgress}, nil
+			}
+			progress, _ := build["status_text"].(string)
+			// The step summary isn't available until the build starts.
+			if steps, err := stepSummary(ctx, appSlug, buildSlug); err == nil {
+				if step := latestStep(steps); step != "" {
+					progress = fmt.Sprintf("%s, step %q", progress, step)
+				}
+			}
+			lastBuild, lastProgress = res, progress
+			return bitrise.WaitState{Progress: progress}, nil
+		})
+		if err != nil {
+			return bitrise.NewToolResultErrorFromErr("wait for build", err), nil
+		}
+
+		summary := map[string]any{}
+		for _, field := range summaryFields {
+			if v, ok := build[field]; ok && v != nil && v != "" {
+				summary[field] = v
+			}
+		}
+		if duration := buildDuration(build); duration > 0 {
+			summary["duration"] = duration.String()
+		}
+		if !finished {
+			summary["timed_out"] = true
+		}
+		// status 2 is failed.
+		if status, _ := build["status"].(float64); status == 2 {
+			failed, err := FailedSteps(ctx, appSlug, buildSlug)
+			if err != nil {
+				summary["failed_steps_error"] = err.Error()
+			} else {
+				summary["failed_steps"] = failed
+			}
+		}
+		return mcp.NewToolResultStructuredOnly(summary), nil
+	},
+}
+
+// FailedSteps returns the title and UUID of the failed steps of a build.
+func FailedSteps(ctx context.Context, appSlug, buildSlug string) ([]map[string]any, error) {
+	steps, err := stepSummary(ctx, appSlug, buildSlug)
+	if err != nil {
+		return nil, err
+	}
+	failed := []map[string]any{}
+	for _, step := range steps {
+		if step["status"] == "failed" {
+			failed = append(failed, map[string]any{"title": step["title"], "uuid": step["uuid"]})
+		}
+	}
+	return failed, nil
+}
+
+// stepSummary returns the steps of a build in the order they ran, across
+// its workflows.
+func stepSummary(ctx context.Context, appSlug, buildSlug string) ([]map[string]any, error) {
+	res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
+		Method: http.MethodGet,
+		API:    bitrise.APIMain,
+		Path:   fmt.Sprintf("/apps/%s/builds/%s/log/summary", appSlug, buildSlug),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var summary struct {
+		Execution struct {
+			Workflows []struct {
+				Steps []map[string]any `json:"steps"`
+			} `json:"workflows"`
+		} `json:"execution"`
+	}
+	if err := json.Unmarshal([]byte(res), &summary); err != nil {
+		return nil, fmt.Errorf("unmarshal step summary: %w", err)
+	}
+	var steps []map[string]any
+	for _, workflow := range summary.Execution.Workflows {
+		steps = append(steps, workflow.Steps...)
+	}
+	return steps, nil
+}
+
+// latestStep returns the title of the step that started last.
+func latestStep(steps []map[string]any) string {
+	if len(steps) == 0 {
+		return ""
+	}
+	title, _ := steps[len(steps)-1]["title"].(string)
+	return title
+}
+
+// buildDuration returns how long a finished build ran on its worker, 0 if
+// it's unknown.
+func buildDuration(build map[string]any) time.Duration {
+	started, _ := build["started_on_worker_at"].(string)
+	finished, _ := build["finished_at"].(string)
+	start, err := time.Parse(time.RFC3339, started)
+	if err != nil {
+		return 0
+	}
+	end, err := time.Parse(time.RFC3339, finished)
+	if err != nil {
+		return 0
+	}
+	return end.Sub(start).Round(time.Second)
+}
@@ -0,0 +1,109 @@
+package builds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *testSession) Initialize()       {}
+func (s *testSession) Initialized() bool { return true }
+func (s *testSession) SessionID() string { return "test" }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestWaitFor(t *testing.T) {
+	policy := bitrise.WaitPollPolicy
+	bitrise.WaitPollPolicy = bitrise.WaitPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+		DefaultTimeout:  time.Minute,
+		MaxTimeout:      time.Minute,
+	}
+	t.Cleanup(func() { bitrise.WaitPollPolicy = policy })
+
+	var polls, summaries atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apps/app1/builds/build1":
+			if polls.Add(1) < 3 {
+				fmt.Fprint(w, `{"data":{"slug":"build1","status":0,"status_text":"in-progress"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"data":{"slug":"build1","build_number":42,"status":2,"status_text":"error","triggered_workflow":"primary","commit_hash":"","started_on_worker_at":"2025-01-01T12:00:00Z","finished_at":"2025-01-01T12:03:30Z","credit_cost":4}}`)
+		case "/apps/app1/builds/build1/log/summary":
+			summaries.Add(1)
+			fmt.Fprint(w, `{"execution":{"workflows":[{"steps":[
+				{"uuid":"step1","title":"Clone","status":"success"},
+				{"uuid":"step2","title":"Test","status":"failed"}
+			]}]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(api.Close)
+
+	s := server.NewMCPServer("test", "1", server.WithToolCapabilities(false))
+	s.AddTool(WaitFor.Definition, WaitFor.Handler)
+	session := &testSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	ctx := s.WithContext(t.Context(), session)
+	ctx = bitrise.ContextWithPAT(ctx, "pat")
+	ctx = bitrise.ContextWithBaseURLs(ctx, bitrise.BaseURLs{API: api.URL})
+
+	message, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]any{
+			"name":      "wait_for_build",
+			"arguments": map[string]any{"app_slug": "app1", "build_slug": "build1"},
+			"_meta":     map[string]any{"progressToken": "token1"},
+		},
+	})
+	res, ok := s.HandleMessage(ctx, message).(mcp.JSONRPCResponse)
+	if !assert.True(t, ok) {
+		return
+	}
+	result, ok := res.Result.(mcp.CallToolResult)
+	if !assert.True(t, ok) || !assert.False(t, result.IsError) {
+		return
+	}
+	assert.Equal(t, map[string]any{
+		"slug":                 "build1",
+		"build_number":         float64(42),
+		"status_text":          "error",
+		"triggered_workflow":   "primary",
+		"started_on_worker_at": "2025-01-01T12:00:00Z",
+		"finished_at":          "2025-01-01T12:03:30Z",
+		"duration":             "3m30s",
+		"failed_steps":         []map[string]any{{"title": "Test", "uuid": "step2"}},
+	}, result.StructuredContent)
+
+	assert.Equal(t, int32(2), summaries.Load(), "the step summary is fetched when the build changed and for the failed steps")
+
+	close(session.notifications)
+	var messages []string
+	for notification := range session.notifications {
+		assert.Equal(t, "notifications/progress", notification.Method)
+		assert.Equal(t, "token1", notification.Params.AdditionalFields["progressToken"])
+		messages = append(messages, notification.Params.AdditionalFields["message"].(string))
+	}
+	if assert.Len(t, messages, 3) {
+		assert.Contains(t, messages[0], `in-progress, step "Test", `)
+		assert.Contains(t, messages[2], "elapsed")
+	}
+}
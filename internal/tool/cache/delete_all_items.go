@@ -29,12 +29,12 @@ var DeleteAllItems = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodDelete,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/cache", appSlug),
+			Method: http.MethodDelete,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/cache", appSlug),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -0,0 +1,40 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// CallFunc calls a tool by name.
+type CallFunc func(ctx context.Context, name string, arguments map[string]any) (*mcp.CallToolResult, error)
+
+// ServerCaller calls tools through the tools/call handling of the server, so
+// the tool middlewares apply as to the client's own calls: credentials,
+// enabled tools, safety mode and rate limits.
+func ServerCaller(s *server.MCPServer) CallFunc {
+	return func(ctx context.Context, name string, arguments map[string]any) (*mcp.CallToolResult, error) {
+		message, err := json.Marshal(map[string]any{
+			"jsonrpc": mcp.JSONRPC_VERSION,
+			"id":      0,
+			"method":  string(mcp.MethodToolsCall),
+			"params":  map[string]any{"name": name, "arguments": arguments},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("marshal tool call: %w", err)
+		}
+		switch res := s.HandleMessage(ctx, message).(type) {
+		case mcp.JSONRPCResponse:
+			if result, ok := res.Result.(mcp.CallToolResult); ok {
+				return &result, nil
+			}
+		case mcp.JSONRPCError:
+			return nil, errors.New(res.Error.Message)
+		}
+		return nil, fmt.Errorf("unexpected response calling %s", name)
+	}
+}
@@ -29,13 +29,13 @@ var StepInputs = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    "/step-inputs",
-			Params:  map[string]any{"step_ref": query},
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   "/step-inputs",
+			Params: map[string]any{"step_ref": query},
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -40,9 +40,9 @@ var StepSearch = bitrise.Tool{
 		maintainers := request.GetStringSlice("maintainers", []string{})
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    "/search-steps",
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   "/search-steps",
 			Params: map[string]any{
 				"query":       query,
 				"categories":  categories,
@@ -50,7 +50,7 @@ var StepSearch = bitrise.Tool{
 			},
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
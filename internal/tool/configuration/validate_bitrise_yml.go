@@ -31,15 +31,15 @@ var ValidateBitriseYML = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    "/validate-bitrise-yml",
+			Method: http.MethodPost,
+			API:    bitrise.APIMain,
+			Path:   "/validate-bitrise-yml",
 			Body: map[string]any{
 				"bitrise_yml": ymlContent, // CallAPI adds Content-Type: application/json so have to use that format
 			},
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -46,15 +46,15 @@ var Replace = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPut,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/roles/%s", appSlug, roleName),
+			Method: http.MethodPut,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/roles/%s", appSlug, roleName),
 			Body: map[string]any{
 				"groups": groupSlugs,
 			},
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -54,6 +54,9 @@ var List = bitrise.Tool{
 		mcp.WithBoolean("verbose",
 			mcp.Description("Include all pipeline details. Default: false"),
 		),
+		bitrise.WithFields(),
+		bitrise.WithWhere(),
+		bitrise.WithAllPages(),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(true),
@@ -97,14 +100,19 @@ var List = bitrise.Tool{
 			params["workflow"] = v
 		}
 
-		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/pipelines", appSlug),
-			Params:  params,
+		projection, err := bitrise.ProjectionFromRequest(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		res, err := bitrise.CallAPIPaginated(ctx, request, bitrise.CursorPaging, bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/pipelines", appSlug),
+			Params: params,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 
 		var response map[string]any
@@ -140,6 +148,6 @@ var List = bitrise.Tool{
 			}
 		}
 
-		return mcp.NewToolResultStructuredOnly(response), nil
+		return mcp.NewToolResultStructuredOnly(projection.Apply(response)), nil
 	},
 }
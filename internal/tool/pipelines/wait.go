@@ -0,0 +1,135 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool/builds"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var WaitFor = bitrise.Tool{
+	APIGroups:   []string{"pipelines", "read-only"},
+	LongRunning: true,
+	Definition: mcp.NewTool("wait_for_pipeline",
+		mcp.WithDescription("Wait until a pipeline finishes, e.g. after trigger_bitrise_build or rebuild_pipeline, instead of polling get_pipeline. Sends progress notifications with the running workflows while waiting. Returns a summary of the pipeline with the status of its workflows and the failed steps of its failed workflows, whose logs can be read with get_build_log. If the pipeline doesn't finish in time, returns its current status with timed_out set; call again to keep waiting."),
+		mcp.WithString("app_slug",
+			mcp.Description("Identifier of the Bitrise app"),
+			mcp.Required(),
+		),
+		mcp.WithString("pipeline_id",
+			mcp.Description("Identifier of the pipeline"),
+			mcp.Required(),
+		),
+		bitrise.WithWaitTimeout(),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(true),
+	),
+	Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		appSlug, err := request.RequireString("app_slug")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		pipelineID, err := request.RequireString("pipeline_id")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		var pipeline map[string]any
+		finished, err := bitrise.Wait(ctx, request, func(ctx context.Context) (bitrise.WaitState, error) {
+			res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
+				Method: http.MethodGet,
+				API:    bitrise.APIMain,
+				Path:   fmt.Sprintf("/apps/%s/pipelines/%s", appSlug, pipelineID),
+			})
+			if err != nil {
+				return bitrise.WaitState{}, err
+			}
+			var response map[string]any
+			if err := json.Unmarshal([]byte(res), &response); err != nil {
+				return bitrise.WaitState{}, fmt.Errorf("unmarshal pipeline: %w", err)
+			}
+			pipeline = response
+			status, _ := pipeline["status"].(string)
+			if Finished(status) {
+				return bitrise.WaitState{Finished: true}, nil
+			}
+			progress := status
+			if running := workflowNames(pipeline, "running"); len(running) > 0 {
+				progress = fmt.Sprintf("%s, workflows %s", progress, strings.Join(running, ", "))
+			}
+			return bitrise.WaitState{Progress: progress}, nil
+		})
+		if err != nil {
+			return bitrise.NewToolResultErrorFromErr("wait for pipeline", err), nil
+		}
+
+		summary := map[string]any{}
+		for field, v := range pipeline {
+			switch v.(type) {
+			case string, float64, bool:
+				summary[field] = v
+			}
+		}
+		// Same noise as dropped by get_pipeline.
+		delete(summary, "number_in_app_scope")
+		delete(summary, "put_on_hold_at")
+		delete(summary, "credit_cost")
+		if !finished {
+			summary["timed_out"] = true
+		}
+
+		workflows, _ := pipeline["workflows"].([]any)
+		compact := make([]map[string]any, 0, len(workflows))
+		for _, wf := range workflows {
+			workflow, ok := wf.(map[string]any)
+			if !ok {
+				continue
+			}
+			item := map[string]any{"name": workflow["name"], "status": workflow["status"]}
+			// Each workflow of a pipeline runs as a build, whose slug is the
+			// workflow's id.
+			if id, _ := workflow["id"].(string); id != "" {
+				item["build_slug"] = id
+				if workflow["status"] == "failed" {
+					if failed, err := builds.FailedSteps(ctx, appSlug, id); err == nil {
+						item["failed_steps"] = failed
+					}
+				}
+			}
+			compact = append(compact, item)
+		}
+		summary["workflows"] = compact
+		return mcp.NewToolResultStructuredOnly(summary), nil
+	},
+}
+
+// Finished reports whether a pipeline with this status has finished.
+func Finished(status string) bool {
+	switch status {
+	case "succeeded", "failed", "aborted", "succeeded_with_abort":
+		return true
+	}
+	return false
+}
+
+// workflowNames returns the names of the workflows of a pipeline with the
+// given status.
+func workflowNames(pipeline map[string]any, status string) []string {
+	workflows, _ := pipeline["workflows"].([]any)
+	var names []string
+	for _, wf := range workflows {
+		if workflow, ok := wf.(map[string]any); ok && workflow["status"] == status {
+			if name, ok := workflow["name"].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -50,13 +50,13 @@ var AddTestersToTesterGroup = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APIRMBaseURL,
-			Path:    fmt.Sprintf("/connected-apps/%s/tester-groups/%s/add-testers", connectedAppID, id),
-			Body:    body,
+			Method: http.MethodPost,
+			API:    bitrise.APIRM,
+			Path:   fmt.Sprintf("/connected-apps/%s/tester-groups/%s/add-testers", connectedAppID, id),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -47,13 +47,13 @@ var CreateDeployment = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    "/deployments",
-			Body:    body,
+			Method: http.MethodPost,
+			API:    bitrise.APICodePush,
+			Path:   "/deployments",
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
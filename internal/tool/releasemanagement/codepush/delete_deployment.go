@@ -29,12 +29,12 @@ var DeleteDeployment = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodDelete,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    fmt.Sprintf("/deployments/%s", id),
+			Method: http.MethodDelete,
+			API:    bitrise.APICodePush,
+			Path:   fmt.Sprintf("/deployments/%s", id),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -96,13 +96,13 @@ var GenerateUpdateUploadURL = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    fmt.Sprintf("/updates/%s/upload-url", id),
-			Params:  params,
+			Method: http.MethodGet,
+			API:    bitrise.APICodePush,
+			Path:   fmt.Sprintf("/updates/%s/upload-url", id),
+			Params: params,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
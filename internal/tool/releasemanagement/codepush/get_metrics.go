@@ -28,13 +28,13 @@ var GetMetrics = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    "/metrics",
-			Params:  map[string]any{"workspace_slug": workspaceSlug},
+			Method: http.MethodGet,
+			API:    bitrise.APICodePush,
+			Path:   "/metrics",
+			Params: map[string]any{"workspace_slug": workspaceSlug},
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
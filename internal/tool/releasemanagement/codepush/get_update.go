@@ -29,12 +29,12 @@ var GetUpdate = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    fmt.Sprintf("/updates/%s", id),
+			Method: http.MethodGet,
+			API:    bitrise.APICodePush,
+			Path:   fmt.Sprintf("/updates/%s", id),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -28,6 +28,9 @@ var ListUpdates = bitrise.Tool{
 			mcp.Description("Page number to return from the paginated result set. Default value is 1."),
 			mcp.DefaultNumber(1),
 		),
+		bitrise.WithFields(),
+		bitrise.WithWhere(),
+		bitrise.WithAllPages(),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(true),
@@ -52,15 +55,20 @@ var ListUpdates = bitrise.Tool{
 			params["page"] = strconv.Itoa(v)
 		}
 
-		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    "/updates",
-			Params:  params,
+		projection, err := bitrise.ProjectionFromRequest(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		res, err := bitrise.CallAPIPaginated(ctx, request, bitrise.PageNumberPaging, bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			API:    bitrise.APICodePush,
+			Path:   "/updates",
+			Params: params,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
-		return mcp.NewToolResultText(res), nil
+		return projection.ToolResult(res), nil
 	},
 }
@@ -52,13 +52,13 @@ var PatchUpdate = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPatch,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    fmt.Sprintf("/updates/%s", id),
-			Body:    body,
+			Method: http.MethodPatch,
+			API:    bitrise.APICodePush,
+			Path:   fmt.Sprintf("/updates/%s", id),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -37,13 +37,13 @@ var RollbackDeployment = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    fmt.Sprintf("/deployments/%s/rollback", id),
-			Body:    body,
+			Method: http.MethodPost,
+			API:    bitrise.APICodePush,
+			Path:   fmt.Sprintf("/deployments/%s/rollback", id),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
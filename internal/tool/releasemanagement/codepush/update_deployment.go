@@ -37,13 +37,13 @@ var UpdateDeployment = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPatch,
-			BaseURL: bitrise.APICodePushBaseURL,
-			Path:    fmt.Sprintf("/deployments/%s", id),
-			Body:    map[string]any{"name": name},
+			Method: http.MethodPatch,
+			API:    bitrise.APICodePush,
+			Path:   fmt.Sprintf("/deployments/%s", id),
+			Body:   map[string]any{"name": name},
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
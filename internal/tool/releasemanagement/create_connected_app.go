@@ -82,13 +82,13 @@ var CreateConnectedApp = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPost,
-			BaseURL: bitrise.APIRMBaseURL,
-			Path:    "/connected-apps",
-			Body:    body,
+			Method: http.MethodPost,
+			API:    bitrise.APIRM,
+			Path:   "/connected-apps",
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
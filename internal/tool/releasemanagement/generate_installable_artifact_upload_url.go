@@ -77,13 +77,13 @@ var GenerateInstallableArtifactUploadURL = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIRMBaseURL,
-			Path:    fmt.Sprintf("/connected-apps/%s/installable-artifacts/%s/upload-url", connectedAppID, installableArtifactID),
-			Params:  params,
+			Method: http.MethodGet,
+			API:    bitrise.APIRM,
+			Path:   fmt.Sprintf("/connected-apps/%s/installable-artifacts/%s/upload-url", connectedAppID, installableArtifactID),
+			Params: params,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
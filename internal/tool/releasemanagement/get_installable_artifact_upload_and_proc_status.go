@@ -37,12 +37,12 @@ var GetInstallableArtifactUploadAndProcessingStatus = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIRMBaseURL,
-			Path:    fmt.Sprintf("/connected-apps/%s/installable-artifacts/%s/status", connectedAppID, installableArtifactID),
+			Method: http.MethodGet,
+			API:    bitrise.APIRM,
+			Path:   fmt.Sprintf("/connected-apps/%s/installable-artifacts/%s/status", connectedAppID, installableArtifactID),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
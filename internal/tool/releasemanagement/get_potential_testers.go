@@ -33,6 +33,9 @@ var GetPotentialTesters = bitrise.Tool{
 		mcp.WithString("search",
 			mcp.Description("Searches for potential testers based on email or username using a case-insensitive approach."),
 		),
+		bitrise.WithFields(),
+		bitrise.WithWhere(),
+		bitrise.WithAllPages(),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(true),
@@ -59,15 +62,20 @@ var GetPotentialTesters = bitrise.Tool{
 			params["search"] = v
 		}
 
-		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIRMBaseURL,
-			Path:    fmt.Sprintf("/connected-apps/%s/tester-groups/%s/potential-testers", connectedAppID, id),
-			Params:  params,
+		projection, err := bitrise.ProjectionFromRequest(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		res, err := bitrise.CallAPIPaginated(ctx, request, bitrise.PageNumberPaging, bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			API:    bitrise.APIRM,
+			Path:   fmt.Sprintf("/connected-apps/%s/tester-groups/%s/potential-testers", connectedAppID, id),
+			Params: params,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
-		return mcp.NewToolResultText(res), nil
+		return projection.ToolResult(res), nil
 	},
 }
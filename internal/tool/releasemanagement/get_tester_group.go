@@ -37,12 +37,12 @@ var GetTesterGroup = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodGet,
-			BaseURL: bitrise.APIRMBaseURL,
-			Path:    fmt.Sprintf("/connected-apps/%s/tester-groups/%s", connectedAppID, id),
+			Method: http.MethodGet,
+			API:    bitrise.APIRM,
+			Path:   fmt.Sprintf("/connected-apps/%s/tester-groups/%s", connectedAppID, id),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -49,13 +49,13 @@ var SetInstallableArtifactPublicInstallPage = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPatch,
-			BaseURL: bitrise.APIRMBaseURL,
-			Path:    fmt.Sprintf("/connected-apps/%s/installable-artifacts/%s/public-install-page", connectedAppID, installableArtifactID),
-			Body:    body,
+			Method: http.MethodPatch,
+			API:    bitrise.APIRM,
+			Path:   fmt.Sprintf("/connected-apps/%s/installable-artifacts/%s/public-install-page", connectedAppID, installableArtifactID),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
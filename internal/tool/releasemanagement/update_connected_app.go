@@ -50,13 +50,13 @@ var UpdateConnectedApp = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPatch,
-			BaseURL: bitrise.APIRMBaseURL,
-			Path:    fmt.Sprintf("/connected-apps/%s", connectedAppID),
-			Body:    body,
+			Method: http.MethodPatch,
+			API:    bitrise.APIRM,
+			Path:   fmt.Sprintf("/connected-apps/%s", connectedAppID),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
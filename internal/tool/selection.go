@@ -0,0 +1,129 @@
+package tool
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Selection narrows down the tools enabled by API groups using glob patterns
+// of tool names, e.g. "codepush_*". Patterns prefixed with "!" exclude the
+// tools they match.
+type Selection struct {
+	include []string
+	exclude []string
+}
+
+// NewSelection creates a selection from enabled and disabled patterns. When
+// enabled has no including pattern, every tool is included. Disabled
+// patterns exclude tools, with or without the "!" prefix.
+func NewSelection(enabled, disabled []string) (Selection, error) {
+	var s Selection
+	for _, pattern := range enabled {
+		if err := s.add(pattern, false); err != nil {
+			return Selection{}, err
+		}
+	}
+	for _, pattern := range disabled {
+		if err := s.add(pattern, true); err != nil {
+			return Selection{}, err
+		}
+	}
+	return s, nil
+}
+
+// ParseSelection creates a selection from comma-separated lists of patterns.
+func ParseSelection(enabled, disabled string) (Selection, error) {
+	return NewSelection(SplitList(enabled), SplitList(disabled))
+}
+
+func (s *Selection) add(pattern string, exclude bool) error {
+	pattern = strings.TrimSpace(pattern)
+	if p, ok := strings.CutPrefix(pattern, "!"); ok {
+		pattern, exclude = p, true
+	}
+	if pattern == "" {
+		return nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+	}
+	if exclude {
+		s.exclude = append(s.exclude, pattern)
+	} else {
+		s.include = append(s.include, pattern)
+	}
+	return nil
+}
+
+// Allows reports whether the tool is selected.
+func (s Selection) Allows(name string) bool {
+	if slices.ContainsFunc(s.exclude, func(pattern string) bool { return match(pattern, name) }) {
+		return false
+	}
+	return len(s.include) == 0 || slices.ContainsFunc(s.include, func(pattern string) bool { return match(pattern, name) })
+}
+
+// Patterns returns the patterns of the selection, the excluding ones
+// prefixed with "!".
+func (s Selection) Patterns() []string {
+	patterns := slices.Clone(s.include)
+	for _, pattern := range s.exclude {
+		patterns = append(patterns, "!"+pattern)
+	}
+	return patterns
+}
+
+func match(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name) // patterns are validated in add
+	return ok
+}
+
+// SplitList splits a comma-separated list, dropping empty items.
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// UnknownGroups returns the groups no tool belongs to.
+func (b *Belt) UnknownGroups(groups []string) []string {
+	known := map[string]bool{}
+	for _, tool := range b.tools {
+		for _, group := range tool.APIGroups {
+			known[group] = true
+		}
+	}
+	var unknown []string
+	for _, group := range groups {
+		if !known[apiGroup(group)] {
+			unknown = append(unknown, group)
+		}
+	}
+	return unknown
+}
+
+// UnknownPatterns returns the patterns of the selection that don't match any
+// tool, which usually means a typo.
+func (b *Belt) UnknownPatterns(s Selection) []string {
+	var unknown []string
+	for _, pattern := range s.Patterns() {
+		trimmed := strings.TrimPrefix(pattern, "!")
+		matched := false
+		for name := range b.tools {
+			if match(trimmed, name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unknown = append(unknown, pattern)
+		}
+	}
+	return unknown
+}
@@ -0,0 +1,69 @@
+package tool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectionAllows(t *testing.T) {
+	cases := map[string]struct {
+		enabled  string
+		disabled string
+		allowed  []string
+		denied   []string
+	}{
+		"empty selection allows everything": {
+			allowed: []string{"delete_app", "list_apps"},
+		},
+		"enabled patterns are an allowlist": {
+			enabled: "codepush_*, get_app",
+			allowed: []string{"codepush_list_deployments", "get_app"},
+			denied:  []string{"get_apps", "delete_app"},
+		},
+		"negated enabled patterns exclude": {
+			enabled: "codepush_*,!codepush_delete_*",
+			allowed: []string{"codepush_list_deployments"},
+			denied:  []string{"codepush_delete_deployment", "list_apps"},
+		},
+		"only negated patterns keep everything else": {
+			enabled: "!delete_*",
+			allowed: []string{"list_apps"},
+			denied:  []string{"delete_app"},
+		},
+		"disabled patterns win over enabled ones": {
+			enabled:  "*_app",
+			disabled: "delete_*",
+			allowed:  []string{"get_app"},
+			denied:   []string{"delete_app"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, err := ParseSelection(tc.enabled, tc.disabled)
+			assert.NoError(t, err)
+			for _, tool := range tc.allowed {
+				assert.True(t, s.Allows(tool), tool)
+			}
+			for _, tool := range tc.denied {
+				assert.False(t, s.Allows(tool), tool)
+			}
+		})
+	}
+
+	_, err := ParseSelection("codepush_[", "")
+	assert.Error(t, err)
+}
+
+func TestBeltUnknownNames(t *testing.T) {
+	belt := NewBelt()
+
+	assert.Equal(t, []string{"acount"}, belt.UnknownGroups([]string{"apps", "account", "acount", "read-only"}))
+	assert.True(t, belt.ToolEnabled("me", []string{"account"}), "account is an alias of the user group")
+	assert.True(t, belt.ToolEnabled("me", []string{"user"}))
+
+	s, err := ParseSelection("codepush_*,get_ap,!delete_*", "list_appz")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"get_ap", "!list_appz"}, belt.UnknownPatterns(s))
+}
@@ -37,12 +37,12 @@ var DeleteOutgoing = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodDelete,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/outgoing-webhooks/%s", appSlug, webhookSlug),
+			Method: http.MethodDelete,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/outgoing-webhooks/%s", appSlug, webhookSlug),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -52,13 +52,13 @@ var UpdateOutgoing = bitrise.Tool{
 		body["headers"] = request.GetArguments()["headers"]
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPatch,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/apps/%s/outgoing-webhooks/%s", appSlug, webhookSlug),
-			Body:    body,
+			Method: http.MethodPatch,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/apps/%s/outgoing-webhooks/%s", appSlug, webhookSlug),
+			Body:   body,
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -37,12 +37,12 @@ var AddMemberToGroup = bitrise.Tool{
 		}
 
 		res, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{
-			Method:  http.MethodPut,
-			BaseURL: bitrise.APIBaseURL,
-			Path:    fmt.Sprintf("/groups/%s/members/%s", groupSlug, userSlug),
+			Method: http.MethodPut,
+			API:    bitrise.APIMain,
+			Path:   fmt.Sprintf("/groups/%s/members/%s", groupSlug, userSlug),
 		})
 		if err != nil {
-			return mcp.NewToolResultErrorFromErr("call api", err), nil
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
 		}
 		return mcp.NewToolResultText(res), nil
 	},
@@ -0,0 +1,253 @@
+// Package ttlcache implements a size-bounded cache whose entries expire after
+// a per-entry TTL. Concurrent loads of the same missing key are deduplicated.
+package ttlcache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errLoadPanicked is returned to the callers waiting for a load that panicked.
+var errLoadPanicked = errors.New("ttlcache: load panicked")
+
+// Result tells how GetOrLoad got its value.
+type Result string
+
+const (
+	// Hit means the value was cached.
+	Hit Result = "hit"
+	// Miss means the value was loaded by this call.
+	Miss Result = "miss"
+	// Shared means the value was loaded by a concurrent call for the same key.
+	Shared Result = "shared"
+)
+
+// EvictionReason tells why an entry left the cache.
+type EvictionReason string
+
+const (
+	// Expired entries outlived their TTL.
+	Expired EvictionReason = "expired"
+	// Capacity entries were the least recently used when the cache was full.
+	Capacity EvictionReason = "capacity"
+)
+
+// Options configure a cache.
+type Options struct {
+	// MaxEntries bounds the number of entries, 0 means unbounded.
+	MaxEntries int
+	// EvictionInterval is how often expired entries are removed in the
+	// background, 0 disables background eviction. Expired entries are never
+	// returned either way.
+	EvictionInterval time.Duration
+	// OnEvict is called, without holding the cache's lock, for each evicted
+	// entry.
+	OnEvict func(reason EvictionReason)
+}
+
+// Cache is safe for concurrent use. Call Close to stop the background
+// eviction.
+type Cache[V any] struct {
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List // front is the most recently used
+	inflight map[string]*call[V]
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type entry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// New creates a cache and starts its background eviction.
+func New[V any](opts Options) *Cache[V] {
+	c := &Cache[V]{
+		opts:     opts,
+		now:      time.Now,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+		inflight: map[string]*call[V]{},
+		stop:     make(chan struct{}),
+	}
+	if opts.EvictionInterval > 0 {
+		go c.evictLoop()
+	}
+	return c
+}
+
+// Get returns the unexpired value of key.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	value, ok, evicted := c.get(key)
+	c.mu.Unlock()
+	c.notify(evicted, Expired)
+	return value, ok
+}
+
+// Set stores a value for ttl. Values with a non-positive ttl aren't stored.
+func (c *Cache[V]) Set(key string, value V, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	evicted := c.set(key, value, ttl)
+	c.mu.Unlock()
+	c.notify(evicted, Capacity)
+}
+
+// GetOrLoad returns the cached value of key or loads it. Only one load runs
+// per key at a time, concurrent callers wait for its result. The load runs
+// with a context that isn't canceled with the caller's, so a caller giving
+// up doesn't fail the others. Errors aren't cached.
+func (c *Cache[V]) GetOrLoad(ctx context.Context, key string, load func(ctx context.Context) (V, time.Duration, error)) (V, Result, error) {
+	c.mu.Lock()
+	value, ok, expired := c.get(key)
+	if ok {
+		c.mu.Unlock()
+		return value, Hit, nil
+	}
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		c.notify(expired, Expired)
+		select {
+		case <-cl.done:
+			return cl.value, Shared, cl.err
+		case <-ctx.Done():
+			var zero V
+			return zero, Shared, ctx.Err()
+		}
+	}
+	cl := &call[V]{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+	c.notify(expired, Expired)
+
+	var ttl time.Duration
+	loaded := false
+	defer func() {
+		// The waiters mustn't block forever if load panics.
+		if !loaded {
+			cl.err = errLoadPanicked
+		}
+		c.mu.Lock()
+		delete(c.inflight, key)
+		var evicted int
+		if cl.err == nil && ttl > 0 {
+			evicted = c.set(key, cl.value, ttl)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+		c.notify(evicted, Capacity)
+	}()
+	cl.value, ttl, cl.err = load(context.WithoutCancel(ctx))
+	loaded = true
+	return cl.value, Miss, cl.err
+}
+
+// Len returns the number of entries, including expired ones not evicted yet.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// EvictExpired removes the expired entries.
+func (c *Cache[V]) EvictExpired() {
+	now := c.now()
+	var evicted int
+	c.mu.Lock()
+	for e := c.lru.Back(); e != nil; {
+		prev := e.Prev()
+		if !now.Before(e.Value.(*entry[V]).expiresAt) { //nolint:forcetypeassert
+			c.remove(e)
+			evicted++
+		}
+		e = prev
+	}
+	c.mu.Unlock()
+	c.notify(evicted, Expired)
+}
+
+// Close stops the background eviction.
+func (c *Cache[V]) Close() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+func (c *Cache[V]) evictLoop() {
+	ticker := time.NewTicker(c.opts.EvictionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.EvictExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// get must be called with c.mu held. It also returns the number of expired
+// entries removed, 0 or 1.
+func (c *Cache[V]) get(key string) (V, bool, int) {
+	var zero V
+	e, ok := c.entries[key]
+	if !ok {
+		return zero, false, 0
+	}
+	ent := e.Value.(*entry[V]) //nolint:forcetypeassert
+	if !c.now().Before(ent.expiresAt) {
+		c.remove(e)
+		return zero, false, 1
+	}
+	c.lru.MoveToFront(e)
+	return ent.value, true, 0
+}
+
+// set must be called with c.mu held. It returns the number of entries
+// evicted to make room.
+func (c *Cache[V]) set(key string, value V, ttl time.Duration) int {
+	expiresAt := c.now().Add(ttl)
+	if e, ok := c.entries[key]; ok {
+		ent := e.Value.(*entry[V]) //nolint:forcetypeassert
+		ent.value, ent.expiresAt = value, expiresAt
+		c.lru.MoveToFront(e)
+		return 0
+	}
+	c.entries[key] = c.lru.PushFront(&entry[V]{key: key, value: value, expiresAt: expiresAt})
+	var evicted int
+	for c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries {
+		c.remove(c.lru.Back())
+		evicted++
+	}
+	return evicted
+}
+
+func (c *Cache[V]) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*entry[V]).key) //nolint:forcetypeassert
+}
+
+func (c *Cache[V]) notify(evicted int, reason EvictionReason) {
+	if c.opts.OnEvict == nil {
+		return
+	}
+	for range evicted {
+		c.opts.OnEvict(reason)
+	}
+}
@@ -0,0 +1,183 @@
+package ttlcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCache(maxEntries int) (*Cache[string], *time.Time, map[EvictionReason]int) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	evictions := map[EvictionReason]int{}
+	c := New[string](Options{
+		MaxEntries: maxEntries,
+		OnEvict:    func(reason EvictionReason) { evictions[reason]++ },
+	})
+	c.now = func() time.Time { return now }
+	return c, &now, evictions
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c, now, evictions := newTestCache(0)
+	c.Set("a", "1", time.Minute)
+	c.Set("b", "2", 2*time.Minute)
+	c.Set("c", "3", 0)
+
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", v)
+	_, ok = c.Get("c")
+	assert.False(t, ok, "entries with a non-positive TTL aren't stored")
+
+	*now = now.Add(time.Minute)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, evictions[Expired])
+	assert.Equal(t, 1, c.Len())
+
+	*now = now.Add(time.Minute)
+	c.EvictExpired()
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, 2, evictions[Expired])
+}
+
+func TestCacheCapacity(t *testing.T) {
+	c, _, evictions := newTestCache(2)
+	c.Set("a", "1", time.Minute)
+	c.Set("b", "2", time.Minute)
+	c.Get("a") // b becomes the least recently used
+	c.Set("c", "3", time.Minute)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, map[EvictionReason]int{Capacity: 1}, evictions)
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	c, _, _ := newTestCache(0)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (string, time.Duration, error) {
+		loads.Add(1)
+		<-release
+		return "value", time.Minute, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan Result, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, result, err := c.GetOrLoad(t.Context(), "key", load)
+			assert.NoError(t, err)
+			assert.Equal(t, "value", v)
+			results <- result
+		}()
+	}
+	// Let the goroutines pile up on the in-flight load.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	counts := map[Result]int{}
+	for result := range results {
+		counts[result]++
+	}
+	assert.Equal(t, int32(1), loads.Load())
+	assert.Equal(t, 1, counts[Miss])
+	assert.Equal(t, 4, counts[Shared]+counts[Hit])
+
+	_, result, _ := c.GetOrLoad(t.Context(), "key", load)
+	assert.Equal(t, Hit, result)
+}
+
+func TestCacheGetOrLoadError(t *testing.T) {
+	c, _, _ := newTestCache(0)
+	_, result, err := c.GetOrLoad(t.Context(), "key", func(context.Context) (string, time.Duration, error) {
+		return "", time.Minute, errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, Miss, result)
+	assert.Equal(t, 0, c.Len(), "errors aren't cached")
+}
+
+func TestCacheGetOrLoadPanic(t *testing.T) {
+	c, _, _ := newTestCache(0)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() { assert.Equal(t, "boom", recover()) }()
+		_, _, _ = c.GetOrLoad(context.Background(), "key", func(context.Context) (string, time.Duration, error) {
+			<-release
+			panic("boom")
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	waiter := make(chan error)
+	go func() {
+		_, _, err := c.GetOrLoad(context.Background(), "key", nil)
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-done
+	select {
+	case err := <-waiter:
+		assert.ErrorIs(t, err, errLoadPanicked)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiter wasn't woken up")
+	}
+
+	v, result, err := c.GetOrLoad(t.Context(), "key", func(context.Context) (string, time.Duration, error) {
+		return "value", time.Minute, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Miss, result)
+	assert.Equal(t, "value", v)
+}
+
+func TestCacheGetOrLoadCanceledWaiter(t *testing.T) {
+	c, _, _ := newTestCache(0)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, _, err := c.GetOrLoad(context.Background(), "key", func(context.Context) (string, time.Duration, error) {
+			<-release
+			return "value", time.Minute, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "value", v)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, result, err := c.GetOrLoad(ctx, "key", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, Shared, result)
+
+	close(release)
+	<-done
+}
+
+func TestCacheBackgroundEviction(t *testing.T) {
+	c := New[string](Options{EvictionInterval: 10 * time.Millisecond})
+	defer c.Close()
+	c.Set("a", "1", 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return c.Len() == 0 }, time.Second, 5*time.Millisecond)
+}
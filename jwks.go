@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksTTL is how long fetched keys are used before the key set is
+	// fetched again.
+	jwksTTL = time.Hour
+	// jwksMinRefresh limits how often an unknown key ID triggers a refetch,
+	// so tokens with made-up key IDs can't hammer the issuer.
+	jwksMinRefresh = time.Minute
+	// jwtLeeway is the tolerated clock skew when checking exp and nbf.
+	jwtLeeway = time.Minute
+)
+
+var (
+	// errInvalidToken is returned for bearer tokens that fail verification.
+	// The HTTP transport answers them with 401.
+	errInvalidToken = errors.New("invalid token")
+	// errJWKSUnavailable is returned when a token can't be verified because
+	// the JWKS can't be fetched. The HTTP transport answers it with 503.
+	errJWKSUnavailable = errors.New("JWKS unavailable")
+)
+
+// jwtClaims are the registered claims checked by jwtVerifier.
+type jwtClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt float64  `json:"exp"`
+	NotBefore float64  `json:"nbf"`
+}
+
+// audience is the aud claim, which is either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings")
+	}
+	*a = list
+	return nil
+}
+
+// jwtVerifier checks the signature of JWTs against the issuer's JWKS and
+// validates their iss, aud, exp and nbf claims.
+type jwtVerifier struct {
+	issuer string
+	// audience is the expected aud claim, not checked when empty.
+	audience string
+	keys     *jwksCache
+	now      func() time.Time
+}
+
+func newJWTVerifier(issuer, audience, jwksURL string) *jwtVerifier {
+	return &jwtVerifier{
+		issuer:   strings.TrimRight(issuer, "/"),
+		audience: audience,
+		keys:     newJWKSCache(jwksURL),
+		now:      time.Now,
+	}
+}
+
+// verify returns the claims of a valid token. Errors caused by the token
+// itself wrap errInvalidToken; others (e.g. an unreachable JWKS endpoint)
+// don't.
+func (v *jwtVerifier) verify(ctx context.Context, token string) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("%w: malformed JWT", errInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("%w: header: %w", errInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("%w: signature: %w", errInvalidToken, err)
+	}
+	key, err := v.keys.key(ctx, header.Kid)
+	if err != nil {
+		return claims, err
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return claims, fmt.Errorf("%w: algorithm %s doesn't match the key's %s", errInvalidToken, header.Alg, key.alg)
+	}
+	if err := verifySignature(header.Alg, key.key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return claims, fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("%w: claims: %w", errInvalidToken, err)
+	}
+	if strings.TrimRight(claims.Issuer, "/") != v.issuer {
+		return claims, fmt.Errorf("%w: unexpected issuer %q", errInvalidToken, claims.Issuer)
+	}
+	if v.audience != "" && !slices.Contains(claims.Audience, v.audience) {
+		return claims, fmt.Errorf("%w: token is not meant for audience %q", errInvalidToken, v.audience)
+	}
+	now := v.now()
+	if claims.ExpiresAt == 0 {
+		return claims, fmt.Errorf("%w: missing exp claim", errInvalidToken)
+	}
+	if now.After(unixTime(claims.ExpiresAt).Add(jwtLeeway)) {
+		return claims, fmt.Errorf("%w: token expired", errInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(jwtLeeway).Before(unixTime(claims.NotBefore)) {
+		return claims, fmt.Errorf("%w: token not valid yet", errInvalidToken)
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// verifySignature checks an asymmetric JWS signature. Symmetric algorithms
+// and "none" are rejected, the key comes from a public key set.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch {
+	case strings.HasSuffix(alg, "256"):
+		hash = crypto.SHA256
+	case strings.HasSuffix(alg, "384"):
+		hash = crypto.SHA384
+	case strings.HasSuffix(alg, "512"):
+		hash = crypto.SHA512
+	}
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	switch {
+	case alg == "RS256" || alg == "RS384" || alg == "RS512":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type %T doesn't match algorithm %s", key, alg)
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, signature)
+	case alg == "PS256" || alg == "PS384" || alg == "PS512":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type %T doesn't match algorithm %s", key, alg)
+		}
+		return rsa.VerifyPSS(k, hash, digest, signature, nil)
+	case alg == "ES256" || alg == "ES384" || alg == "ES512":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type %T doesn't match algorithm %s", key, alg)
+		}
+		// Each algorithm has its own curve (RFC 7518 3.4).
+		if curve := k.Curve.Params().Name; curve != ecdsaCurves[alg] {
+			return fmt.Errorf("curve %s doesn't match algorithm %s", curve, alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid ECDSA signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case alg == "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type %T doesn't match algorithm %s", key, alg)
+		}
+		if !ed25519.Verify(k, signed, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+//nolint:gochecknoglobals
+var ecdsaCurves = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+// signingKey is a key of a JWKS with the algorithm it's restricted to, empty
+// when the JWK has no alg.
+type signingKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// jwksCache fetches a JSON Web Key Set and caches its keys by key ID. The
+// set is refetched when it gets older than jwksTTL or when a token is signed
+// with an unknown key, which is how key rotation is picked up. Fetches are
+// attempted at most once per jwksMinRefresh and run outside the lock, one at
+// a time; callers keep using the previous keys meanwhile.
+type jwksCache struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]signingKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	// fetchErr is the error of the last fetch attempt.
+	fetchErr error
+	// fetching is closed when the fetch in flight is done, nil without one.
+	fetching chan struct{}
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// key returns the key with the given ID. An empty ID matches the only key
+// of a single-key set.
+func (c *jwksCache) key(ctx context.Context, kid string) (signingKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// fetched tells whether this call fetched the keys or waited for them.
+	fetched := false
+	_, ok := c.lookup(kid)
+	if !ok || c.now().Sub(c.fetchedAt) >= jwksTTL {
+		switch {
+		case c.fetching == nil && c.now().Sub(c.attemptedAt) >= jwksMinRefresh:
+			c.refresh(ctx)
+			fetched = true
+		case c.fetching != nil && !ok:
+			// Nothing to fall back on, wait for the fetch in flight.
+			fetching := c.fetching
+			c.mu.Unlock()
+			select {
+			case <-fetching:
+			case <-ctx.Done():
+				c.mu.Lock()
+				return signingKey{}, ctx.Err()
+			}
+			c.mu.Lock()
+			fetched = true
+		}
+	}
+	if key, ok := c.lookup(kid); ok {
+		return key, nil
+	}
+	// A failed fetch is an outage when there are no keys to go on or this
+	// call needed the fetch; an earlier failure doesn't excuse unknown keys.
+	if c.fetchErr != nil && (c.keys == nil || fetched) {
+		return signingKey{}, fmt.Errorf("%w: %w", errJWKSUnavailable, c.fetchErr)
+	}
+	return signingKey{}, fmt.Errorf("%w: unknown signing key %q", errInvalidToken, kid)
+}
+
+// refresh fetches the key set without holding the lock. Must be called with
+// c.mu held.
+func (c *jwksCache) refresh(ctx context.Context) {
+	fetching := make(chan struct{})
+	c.fetching, c.attemptedAt = fetching, c.now()
+	c.mu.Unlock()
+	// Other callers may be waiting for the keys.
+	keys, err := c.fetch(context.WithoutCancel(ctx))
+	c.mu.Lock()
+	c.fetching = nil
+	close(fetching)
+
+	// Keep the previous keys when the set is empty, e.g. during a botched
+	// rotation on the issuer's side.
+	if err == nil && len(keys) == 0 && c.keys != nil {
+		err = errors.New("JWKS has no usable keys")
+	}
+	c.fetchErr = err
+	if err != nil {
+		return
+	}
+	c.keys, c.fetchedAt = keys, c.now()
+}
+
+func (c *jwksCache) lookup(kid string) (signingKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+func (c *jwksCache) fetch(ctx context.Context) (map[string]signingKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create JWKS request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %d: %s", resp.StatusCode, body)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+	keys := map[string]signingKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys of unsupported types instead of failing the whole set.
+			continue
+		}
+		keys[jwk.Kid] = signingKey{key: key, alg: jwk.Alg}
+	}
+	return keys, nil
+}
+
+// jsonWebKey is a public key of a JWKS (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode n: %w", err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode e: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decode y: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// discoverJWKSURL reads the jwks_uri of an issuer from its OpenID Connect or
+// OAuth authorization server metadata.
+func discoverJWKSURL(ctx context.Context, issuer string) (string, error) {
+	issuer = strings.TrimRight(issuer, "/")
+	client := &http.Client{Timeout: 10 * time.Second}
+	var lastErr error
+	for _, path := range []string{"/.well-known/openid-configuration", "/.well-known/oauth-authorization-server"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+path, nil)
+		if err != nil {
+			return "", fmt.Errorf("create discovery request: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var metadata struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&metadata)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || err != nil || metadata.JWKSURI == "" {
+			lastErr = fmt.Errorf("%s returned %d without jwks_uri", path, resp.StatusCode)
+			continue
+		}
+		return metadata.JWKSURI, nil
+	}
+	return "", fmt.Errorf("discover JWKS of %s: %w", issuer, lastErr)
+}
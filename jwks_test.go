@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const testIssuer = "https://issuer.example.com"
+
+// testJWKS is a local stand-in for an issuer's JWKS endpoint.
+type testJWKS struct {
+	server  *httptest.Server
+	keys    atomic.Value // []jsonWebKey
+	fetches atomic.Int32
+}
+
+func newTestJWKS(t *testing.T, keys ...jsonWebKey) *testJWKS {
+	j := &testJWKS{}
+	j.keys.Store(keys)
+	j.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		j.fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": j.keys.Load()})
+	}))
+	t.Cleanup(j.server.Close)
+	return j
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) jsonWebKey {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return jsonWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Crv: key.Curve.Params().Name,
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+func signTestJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]any{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		assert.NoError(t, err)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims(now time.Time) map[string]any {
+	return map[string]any{
+		"iss": testIssuer,
+		"sub": "user123",
+		"aud": []string{"bitrise-mcp"},
+		"exp": now.Add(10 * time.Minute).Unix(),
+		"nbf": now.Add(-time.Minute).Unix(),
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	psJWK := rsaJWK("rsa-ps", rsaKey)
+	psJWK.Alg = "PS256"
+	jwks := newTestJWKS(t, rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey), ecJWK("p384", p384Key), psJWK)
+	now := time.Now()
+
+	withClaim := func(key string, value any) map[string]any {
+		claims := validClaims(now)
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	noneToken := func() string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa"}`))
+		payload, _ := json.Marshal(validClaims(now))
+		return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+	}
+
+	cases := map[string]struct {
+		token   string
+		wantErr bool
+	}{
+		"valid RSA token":       {token: signTestJWT(t, "RS256", "rsa", rsaKey, validClaims(now))},
+		"valid EC token":        {token: signTestJWT(t, "ES256", "ec", ecKey, validClaims(now))},
+		"string audience":       {token: signTestJWT(t, "RS256", "rsa", rsaKey, withClaim("aud", "bitrise-mcp"))},
+		"wrong signing key":     {token: signTestJWT(t, "RS256", "rsa", otherKey, validClaims(now)), wantErr: true},
+		"algorithm mismatch":    {token: signTestJWT(t, "ES256", "rsa", rsaKey, validClaims(now)), wantErr: true},
+		"curve mismatch":        {token: signTestJWT(t, "ES256", "p384", p384Key, validClaims(now)), wantErr: true},
+		"JWK alg mismatch":      {token: signTestJWT(t, "RS256", "rsa-ps", rsaKey, validClaims(now)), wantErr: true},
+		"alg none":              {token: noneToken(), wantErr: true},
+		"unknown key ID":        {token: signTestJWT(t, "RS256", "other", rsaKey, validClaims(now)), wantErr: true},
+		"wrong issuer":          {token: signTestJWT(t, "RS256", "rsa", rsaKey, withClaim("iss", "https://evil.example.com")), wantErr: true},
+		"wrong audience":        {token: signTestJWT(t, "RS256", "rsa", rsaKey, withClaim("aud", "other")), wantErr: true},
+		"missing exp":           {token: signTestJWT(t, "RS256", "rsa", rsaKey, withClaim("exp", nil)), wantErr: true},
+		"expired":               {token: signTestJWT(t, "RS256", "rsa", rsaKey, withClaim("exp", now.Add(-5*time.Minute).Unix())), wantErr: true},
+		"expired within leeway": {token: signTestJWT(t, "RS256", "rsa", rsaKey, withClaim("exp", now.Add(-30*time.Second).Unix()))},
+		"not valid yet":         {token: signTestJWT(t, "RS256", "rsa", rsaKey, withClaim("nbf", now.Add(5*time.Minute).Unix())), wantErr: true},
+		"malformed":             {token: "eyJ.not-a.jwt", wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			v := newJWTVerifier(testIssuer+"/", "bitrise-mcp", jwks.server.URL)
+			v.now = func() time.Time { return now }
+			claims, err := v.verify(t.Context(), tc.token)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, errInvalidToken)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "user123", claims.Subject)
+		})
+	}
+}
+
+func TestJWKSCacheRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := newTestJWKS(t, rsaJWK("old", oldKey))
+	now := time.Now()
+	v := newJWTVerifier(testIssuer, "", jwks.server.URL)
+	v.now = func() time.Time { return now }
+	v.keys.now = func() time.Time { return now }
+
+	_, err := v.verify(t.Context(), signTestJWT(t, "RS256", "old", oldKey, validClaims(now)))
+	assert.NoError(t, err)
+	_, err = v.verify(t.Context(), signTestJWT(t, "RS256", "old", oldKey, validClaims(now)))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), jwks.fetches.Load(), "keys are cached")
+
+	// The issuer rotates its key.
+	jwks.keys.Store([]jsonWebKey{rsaJWK("new", newKey)})
+	newToken := signTestJWT(t, "RS256", "new", newKey, validClaims(now))
+
+	_, err = v.verify(t.Context(), newToken)
+	assert.ErrorIs(t, err, errInvalidToken, "unknown keys don't trigger a refetch right after a fetch")
+	assert.Equal(t, int32(1), jwks.fetches.Load())
+
+	now = now.Add(jwksMinRefresh)
+	_, err = v.verify(t.Context(), newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), jwks.fetches.Load())
+
+	// Keys expire after the TTL, and are kept when the refetch fails.
+	jwks.server.Close()
+	now = now.Add(jwksTTL)
+	_, err = v.verify(t.Context(), newToken)
+	assert.ErrorIs(t, err, errInvalidToken, "the token itself expired by now")
+	_, err = v.verify(t.Context(), signTestJWT(t, "RS256", "new", newKey, validClaims(now)))
+	assert.NoError(t, err)
+
+	// Unknown keys are only blamed on the outage when their refetch fails.
+	otherToken := signTestJWT(t, "RS256", "other", oldKey, validClaims(now))
+	_, err = v.verify(t.Context(), otherToken)
+	assert.ErrorIs(t, err, errInvalidToken)
+	now = now.Add(jwksMinRefresh)
+	_, err = v.verify(t.Context(), otherToken)
+	assert.ErrorIs(t, err, errJWKSUnavailable)
+}
+
+func TestJWKSCacheSlowFetch(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := newTestJWKS(t, rsaJWK("rsa", key))
+	now := time.Now()
+	v := newJWTVerifier(testIssuer, "", jwks.server.URL)
+	v.now = func() time.Time { return now }
+	v.keys.now = func() time.Time { return now }
+	_, err := v.verify(t.Context(), signTestJWT(t, "RS256", "rsa", key, validClaims(now)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The issuer hangs on the refetch after the TTL.
+	fetching, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(fetching)
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	v.keys.url = slow.URL
+	now = now.Add(jwksTTL)
+	go func() { _, _ = v.keys.key(context.Background(), "rsa") }()
+	<-fetching
+
+	done := make(chan error)
+	go func() {
+		_, err := v.verify(t.Context(), signTestJWT(t, "RS256", "rsa", key, validClaims(now)))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("verification waited for the JWKS fetch")
+	}
+}
+
+func TestJWKSUnavailable(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := newTestJWKS(t)
+	jwks.server.Close()
+	exchanger := newJWTExchanger(jwks.server.URL, 0, zap.NewNop().Sugar(), nil)
+	defer exchanger.Close()
+	exchanger.verifier = newJWTVerifier(testIssuer, "", jwks.server.URL)
+	token := signTestJWT(t, "RS256", "rsa", key, validClaims(time.Now()))
+
+	_, err := exchanger.exchange(t.Context(), token)
+	assert.ErrorIs(t, err, errJWKSUnavailable)
+	assert.NotErrorIs(t, err, errInvalidToken)
+
+	auth := &bearerAuth{exchanger: exchanger, logger: zap.NewNop().Sugar()}
+	handler := auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request was let through")
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestJWTExchangerRejectsInvalidTokens(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := newTestJWKS(t, rsaJWK("rsa", key))
+	var exchanges atomic.Int32
+	tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchanges.Add(1)
+		_, _ = w.Write([]byte(`{"access_token":"bitrise-pat"}`))
+	}))
+	defer tokenEndpoint.Close()
+
+	e := newJWTExchanger(tokenEndpoint.URL, 0, zap.NewNop().Sugar(), nil)
+	defer e.Close()
+	e.verifier = newJWTVerifier(testIssuer, "", jwks.server.URL)
+
+	_, err := e.exchange(t.Context(), makeTestJWT(time.Now().Add(time.Hour).Unix()))
+	assert.ErrorIs(t, err, errInvalidToken)
+	assert.Equal(t, int32(0), exchanges.Load())
+
+	pat, err := e.exchange(t.Context(), signTestJWT(t, "RS256", "rsa", key, validClaims(time.Now())))
+	assert.NoError(t, err)
+	assert.Equal(t, "bitrise-pat", pat)
+	assert.Equal(t, int32(1), exchanges.Load())
+}
+
+func TestDiscoverJWKSURL(t *testing.T) {
+	var issuer *httptest.Server
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/oauth-authorization-server" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer.URL + "/keys"})
+	}))
+	defer issuer.Close()
+
+	url, err := discoverJWKSURL(t.Context(), issuer.URL+"/")
+	assert.NoError(t, err)
+	assert.Equal(t, issuer.URL+"/keys", url)
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"os/signal"
 	"strings"
 	"syscall"
@@ -14,16 +17,29 @@ import (
 	httptrace "github.com/DataDog/dd-trace-go/contrib/net/http/v2"
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/completion"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/oauth"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/prompt"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/resource"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/session"
 	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool"
 	"github.com/jinzhu/configor"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 const development = "development"
 
+const (
+	transportStdio = "stdio"
+	transportHTTP  = "http"
+	transportSSE   = "sse"
+)
+
 // BuildVersion is overwritten with go build flags.
 var BuildVersion = development //nolint:gochecknoglobals
 
@@ -32,17 +48,79 @@ type config struct {
 	// If set, the server will use HTTP transport, otherwise it will use stdio
 	// transport.
 	Addr string `env:"ADDR"`
+	// SSEAddr is the address to listen on for the legacy HTTP+SSE transport,
+	// for clients that don't support streamable HTTP yet.
+	SSEAddr string `env:"SSE_ADDR"`
+	// Transport is "stdio", "http" or "sse". Derived from Addr and SSEAddr
+	// when empty.
+	Transport string `env:"TRANSPORT"`
 	// BitriseToken is the Bitrise API token used to authenticate requests for
 	// the stdio transport. Only valid for the stdio transport, otherwise it is
 	// ignored.
 	BitriseToken string `env:"BITRISE_TOKEN"`
+	// BitriseTokenFile is the path of a file holding the Bitrise API token,
+	// as an alternative to BitriseToken. Only valid for the stdio transport.
+	BitriseTokenFile string `env:"BITRISE_TOKEN_FILE"`
+	// BitriseTokenCommand is a shell command printing the Bitrise API token,
+	// e.g. a credential helper like "pass show bitrise", as an alternative to
+	// BitriseToken. Only valid for the stdio transport.
+	BitriseTokenCommand string `env:"BITRISE_TOKEN_COMMAND"`
+	// BitriseTokenRefreshInterval is how long a token read from
+	// BitriseTokenFile or BitriseTokenCommand is cached before it's read
+	// again. Set to 0 to read it only once.
+	BitriseTokenRefreshInterval time.Duration `env:"BITRISE_TOKEN_REFRESH_INTERVAL" default:"15m"`
+	// ConfigFile is the path of a .toml, .yaml or .yml file with named
+	// profiles, each with its own token, API base URLs, API groups and
+	// default workspace. Only valid for the stdio transport.
+	ConfigFile string `env:"CONFIG_FILE"`
+	// Profile is the profile active at startup, overriding default_profile
+	// of the config file.
+	Profile string `env:"PROFILE"`
+	// SafetyMode restricts what tools may do: "full" (default), "dry-run"
+	// (mutating tools return the request they would send without calling
+	// Bitrise) or "read-only" (tools that modify data are hidden and
+	// rejected). In HTTP transport the x-bitrise-safety-mode header can make
+	// it stricter per request, but never looser.
+	SafetyMode string `env:"SAFETY_MODE" default:"full"`
+	// ConfirmDestructiveTools requires explicit user confirmation before
+	// running tools annotated as destructive. Clients supporting elicitation
+	// are asked directly; other clients get a confirmation token that must be
+	// passed back in a second call.
+	ConfirmDestructiveTools bool `env:"CONFIRM_DESTRUCTIVE_TOOLS" default:"false"`
+	// ConfirmationSecret signs confirmation tokens. Set it to the same value
+	// on every replica of an HTTP deployment; a random secret is generated
+	// otherwise.
+	ConfirmationSecret string `env:"CONFIRMATION_SECRET"`
+	// AuditLog is a comma-separated list of sinks receiving a JSONL record
+	// of every tool call that is not read-only: "stdout" (HTTP transport
+	// only), "file:<path>" or the http(s) URL of a collector. Auditing is
+	// disabled when empty.
+	AuditLog string `env:"AUDIT_LOG"`
 	// EnabledAPIGroups is a comma-separated list of API groups that are enabled.
 	EnabledAPIGroups string `env:"ENABLED_API_GROUPS" default:"apps,builds,workspaces,outgoing-webhooks,artifacts,group-roles,cache-items,pipelines,account,read-only,release-management"`
+	// EnabledTools is a comma-separated list of tool name glob patterns
+	// (e.g. "codepush_*"). When set, only matching tools of the enabled API
+	// groups are available. Patterns prefixed with "!" (e.g. "!delete_*")
+	// disable the matching tools.
+	EnabledTools string `env:"ENABLED_TOOLS"`
+	// DisabledTools is a comma-separated list of tool name glob patterns
+	// that are disabled even if their API group is enabled.
+	DisabledTools string `env:"DISABLED_TOOLS"`
 	// LogLevel is the log level for the application.
 	LogLevel string `env:"LOG_LEVEL" default:"info"`
+	// MetricsEnabled serves Prometheus metrics on /metrics. Only valid for
+	// the HTTP transport.
+	MetricsEnabled bool `env:"METRICS_ENABLED" default:"false"`
 	// DatadogTracingEnabled enables DataDog APM tracing when set to true.
 	// Requires a DataDog agent to be running and reachable (DD_AGENT_HOST).
 	DatadogTracingEnabled bool `env:"DATADOG_TRACING_ENABLED" default:"false"`
+	// OTLPEndpoint is the base URL of an OpenTelemetry collector's OTLP/HTTP
+	// receiver (e.g. http://localhost:4318). When set, spans of tool calls,
+	// Bitrise API calls and log downloads are exported to <endpoint>/v1/traces.
+	OTLPEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// OTLPHeaders is a comma-separated list of key=value headers sent with
+	// every OTLP export request, e.g. for authentication.
+	OTLPHeaders string `env:"OTEL_EXPORTER_OTLP_HEADERS"`
 	// ExternalOAuthIssuer is the issuer URL of an external OAuth authorization
 	// server. When set, the server advertises
 	// /.well-known/oauth-protected-resource so OAuth clients can discover the
@@ -51,11 +129,104 @@ type config struct {
 	// OIDCTokenEndpoint is the full URL of the OIDC token exchange endpoint
 	// (RFC 8693) used to trade an external JWT for a Bitrise PAT. When set,
 	// Bearer tokens that look like JWTs are exchanged before being passed to tools.
+	// Requires ExternalOAuthIssuer, whose keys verify the JWTs.
 	OIDCTokenEndpoint string `env:"OIDC_TOKEN_ENDPOINT"`
+	// OIDCJWKSURL is the URL of the JSON Web Key Set used to verify JWTs
+	// before they are exchanged. Discovered from ExternalOAuthIssuer's
+	// metadata when empty.
+	OIDCJWKSURL string `env:"OIDC_JWKS_URL"`
+	// OIDCAudience is the expected aud claim of JWTs. The audience isn't
+	// checked when empty.
+	OIDCAudience string `env:"OIDC_AUDIENCE"`
+	// JWTExchangeCacheSize is the maximum number of PATs cached by the
+	// JWT to PAT exchange, the least recently used ones are evicted first.
+	JWTExchangeCacheSize int `env:"JWT_EXCHANGE_CACHE_SIZE" default:"10000"`
+	// TLSCertFile and TLSKeyFile make the HTTP transport serve HTTPS. The
+	// certificate is reloaded when the files change.
+	TLSCertFile string `env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE"`
+	// TLSClientCAFile is a PEM bundle of the CAs client certificates are
+	// verified against (mutual TLS). Requires TLSCertFile.
+	TLSClientCAFile string `env:"TLS_CLIENT_CA_FILE"`
+	// TLSClientAuth tells whether clients must present a certificate
+	// ("require") or may ("optional") when TLSClientCAFile is set.
+	TLSClientAuth string `env:"TLS_CLIENT_AUTH" default:"require"`
+	// RateLimitRPS is the sustained number of tool calls per second allowed
+	// for each client of the HTTP transport, identified by its PAT or IP
+	// address. 0 disables rate limiting.
+	RateLimitRPS float64 `env:"RATE_LIMIT_RPS" default:"0"`
+	// RateLimitBurst is the number of tool calls a client can make at once
+	// before RateLimitRPS applies.
+	RateLimitBurst int `env:"RATE_LIMIT_BURST" default:"20"`
+	// MaxConcurrentCallsPerClient caps the tool calls in flight for each
+	// client of the HTTP transport. 0 means no cap. Calls of long-running
+	// tools are capped separately.
+	MaxConcurrentCallsPerClient int `env:"MAX_CONCURRENT_CALLS_PER_CLIENT" default:"0"`
+	// SessionsEnabled makes the HTTP transport stateful: clients get a
+	// session ID on initialize and can open an SSE stream for progress
+	// notifications, log messages and list changed events. Stateless
+	// otherwise.
+	SessionsEnabled bool `env:"SESSIONS_ENABLED" default:"false"`
+	// SessionStore is where sessions are kept: "memory", or "dir:<path>" for
+	// a directory shared by replicas.
+	SessionStore string `env:"SESSION_STORE" default:"memory"`
+	// SessionIdleTimeout is how long a session lives without requests.
+	SessionIdleTimeout time.Duration `env:"SESSION_IDLE_TIMEOUT" default:"30m"`
+	// SessionHeartbeatInterval is how often a ping is sent on idle SSE
+	// streams, so proxies don't close them. 0 disables heartbeats.
+	SessionHeartbeatInterval time.Duration `env:"SESSION_HEARTBEAT_INTERVAL" default:"30s"`
+	// SubscriptionPollInterval is how often the builds and pipelines clients
+	// subscribed to are polled for status changes. The interval grows up to
+	// SubscriptionMaxPollInterval while the status doesn't change.
+	// Subscriptions need a stateful transport: stdio, sse, or http with
+	// SessionsEnabled.
+	SubscriptionPollInterval    time.Duration `env:"SUBSCRIPTION_POLL_INTERVAL" default:"10s"`
+	SubscriptionMaxPollInterval time.Duration `env:"SUBSCRIPTION_MAX_POLL_INTERVAL" default:"2m"`
+	// CompletionCacheTTL is how long the apps, workflows, branches and
+	// stacks argument completions are made of are cached per PAT.
+	CompletionCacheTTL time.Duration `env:"COMPLETION_CACHE_TTL" default:"1m"`
+	// OAuthServerEnabled turns on the built-in OAuth 2.1 authorization
+	// server, so remote MCP clients can authorize by pasting a Bitrise PAT
+	// once instead of sending it in a header. Can't be combined with
+	// ExternalOAuthIssuer.
+	OAuthServerEnabled bool `env:"OAUTH_SERVER_ENABLED" default:"false"`
+	// OAuthIssuer is the public base URL of the built-in authorization
+	// server. Derived from each request's Host and X-Forwarded-Proto
+	// headers when empty.
+	OAuthIssuer string `env:"OAUTH_ISSUER"`
+	// OAuthStore is where the built-in authorization server keeps clients
+	// and tokens: "memory" or "file:<path>".
+	OAuthStore string `env:"OAUTH_STORE" default:"memory"`
+	// OAuthAccessTokenTTL and OAuthRefreshTokenTTL are the lifetimes of the
+	// tokens issued by the built-in authorization server.
+	OAuthAccessTokenTTL  time.Duration `env:"OAUTH_ACCESS_TOKEN_TTL" default:"1h"`
+	OAuthRefreshTokenTTL time.Duration `env:"OAUTH_REFRESH_TOKEN_TTL" default:"720h"`
 	// BitriseAPIBaseURL overrides the Bitrise v0.1 API base URL
 	// (default: https://api.bitrise.io/v0.1). Useful for pointing at a
 	// test or local API instance.
 	BitriseAPIBaseURL string `env:"BITRISE_API_BASE_URL"`
+	// BitriseRMAPIBaseURL overrides the Release Management API base URL
+	// (default: https://api.bitrise.io/release-management/v1).
+	BitriseRMAPIBaseURL string `env:"BITRISE_RM_API_BASE_URL"`
+	// BitriseCodePushAPIBaseURL overrides the CodePush API base URL
+	// (default: https://api.bitrise.io/release-management/v2/code-push/v1).
+	BitriseCodePushAPIBaseURL string `env:"BITRISE_CODEPUSH_API_BASE_URL"`
+	// APITimeout is the timeout of a single Bitrise API request attempt.
+	APITimeout time.Duration `env:"API_TIMEOUT" default:"30s"`
+	// APIMaxRetries is the number of times a Bitrise API request is retried
+	// on network errors, 429 and 5xx responses. Only idempotent requests and
+	// requests carrying an idempotency key are retried. Set to 0 to disable.
+	APIMaxRetries int `env:"API_MAX_RETRIES" default:"3"`
+	// APIRetryInitialInterval is the base wait before the first retry; later
+	// waits grow exponentially with jitter.
+	APIRetryInitialInterval time.Duration `env:"API_RETRY_INITIAL_INTERVAL" default:"500ms"`
+	// APIRetryMaxInterval caps a single wait between retries, including waits
+	// requested by the API via Retry-After or X-RateLimit-Reset. Longer
+	// requested waits fail the call instead.
+	APIRetryMaxInterval time.Duration `env:"API_RETRY_MAX_INTERVAL" default:"30s"`
+	// APIRetryMaxElapsedTime bounds the total time spent on a single API call
+	// including all retries.
+	APIRetryMaxElapsedTime time.Duration `env:"API_RETRY_MAX_ELAPSED_TIME" default:"2m"`
 }
 
 func main() {
@@ -73,6 +244,23 @@ func run() error {
 	if cfg.BitriseAPIBaseURL != "" {
 		bitrise.APIBaseURL = cfg.BitriseAPIBaseURL
 	}
+	if cfg.BitriseRMAPIBaseURL != "" {
+		bitrise.APIRMBaseURL = cfg.BitriseRMAPIBaseURL
+	}
+	if cfg.BitriseCodePushAPIBaseURL != "" {
+		bitrise.APICodePushBaseURL = cfg.BitriseCodePushAPIBaseURL
+	}
+	bitrise.APITimeout = cfg.APITimeout
+	bitrise.APIRetryPolicy = bitrise.RetryPolicy{
+		MaxRetries:      cfg.APIMaxRetries,
+		InitialInterval: cfg.APIRetryInitialInterval,
+		MaxInterval:     cfg.APIRetryMaxInterval,
+		MaxElapsedTime:  cfg.APIRetryMaxElapsedTime,
+	}
+
+	if err := validateSafetyMode(cfg.SafetyMode); err != nil {
+		return err
+	}
 
 	logger, err := newStructuredLogger(cfg.LogLevel)
 	if err != nil {
@@ -89,36 +277,150 @@ func run() error {
 		}
 		defer tracer.Stop()
 	}
+	if cfg.OTLPEndpoint != "" {
+		shutdown, err := startOTLPTracing(cfg.OTLPEndpoint, cfg.OTLPHeaders)
+		if err != nil {
+			return fmt.Errorf("start otlp tracing: %w", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				logger.Warnw("flush otlp spans", "error", err)
+			}
+		}()
+	}
+
+	transport, err := cfg.transport()
+	if err != nil {
+		return err
+	}
 
 	toolBelt := tool.NewBelt()
+	toolAccess, err := newToolAccess(toolBelt, cfg.EnabledAPIGroups, cfg.EnabledTools, cfg.DisabledTools, logger)
+	if err != nil {
+		return err
+	}
+	// Clients of the stateless HTTP transport can't receive notifications.
+	subscribe := transport != transportHTTP || cfg.SessionsEnabled
+	hooks := &server.Hooks{}
 	mcpServer := server.NewMCPServer(
 		"bitrise",
 		BuildVersion,
-		server.WithToolFilter(func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
-			enabledGroups, err := bitrise.EnabledGroupsFromCtx(ctx) // http transport only
-			if err != nil {
-				// stdio transport/no tool filtering in http transport
-				enabledGroups = strings.Split(cfg.EnabledAPIGroups, ",")
-			}
-			var filtered []mcp.Tool
-			for _, tool := range tools {
-				if toolBelt.ToolEnabled(tool.Name, enabledGroups) {
-					filtered = append(filtered, tool)
-				}
-			}
-			return filtered
-		}),
+		server.WithToolFilter(toolAccess.filter),
+		server.WithToolFilter(safetyToolFilter(cfg.SafetyMode)),
+		server.WithElicitation(),
 		server.WithRecovery(),
 		server.WithToolCapabilities(false),
+		server.WithResourceCapabilities(subscribe, false),
+		server.WithPromptCapabilities(false),
 		server.WithLogging(),
+		server.WithHooks(hooks),
 	)
-	toolBelt.RegisterAll(mcpServer)
+	toolBelt.RegisterAll(mcpServer, cfg.ConfirmDestructiveTools)
+	// Also covers switch_profile, which is registered outside the belt.
+	tools := registeredTools{mcpServer: mcpServer}
+	resource.RegisterAll(mcpServer)
+	prompt.RegisterAll(mcpServer)
+	completer := completion.New(tool.ServerCaller(mcpServer), cfg.CompletionCacheTTL)
+	defer completer.Close()
+	intercept := &interceptor{completer: completer}
+	if subscribe {
+		if cfg.SubscriptionPollInterval <= 0 {
+			return fmt.Errorf("SUBSCRIPTION_POLL_INTERVAL must be positive")
+		}
+		intercept.subs = newSubscriptions(mcpServer, hooks, cfg.SubscriptionPollInterval, cfg.SubscriptionMaxPollInterval)
+		defer intercept.subs.Close()
+	}
+	if transport == transportStdio {
+		// Registered first so the PAT is available to every other middleware.
+		tokens, err := tokenSource{
+			Token:   cfg.BitriseToken,
+			File:    cfg.BitriseTokenFile,
+			Command: cfg.BitriseTokenCommand,
+		}.provider(cfg.BitriseTokenRefreshInterval, logger)
+		if err != nil {
+			return fmt.Errorf("only one of BITRISE_TOKEN, BITRISE_TOKEN_FILE and BITRISE_TOKEN_COMMAND can be provided")
+		}
+		switch {
+		case cfg.ConfigFile != "":
+			profiles, err := loadProfiles(context.Background(), cfg, tokens, toolBelt, mcpServer, logger)
+			if err != nil {
+				return err
+			}
+			toolAccess.profileGroups = profiles.enabledGroups
+			intercept.credentials = func(ctx context.Context) (context.Context, error) {
+				ctx, _, err := profiles.withActiveProfile(ctx)
+				return ctx, err
+			}
+			mcpServer.AddTool(profiles.switchProfileTool())
+			server.WithToolHandlerMiddleware(profiles.middleware)(mcpServer)
+			server.WithResourceHandlerMiddleware(profiles.resourceMiddleware)(mcpServer)
+		case tokens != nil:
+			// Fail early if the credential helper doesn't work.
+			if _, err := tokens.Token(context.Background()); err != nil {
+				return fmt.Errorf("get bitrise token: %w", err)
+			}
+			server.WithToolHandlerMiddleware(stdioPATMiddleware(tokens))(mcpServer)
+			server.WithResourceHandlerMiddleware(stdioPATResourceMiddleware(tokens))(mcpServer)
+			intercept.credentials = func(ctx context.Context) (context.Context, error) {
+				pat, err := tokens.Token(ctx)
+				if err != nil {
+					return ctx, fmt.Errorf("get bitrise token: %w", err)
+				}
+				return bitrise.ContextWithPAT(ctx, pat), nil
+			}
+		default:
+			return fmt.Errorf("BITRISE_TOKEN, BITRISE_TOKEN_FILE, BITRISE_TOKEN_COMMAND or CONFIG_FILE must be provided in stdio transport mode")
+		}
+		if cfg.MetricsEnabled {
+			return fmt.Errorf("METRICS_ENABLED is only supported in http transport mode")
+		}
+		if cfg.RateLimitRPS > 0 || cfg.MaxConcurrentCallsPerClient > 0 {
+			return fmt.Errorf("RATE_LIMIT_RPS and MAX_CONCURRENT_CALLS_PER_CLIENT are only supported in http transport mode")
+		}
+	}
+	var metrics *serverMetrics
+	if cfg.MetricsEnabled {
+		metrics = newServerMetrics()
+		server.WithToolHandlerMiddleware(metrics.middleware(transport))(mcpServer)
+	}
+	if cfg.RateLimitRPS > 0 || cfg.MaxConcurrentCallsPerClient > 0 {
+		limiter := newRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.MaxConcurrentCallsPerClient, toolBelt.LongRunning)
+		server.WithToolHandlerMiddleware(limiter.middleware)(mcpServer)
+	}
+	var audit *auditor
+	if cfg.AuditLog != "" {
+		sinks, err := newAuditSinks(cfg.AuditLog, transport == transportStdio)
+		if err != nil {
+			return err
+		}
+		audit = newAuditor(sinks, tools.ReadOnly, transport, logger)
+		defer audit.Close()
+		// Records the calls the following middlewares reject.
+		server.WithToolHandlerMiddleware(audit.rejections)(mcpServer)
+	}
+	server.WithToolHandlerMiddleware(toolAccess.middleware)(mcpServer)
+	server.WithResourceHandlerMiddleware(toolAccess.resourceMiddleware)(mcpServer)
+	server.WithToolHandlerMiddleware(safetyMiddleware(tools.ReadOnly, cfg.SafetyMode))(mcpServer)
+	if cfg.ConfirmDestructiveTools {
+		secret := []byte(cfg.ConfirmationSecret)
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return fmt.Errorf("generate confirmation secret: %w", err)
+			}
+		}
+		confirmer := newConfirmer(mcpServer, tools, secret)
+		server.WithToolHandlerMiddleware(confirmer.middleware)(mcpServer)
+	}
+	if audit != nil {
+		// Inside the confirmer, so only confirmed calls are recorded as
+		// executed and the confirmer's own API calls are not counted.
+		server.WithToolHandlerMiddleware(audit.middleware)(mcpServer)
+	}
 
 	if cfg.DatadogTracingEnabled {
-		transport := "http"
-		if cfg.Addr == "" {
-			transport = "stdio"
-		}
 		server.WithToolHandlerMiddleware(func(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
 			return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				span, ctx := tracer.StartSpanFromContext(ctx, "mcp.tool",
@@ -145,68 +447,167 @@ func run() error {
 		})(mcpServer)
 	}
 
-	if cfg.Addr == "" {
+	if cfg.OTLPEndpoint != "" {
+		server.WithToolHandlerMiddleware(otelToolMiddleware(transport))(mcpServer)
+	}
+
+	if transport == transportStdio {
 		logger.Info("no address specified, starting stdio transport")
-		return runStdioTransport(cfg, mcpServer)
+		return runStdioTransport(mcpServer, intercept)
+	}
+	logger.Infof("starting %s transport", transport)
+	return runHTTPTransport(mcpServer, logger, cfg, transport, metrics, intercept)
+}
+
+// transport returns the transport to serve, checking that it has an address
+// to listen on.
+func (c config) transport() (string, error) {
+	switch c.Transport {
+	case "":
+		switch {
+		case c.SSEAddr != "":
+			return transportSSE, nil
+		case c.Addr != "":
+			return transportHTTP, nil
+		}
+		return transportStdio, nil
+	case transportStdio:
+		return transportStdio, nil
+	case transportHTTP:
+		if c.Addr == "" {
+			return "", fmt.Errorf("ADDR must be provided in http transport mode")
+		}
+		return transportHTTP, nil
+	case transportSSE:
+		if c.listenAddr(transportSSE) == "" {
+			return "", fmt.Errorf("SSE_ADDR or ADDR must be provided in sse transport mode")
+		}
+		return transportSSE, nil
 	}
-	logger.Info("starting http transport")
-	return runHTTPTransport(mcpServer, logger, cfg)
+	return "", fmt.Errorf("invalid TRANSPORT %q: use stdio, http or sse", c.Transport)
 }
 
-func runStdioTransport(cfg config, mcpServer *server.MCPServer) error {
-	if cfg.BitriseToken == "" {
-		return fmt.Errorf("BITRISE_TOKEN must be provided in stdio transport mode")
+// listenAddr is the address the HTTP based transport listens on, the SSE
+// transport falls back to Addr.
+func (c config) listenAddr(transport string) string {
+	if transport == transportSSE && c.SSEAddr != "" {
+		return c.SSEAddr
 	}
+	return c.Addr
+}
 
-	server.WithToolHandlerMiddleware(func(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+// stdioPATMiddleware injects the configured PAT into every tool call of the
+// stdio transport.
+func stdioPATMiddleware(tokens tokenProvider) server.ToolHandlerMiddleware {
+	return func(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
 		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			return fn(bitrise.ContextWithPAT(ctx, cfg.BitriseToken), request)
+			pat, err := tokens.Token(ctx)
+			if err != nil {
+				return mcp.NewToolResultErrorFromErr("get bitrise token", err), nil
+			}
+			return fn(bitrise.ContextWithPAT(ctx, pat), request)
+		}
+	}
+}
+
+// stdioPATResourceMiddleware injects the configured PAT into every resource
+// read of the stdio transport.
+func stdioPATResourceMiddleware(tokens tokenProvider) server.ResourceHandlerMiddleware {
+	return func(fn server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+		return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			pat, err := tokens.Token(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("get bitrise token: %w", err)
+			}
+			return fn(bitrise.ContextWithPAT(ctx, pat), request)
 		}
-	})(mcpServer)
-	if err := server.ServeStdio(mcpServer); err != nil {
+	}
+}
+
+func runStdioTransport(mcpServer *server.MCPServer, intercept *interceptor) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// Intercepted responses are written next to the stdio server's messages.
+	out := &stdioOutput{w: os.Stdout}
+	if err := server.NewStdioServer(mcpServer).Listen(ctx, intercept.stdioInput(ctx, os.Stdin, out), out); err != nil {
 		return fmt.Errorf("serve stdio: %w", err)
 	}
 	return nil
 }
 
-func runHTTPTransport(mcpServer *server.MCPServer, logger *zap.SugaredLogger, cfg config) error {
+// runHTTPTransport serves streamable HTTP, or the legacy HTTP+SSE transport,
+// with the same authentication, headers and endpoints.
+func runHTTPTransport(mcpServer *server.MCPServer, logger *zap.SugaredLogger, cfg config, transport string, metrics *serverMetrics, intercept *interceptor) error {
 	if cfg.BitriseToken != "" {
 		return fmt.Errorf("BITRISE_TOKEN cannot be provided in http transport mode")
 	}
+	if cfg.BitriseTokenFile != "" || cfg.BitriseTokenCommand != "" {
+		return fmt.Errorf("BITRISE_TOKEN_FILE and BITRISE_TOKEN_COMMAND cannot be provided in http transport mode")
+	}
+	if cfg.ConfigFile != "" {
+		return fmt.Errorf("CONFIG_FILE cannot be provided in http transport mode")
+	}
 
 	var exchanger *jwtExchanger
 	if cfg.OIDCTokenEndpoint != "" {
-		exchanger = &jwtExchanger{tokenEndpoint: cfg.OIDCTokenEndpoint, logger: logger}
-	}
-
-	mcpHandler := server.NewStreamableHTTPServer(
-		mcpServer,
-		server.WithStateLess(true),
-		server.WithHTTPContextFunc(func(ctx context.Context, r *http.Request) context.Context {
-			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-			if token != "" {
-				pat := token
-				if exchanger != nil && isJWT(token) {
-					var err error
-					pat, err = exchanger.exchange(r.Context(), token)
-					if err != nil {
-						logger.Warnw("JWT→PAT exchange failed", "error", err)
-						return ctx
-					}
-				}
-				ctx = bitrise.ContextWithPAT(ctx, pat)
+		// JWTs are only exchanged after verifying them against the issuer.
+		if cfg.ExternalOAuthIssuer == "" {
+			return fmt.Errorf("OIDC_TOKEN_ENDPOINT requires EXTERNAL_OAUTH_ISSUER to verify JWTs")
+		}
+		jwksURL := cfg.OIDCJWKSURL
+		if jwksURL == "" {
+			var err error
+			if jwksURL, err = discoverJWKSURL(context.Background(), cfg.ExternalOAuthIssuer); err != nil {
+				return fmt.Errorf("set OIDC_JWKS_URL or fix the issuer metadata: %w", err)
 			}
-			// server.WithToolFilter can use it to limit the tools listed.
-			enabledGroups := r.Header.Get("x-bitrise-enabled-api-groups")
-			if enabledGroups != "" {
-				a := strings.Split(enabledGroups, ",")
-				ctx = bitrise.ContextWithEnabledGroups(ctx, a)
+		}
+		exchanger = newJWTExchanger(cfg.OIDCTokenEndpoint, cfg.JWTExchangeCacheSize, logger, metrics)
+		defer exchanger.Close()
+		exchanger.verifier = newJWTVerifier(cfg.ExternalOAuthIssuer, cfg.OIDCAudience, jwksURL)
+	}
+
+	var mcpHandler http.Handler
+	var sessions *session.Manager
+	switch transport {
+	case transportSSE:
+		if cfg.SessionsEnabled {
+			return fmt.Errorf("SESSIONS_ENABLED is only supported in http transport mode, sse connections are sessions already")
+		}
+		// Each client opens an SSE stream on /sse and posts its messages to the
+		// /message endpoint announced on it.
+		sseOpts := []server.SSEOption{server.WithSSEContextFunc(httpContextFunc)}
+		if cfg.SessionHeartbeatInterval > 0 {
+			sseOpts = append(sseOpts, server.WithKeepAliveInterval(cfg.SessionHeartbeatInterval))
+		}
+		sseServer := server.NewSSEServer(mcpServer, sseOpts...)
+		mcpHandler = intercept.sseMiddleware(sseServer, sseServer)
+	default:
+		// Stateless unless sessions are enabled: no session IDs and no SSE stream.
+		var sessionIDs server.SessionIdManagerResolver = server.NewDefaultSessionIdManagerResolver(&server.StatelessSessionIdManager{})
+		if cfg.SessionsEnabled {
+			store, err := session.NewStore(cfg.SessionStore)
+			if err != nil {
+				return err
 			}
-			return ctx
-		}),
-		server.WithLogger(logger),
-		server.WithDisableStreaming(true),
-	)
+			sessions = session.NewManager(store, cfg.SessionIdleTimeout, func(id string) {
+				mcpServer.UnregisterSession(context.Background(), id)
+			})
+			defer sessions.Close()
+			sessionIDs = sessions
+		}
+		mcpHandler = server.NewStreamableHTTPServer(
+			mcpServer,
+			server.WithSessionIdManagerResolver(sessionIDs),
+			server.WithHTTPContextFunc(httpContextFunc),
+			server.WithLogger(logger),
+			server.WithHeartbeatInterval(cfg.SessionHeartbeatInterval),
+			server.WithDisableStreaming(sessions == nil),
+		)
+		if sessions != nil {
+			mcpHandler = sessions.Middleware(mcpHandler)
+		}
+		mcpHandler = intercept.streamableMiddleware(sessions, mcpHandler)
+	}
 
 	type router interface {
 		http.Handler
@@ -221,9 +622,42 @@ func runHTTPTransport(mcpServer *server.MCPServer, logger *zap.SugaredLogger, cf
 	}
 	mux.HandleFunc("/readyz", readyzHandler)
 	mux.HandleFunc("/livez", livezHandler)
+	if metrics != nil {
+		mux.HandleFunc("/metrics", metrics.registry.ServeHTTP)
+	}
 	if cfg.ExternalOAuthIssuer != "" {
-		mux.HandleFunc("/.well-known/oauth-protected-resource", oauthProtectedResourceHandler(cfg.ExternalOAuthIssuer))
+		mux.HandleFunc(oauthProtectedResourcePath, oauthProtectedResourceHandler(cfg.ExternalOAuthIssuer))
+	}
+	var oauthServer *oauth.Server
+	if cfg.OAuthServerEnabled {
+		if cfg.ExternalOAuthIssuer != "" {
+			return fmt.Errorf("OAUTH_SERVER_ENABLED and EXTERNAL_OAUTH_ISSUER cannot be used together")
+		}
+		store, err := oauth.NewStore(cfg.OAuthStore)
+		if err != nil {
+			return err
+		}
+		oauthServer = &oauth.Server{
+			Issuer:          cfg.OAuthIssuer,
+			Store:           store,
+			AccessTokenTTL:  cfg.OAuthAccessTokenTTL,
+			RefreshTokenTTL: cfg.OAuthRefreshTokenTTL,
+			ValidatePAT:     validatePAT,
+		}
+		oauthServer.Register(mux)
+		mux.HandleFunc(oauthProtectedResourcePath, oauthProtectedResourceHandler(cfg.OAuthIssuer))
+	}
+	auth := &bearerAuth{
+		exchanger:       exchanger,
+		oauthServer:     oauthServer,
+		advertisesOAuth: cfg.ExternalOAuthIssuer != "" || cfg.OAuthServerEnabled,
+		logger:          logger,
 	}
+	httpServer := &http.Server{
+		Addr:    cfg.listenAddr(transport),
+		Handler: mux,
+	}
+	mcpAuthHandler := auth.wrap(endStreamsOnShutdown(httpServer, mcpHandler))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// If the request looks like it's from a browser (Sec-Fetch-Mode: navigate),
 		// redirect to the documentation instead of handling as MCP request.
@@ -232,25 +666,39 @@ func runHTTPTransport(mcpServer *server.MCPServer, logger *zap.SugaredLogger, cf
 			return
 		}
 		// Otherwise, handle as MCP request
-		mcpHandler.ServeHTTP(w, r)
+		mcpAuthHandler.ServeHTTP(w, r)
 	})
 
-	httpServer := &http.Server{
-		Addr:    cfg.Addr,
-		Handler: mux,
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be provided together")
+		}
+		tlsConfig, err := newTLSConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, cfg.TLSClientAuth, logger)
+		if err != nil {
+			return err
+		}
+		httpServer.TLSConfig = tlsConfig
+	} else if cfg.TLSClientCAFile != "" {
+		return fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
 	}
 
 	// Start the HTTP server in another goroutine.
 	errListen := make(chan error, 1)
 	go func() {
-		err := httpServer.ListenAndServe()
+		var err error
+		if httpServer.TLSConfig != nil {
+			// The certificate comes from TLSConfig.GetCertificate.
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = httpServer.ListenAndServe()
+		}
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errListen <- fmt.Errorf("listen and serve: %w", err)
 			return
 		}
 		errListen <- nil
 	}()
-	logger.Infof("started listening on %q", cfg.Addr)
+	logger.Infof("started listening on %q", httpServer.Addr)
 
 	ctx := context.Background()
 	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
@@ -299,6 +747,54 @@ func newStructuredLogger(level string) (*zap.SugaredLogger, error) {
 	return logger.Sugar(), nil
 }
 
+// httpContextFunc carries the headers of an HTTP request, its trace and its
+// client into the context of the MCP request.
+func httpContextFunc(ctx context.Context, r *http.Request) context.Context {
+	// Continue the caller's trace, if any (no-op unless OTLP tracing is on).
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	// server.WithToolFilter can use it to limit the tools listed.
+	enabledGroups := r.Header.Get("x-bitrise-enabled-api-groups")
+	if enabledGroups != "" {
+		a := strings.Split(enabledGroups, ",")
+		ctx = bitrise.ContextWithEnabledGroups(ctx, a)
+	}
+	if enabledTools := r.Header.Get("x-bitrise-enabled-tools"); enabledTools != "" {
+		ctx = bitrise.ContextWithEnabledTools(ctx, tool.SplitList(enabledTools))
+	}
+	if disabledTools := r.Header.Get("x-bitrise-disabled-tools"); disabledTools != "" {
+		ctx = bitrise.ContextWithDisabledTools(ctx, tool.SplitList(disabledTools))
+	}
+	if safetyMode := r.Header.Get("x-bitrise-safety-mode"); safetyMode != "" {
+		ctx = bitrise.ContextWithSafetyMode(ctx, safetyMode)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ctx = bitrise.ContextWithClientIP(ctx, host)
+	}
+	// Only verified certificates get here, unverified ones fail the handshake.
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		ctx = bitrise.ContextWithClientCertSubject(ctx, r.TLS.PeerCertificates[0].Subject.String())
+	}
+	return ctx
+}
+
+// endStreamsOnShutdown cancels GET requests, the long-lived SSE streams of
+// both HTTP transports, when the server shuts down. They would hold up the
+// graceful shutdown otherwise.
+func endStreamsOnShutdown(httpServer *http.Server, next http.Handler) http.Handler {
+	shutdown, cancel := context.WithCancel(context.Background())
+	httpServer.RegisterOnShutdown(cancel)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			stop := context.AfterFunc(shutdown, cancel)
+			defer stop()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func readyzHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigTransport(t *testing.T) {
+	cases := map[string]struct {
+		cfg        config
+		want       string
+		wantAddr   string
+		wantErrStr string
+	}{
+		"stdio":                {want: transportStdio},
+		"http":                 {cfg: config{Addr: ":8080"}, want: transportHTTP, wantAddr: ":8080"},
+		"sse address":          {cfg: config{SSEAddr: ":8081"}, want: transportSSE, wantAddr: ":8081"},
+		"sse on ADDR":          {cfg: config{Transport: "sse", Addr: ":8080"}, want: transportSSE, wantAddr: ":8080"},
+		"sse without address":  {cfg: config{Transport: "sse"}, wantErrStr: "SSE_ADDR or ADDR must be provided"},
+		"http without address": {cfg: config{Transport: "http"}, wantErrStr: "ADDR must be provided"},
+		"explicit stdio":       {cfg: config{Transport: "stdio", Addr: ":8080"}, want: transportStdio},
+		"unknown":              {cfg: config{Transport: "websocket"}, wantErrStr: "invalid TRANSPORT"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.cfg.transport()
+			if tc.wantErrStr != "" {
+				assert.ErrorContains(t, err, tc.wantErrStr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			if got != transportStdio {
+				assert.Equal(t, tc.wantAddr, tc.cfg.listenAddr(got))
+			}
+		})
+	}
+}
+
+func TestEndStreamsOnShutdown(t *testing.T) {
+	httpServer := &http.Server{}
+	started := make(chan struct{})
+	handler := endStreamsOnShutdown(httpServer, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sse", nil))
+	}()
+	<-started
+	assert.NoError(t, httpServer.Shutdown(t.Context()))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream is still open")
+	}
+}
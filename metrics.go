@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/metrics"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/ttlcache"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// serverMetrics are the metrics served on /metrics. A nil *serverMetrics
+// records nothing.
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	toolCalls        *metrics.CounterVec
+	toolCallDuration *metrics.HistogramVec
+	apiDuration      *metrics.HistogramVec
+	jwtCache         *metrics.CounterVec
+	jwtCacheEvicted  *metrics.CounterVec
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry: r,
+		toolCalls: r.NewCounterVec("bitrise_mcp_tool_calls_total",
+			"Number of MCP tool calls by result (success or error).",
+			"tool", "transport", "result"),
+		toolCallDuration: r.NewHistogramVec("bitrise_mcp_tool_call_duration_seconds",
+			"Duration of MCP tool calls.",
+			metrics.DefaultBuckets, "tool", "transport"),
+		apiDuration: r.NewHistogramVec("bitrise_mcp_api_request_duration_seconds",
+			"Duration of Bitrise API calls including retries, by path template and status code (0 when no response was received).",
+			metrics.DefaultBuckets, "method", "path", "status"),
+		jwtCache: r.NewCounterVec("bitrise_mcp_jwt_exchange_cache_requests_total",
+			"Number of JWT to PAT exchange cache lookups by result (hit, miss, or shared when joining an exchange in flight).",
+			"result"),
+		jwtCacheEvicted: r.NewCounterVec("bitrise_mcp_jwt_exchange_cache_evictions_total",
+			"Number of PATs evicted from the JWT to PAT exchange cache by reason (expired or capacity).",
+			"reason"),
+	}
+}
+
+// middleware records tool call metrics and the metrics of the Bitrise API
+// calls made by the tool.
+func (m *serverMetrics) middleware(transport string) server.ToolHandlerMiddleware {
+	return func(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name := request.Params.Name
+			ctx = bitrise.ContextWithAPICallObserver(ctx, func(call bitrise.APICall) {
+				m.apiDuration.Observe(call.Duration.Seconds(), call.Method, call.PathTemplate, strconv.Itoa(call.StatusCode))
+			})
+			start := time.Now()
+
+			result, err := fn(ctx, request)
+
+			m.toolCallDuration.Observe(time.Since(start).Seconds(), name, transport)
+			outcome := "success"
+			if err != nil || (result != nil && result.IsError) {
+				outcome = "error"
+			}
+			m.toolCalls.Inc(name, transport, outcome)
+			return result, err
+		}
+	}
+}
+
+func (m *serverMetrics) jwtCacheLookup(result ttlcache.Result) {
+	if m == nil {
+		return
+	}
+	m.jwtCache.Inc(string(result))
+}
+
+func (m *serverMetrics) jwtCacheEviction(reason ttlcache.EvictionReason) {
+	if m == nil {
+		return
+	}
+	m.jwtCacheEvicted.Inc(string(reason))
+}
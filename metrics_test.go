@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestServerMetricsMiddleware(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer api.Close()
+
+	m := newServerMetrics()
+	handler := m.middleware("http")(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if request.GetString("app_slug", "") == "" {
+			return mcp.NewToolResultError("app_slug is required"), nil
+		}
+		_, err := bitrise.CallAPI(bitrise.ContextWithBaseURLs(ctx, bitrise.BaseURLs{API: api.URL}), bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			Path:   "/apps/" + request.GetString("app_slug", ""),
+		})
+		if err != nil {
+			return bitrise.NewToolResultErrorFromErr("call api", err), nil
+		}
+		return mcp.NewToolResultText("ok"), nil
+	})
+	call := func(args map[string]any) {
+		var request mcp.CallToolRequest
+		request.Params.Name = "get_app"
+		request.Params.Arguments = args
+		_, err := handler(bitrise.ContextWithPAT(t.Context(), "pat"), request)
+		assert.NoError(t, err)
+	}
+
+	call(map[string]any{"app_slug": "abc"})
+	call(map[string]any{"app_slug": "def"})
+	call(nil)
+
+	assert.Equal(t, float64(2), m.toolCalls.Value("get_app", "http", "success"))
+	assert.Equal(t, float64(1), m.toolCalls.Value("get_app", "http", "error"))
+	assert.Equal(t, uint64(3), m.toolCallDuration.Count("get_app", "http"))
+	assert.Equal(t, uint64(2), m.apiDuration.Count(http.MethodGet, "/apps/{app_slug}", "200"))
+}
+
+func TestJWTExchangeCacheMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"pat"}`))
+	}))
+	defer srv.Close()
+
+	m := newServerMetrics()
+	exchanger := newJWTExchanger(srv.URL, 1, zap.NewNop().Sugar(), m)
+	defer exchanger.Close()
+	for range 3 {
+		_, err := exchanger.exchange(t.Context(), "eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ1c2VyIn0.sig")
+		assert.NoError(t, err)
+	}
+	_, err := exchanger.exchange(t.Context(), "eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJvdGhlciJ9.sig")
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(2), m.jwtCache.Value("miss"))
+	assert.Equal(t, float64(2), m.jwtCache.Value("hit"))
+	assert.Equal(t, float64(1), m.jwtCacheEvicted.Value("capacity"))
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const otlpExportTimeout = 10 * time.Second
+
+// startOTLPTracing installs a global tracer provider exporting spans to the
+// OTLP/HTTP endpoint of an OpenTelemetry collector. The returned function
+// flushes the pending spans.
+func startOTLPTracing(endpoint, headers string) (func(context.Context) error, error) {
+	exporter, err := newOTLPExporter(endpoint, headers)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "bitrise-mcp"),
+			attribute.String("service.version", BuildVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// otlpExporter sends spans to <endpoint>/v1/traces as OTLP/HTTP protobuf.
+type otlpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// newOTLPExporter creates an exporter. headers is a comma-separated list of
+// key=value pairs, as in OTEL_EXPORTER_OTLP_HEADERS.
+func newOTLPExporter(endpoint, headers string) (*otlpExporter, error) {
+	e := &otlpExporter{
+		url:     strings.TrimRight(endpoint, "/") + "/v1/traces",
+		headers: map[string]string{},
+		client:  &http.Client{Timeout: otlpExportTimeout},
+	}
+	for _, pair := range strings.Split(headers, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid OTLP header %q: expected key=value", pair)
+		}
+		e.headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return e, nil
+}
+
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := (&ptrace.ProtoMarshaler{}).MarshalTraces(toOTLPTraces(spans))
+	if err != nil {
+		return fmt.Errorf("marshal spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("export spans: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("export spans: unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (e *otlpExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// toOTLPTraces converts finished spans to the OTLP data model, grouped by
+// resource and instrumentation scope.
+func toOTLPTraces(spans []sdktrace.ReadOnlySpan) ptrace.Traces {
+	td := ptrace.NewTraces()
+	resourceSpans := map[*resource.Resource]ptrace.ResourceSpans{}
+	scopeSpans := map[*resource.Resource]map[string]ptrace.ScopeSpans{}
+	for _, s := range spans {
+		res := s.Resource()
+		rs, ok := resourceSpans[res]
+		if !ok {
+			rs = td.ResourceSpans().AppendEmpty()
+			putAttributes(rs.Resource().Attributes(), res.Attributes())
+			resourceSpans[res] = rs
+			scopeSpans[res] = map[string]ptrace.ScopeSpans{}
+		}
+		scope := s.InstrumentationScope()
+		ss, ok := scopeSpans[res][scope.Name]
+		if !ok {
+			ss = rs.ScopeSpans().AppendEmpty()
+			ss.Scope().SetName(scope.Name)
+			ss.Scope().SetVersion(scope.Version)
+			scopeSpans[res][scope.Name] = ss
+		}
+
+		span := ss.Spans().AppendEmpty()
+		span.SetTraceID(pcommon.TraceID(s.SpanContext().TraceID()))
+		span.SetSpanID(pcommon.SpanID(s.SpanContext().SpanID()))
+		if s.Parent().IsValid() {
+			span.SetParentSpanID(pcommon.SpanID(s.Parent().SpanID()))
+		}
+		span.SetName(s.Name())
+		span.SetKind(ptrace.SpanKind(s.SpanKind())) // the enums have the same values
+		span.SetStartTimestamp(pcommon.NewTimestampFromTime(s.StartTime()))
+		span.SetEndTimestamp(pcommon.NewTimestampFromTime(s.EndTime()))
+		putAttributes(span.Attributes(), s.Attributes())
+		for _, event := range s.Events() {
+			e := span.Events().AppendEmpty()
+			e.SetName(event.Name)
+			e.SetTimestamp(pcommon.NewTimestampFromTime(event.Time))
+			putAttributes(e.Attributes(), event.Attributes)
+		}
+		switch s.Status().Code {
+		case codes.Error:
+			span.Status().SetCode(ptrace.StatusCodeError)
+			span.Status().SetMessage(s.Status().Description)
+		case codes.Ok:
+			span.Status().SetCode(ptrace.StatusCodeOk)
+		}
+	}
+	return td
+}
+
+func putAttributes(dest pcommon.Map, attrs []attribute.KeyValue) {
+	for _, kv := range attrs {
+		key := string(kv.Key)
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			dest.PutBool(key, kv.Value.AsBool())
+		case attribute.INT64:
+			dest.PutInt(key, kv.Value.AsInt64())
+		case attribute.FLOAT64:
+			dest.PutDouble(key, kv.Value.AsFloat64())
+		case attribute.STRING:
+			dest.PutStr(key, kv.Value.AsString())
+		default:
+			dest.PutStr(key, kv.Value.Emit())
+		}
+	}
+}
+
+// otelToolMiddleware creates a span for each tool call. Bitrise API calls and
+// log downloads made by the tool are recorded as its child spans, the status
+// of the last API response is recorded on the tool span too.
+func otelToolMiddleware(transport string) server.ToolHandlerMiddleware {
+	return func(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			attrs := []attribute.KeyValue{
+				attribute.String("mcp.tool", request.Params.Name),
+				attribute.String("mcp.transport", transport),
+			}
+			if appSlug := request.GetString("app_slug", ""); appSlug != "" {
+				attrs = append(attrs, bitrise.AppSlugAttribute(appSlug))
+			}
+			if subject := bitrise.ClientCertSubjectFromCtx(ctx); subject != "" {
+				attrs = append(attrs, attribute.String("tls.client.subject", subject))
+			}
+			ctx, span := bitrise.Tracer().Start(ctx, "mcp.tool "+request.Params.Name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attrs...),
+			)
+			defer span.End()
+			var status int
+			ctx = bitrise.ContextWithAPICallObserver(ctx, func(call bitrise.APICall) {
+				status = call.StatusCode
+			})
+
+			result, err := fn(ctx, request)
+
+			if status != 0 {
+				span.SetAttributes(attribute.Int("http.response.status_code", status))
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return result, err
+			}
+			// Call itself was successful but the result is an error
+			if result != nil && result.IsError {
+				span.SetAttributes(attribute.Bool("mcp.tool.is_error", true))
+				span.SetStatus(codes.Error, "tool returned an error result")
+			}
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestOTLPTracing(t *testing.T) {
+	var received []ptrace.Traces
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		body, _ := io.ReadAll(r.Body)
+		td, err := (&ptrace.ProtoUnmarshaler{}).UnmarshalTraces(body)
+		assert.NoError(t, err)
+		received = append(received, td)
+	}))
+	defer collector.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer api.Close()
+
+	exporter, err := newOTLPExporter(collector.URL+"/", "X-Api-Key=secret")
+	assert.NoError(t, err)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	handler := otelToolMiddleware("stdio")(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		_, err := bitrise.CallAPI(bitrise.ContextWithBaseURLs(ctx, bitrise.BaseURLs{API: api.URL}), bitrise.CallAPIParams{
+			Method: http.MethodGet,
+			Path:   "/apps/abc/builds/def",
+		})
+		return bitrise.NewToolResultErrorFromErr("call api", err), nil
+	})
+	var request mcp.CallToolRequest
+	request.Params.Name = "get_build"
+	request.Params.Arguments = map[string]any{"app_slug": "abc"}
+	_, err = handler(bitrise.ContextWithPAT(t.Context(), "pat"), request)
+	assert.NoError(t, err)
+	assert.NoError(t, provider.Shutdown(t.Context()))
+
+	spans := map[string]ptrace.Span{}
+	for _, td := range received {
+		rss := td.ResourceSpans()
+		for i := range rss.Len() {
+			sss := rss.At(i).ScopeSpans()
+			for j := range sss.Len() {
+				assert.Equal(t, bitrise.TracerName, sss.At(j).Scope().Name())
+				ss := sss.At(j).Spans()
+				for k := range ss.Len() {
+					spans[ss.At(k).Name()] = ss.At(k)
+				}
+			}
+		}
+	}
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+
+	tool := spans["mcp.tool get_build"]
+	assert.Equal(t, ptrace.SpanKindServer, tool.Kind())
+	assert.Equal(t, ptrace.StatusCodeError, tool.Status().Code())
+	assert.Equal(t, map[string]any{
+		"mcp.tool":                  "get_build",
+		"mcp.transport":             "stdio",
+		"bitrise.app_slug":          "abc",
+		"http.response.status_code": int64(404),
+		"mcp.tool.is_error":         true,
+	}, tool.Attributes().AsRaw())
+
+	call := spans["bitrise.api GET /apps/{app_slug}/builds/{build_slug}"]
+	assert.Equal(t, ptrace.SpanKindClient, call.Kind())
+	assert.Equal(t, tool.TraceID(), call.TraceID())
+	assert.Equal(t, tool.SpanID(), call.ParentSpanID())
+	assert.Equal(t, ptrace.StatusCodeError, call.Status().Code())
+	assert.Equal(t, map[string]any{
+		"http.request.method":       "GET",
+		"url.template":              "/apps/{app_slug}/builds/{build_slug}",
+		"bitrise.app_slug":          "abc",
+		"http.response.status_code": int64(404),
+	}, call.Attributes().AsRaw())
+}
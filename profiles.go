@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// profilesFile is the config file holding named profiles, e.g. one per
+// Bitrise account or workspace.
+type profilesFile struct {
+	// DefaultProfile is the profile active when a session starts. It can be
+	// omitted when there is a single profile.
+	DefaultProfile string             `yaml:"default_profile" toml:"default_profile"`
+	Profiles       map[string]profile `yaml:"profiles" toml:"profiles"`
+}
+
+type profile struct {
+	// Token is the PAT itself. Prefer another token source to keep it out
+	// of the file.
+	Token string `yaml:"token" toml:"token"`
+	// TokenEnv is the name of the environment variable holding the PAT.
+	TokenEnv string `yaml:"token_env" toml:"token_env"`
+	// TokenFile is the path of a file holding the PAT.
+	TokenFile string `yaml:"token_file" toml:"token_file"`
+	// TokenCommand is a shell command printing the PAT, e.g. a credential
+	// helper.
+	TokenCommand string `yaml:"token_command" toml:"token_command"`
+	// Base URLs of the Bitrise APIs, the defaults are used when empty.
+	APIBaseURL         string `yaml:"api_base_url" toml:"api_base_url"`
+	RMAPIBaseURL       string `yaml:"rm_api_base_url" toml:"rm_api_base_url"`
+	CodePushAPIBaseURL string `yaml:"codepush_api_base_url" toml:"codepush_api_base_url"`
+	// EnabledAPIGroups replaces ENABLED_API_GROUPS while the profile is
+	// active.
+	EnabledAPIGroups []string `yaml:"enabled_api_groups" toml:"enabled_api_groups"`
+	// DefaultWorkspace is used as workspace_slug (or organization_slug) when
+	// a tool call doesn't set it.
+	DefaultWorkspace string `yaml:"default_workspace" toml:"default_workspace"`
+}
+
+// loadProfilesFile reads a .toml, .yaml or .yml profiles file.
+func loadProfilesFile(path string) (profilesFile, error) {
+	var f profilesFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, fmt.Errorf("read config file: %w", err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		err = toml.Unmarshal(data, &f)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &f)
+	default:
+		return f, fmt.Errorf("unsupported config file extension %q: use .toml, .yaml or .yml", ext)
+	}
+	if err != nil {
+		return f, fmt.Errorf("parse config file: %w", err)
+	}
+	if len(f.Profiles) == 0 {
+		return f, errors.New("config file has no profiles")
+	}
+	if f.DefaultProfile == "" {
+		if len(f.Profiles) > 1 {
+			return f, errors.New("default_profile must be set when the config file has several profiles")
+		}
+		for name := range f.Profiles {
+			f.DefaultProfile = name
+		}
+	}
+	if _, ok := f.Profiles[f.DefaultProfile]; !ok {
+		return f, fmt.Errorf("default profile %q is not defined", f.DefaultProfile)
+	}
+	return f, nil
+}
+
+// loadProfiles loads the profiles file of the configuration, selects the
+// initial profile and logs the API groups that don't exist. Profiles without
+// a token source use fallback, which may be nil.
+func loadProfiles(ctx context.Context, cfg config, fallback tokenProvider, belt *tool.Belt, mcpServer *server.MCPServer, logger *zap.SugaredLogger) (*profileManager, error) {
+	file, err := loadProfilesFile(cfg.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Profile != "" {
+		if _, ok := file.Profiles[cfg.Profile]; !ok {
+			return nil, fmt.Errorf("profile %q is not defined in %s", cfg.Profile, cfg.ConfigFile)
+		}
+		file.DefaultProfile = cfg.Profile
+	}
+	for name, p := range file.Profiles {
+		if unknown := belt.UnknownGroups(p.EnabledAPIGroups); len(unknown) > 0 {
+			logger.Warnw("unknown API groups in profile", "profile", name, "groups", unknown)
+		}
+	}
+	m, err := newProfileManager(file, fallback, cfg.BitriseTokenRefreshInterval, mcpServer, logger)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.token(ctx, file.DefaultProfile); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// profileManager keeps track of the active profile of each session and
+// applies it to tool calls.
+type profileManager struct {
+	file      profilesFile
+	tokens    map[string]tokenProvider
+	mcpServer *server.MCPServer
+	// active maps session IDs to the name of their active profile.
+	active sync.Map
+}
+
+func newProfileManager(file profilesFile, fallback tokenProvider, refresh time.Duration, mcpServer *server.MCPServer, logger *zap.SugaredLogger) (*profileManager, error) {
+	m := &profileManager{file: file, tokens: map[string]tokenProvider{}, mcpServer: mcpServer}
+	for name, p := range file.Profiles {
+		tokens, err := tokenSource{
+			Token:   p.Token,
+			Env:     p.TokenEnv,
+			File:    p.TokenFile,
+			Command: p.TokenCommand,
+		}.provider(refresh, logger)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+		if tokens == nil {
+			tokens = fallback
+		}
+		m.tokens[name] = tokens
+	}
+	return m, nil
+}
+
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+func (m *profileManager) activeName(ctx context.Context) string {
+	if v, ok := m.active.Load(sessionID(ctx)); ok {
+		return v.(string) //nolint:forcetypeassert
+	}
+	return m.file.DefaultProfile
+}
+
+func (m *profileManager) token(ctx context.Context, name string) (string, error) {
+	tokens := m.tokens[name]
+	if tokens == nil {
+		return "", fmt.Errorf("profile %q has no token: set token, token_env, token_file or token_command", name)
+	}
+	pat, err := tokens.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("profile %q: %w", name, err)
+	}
+	return pat, nil
+}
+
+// enabledGroups returns the API groups of the session's active profile, or
+// nil when the profile doesn't restrict them.
+func (m *profileManager) enabledGroups(ctx context.Context) []string {
+	return m.file.Profiles[m.activeName(ctx)].EnabledAPIGroups
+}
+
+// middleware injects the PAT, API base URLs, API groups and default
+// workspace of the active profile into every tool call.
+func (m *profileManager) middleware(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, p, err := m.withActiveProfile(ctx)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if p.DefaultWorkspace != "" {
+			request = withDefaultWorkspace(request, m.mcpServer.GetTool(request.Params.Name), p.DefaultWorkspace)
+		}
+		return fn(ctx, request)
+	}
+}
+
+// resourceMiddleware injects the PAT, API base URLs and API groups of the
+// active profile into every resource read.
+func (m *profileManager) resourceMiddleware(fn server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		ctx, _, err := m.withActiveProfile(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return fn(ctx, request)
+	}
+}
+
+func (m *profileManager) withActiveProfile(ctx context.Context) (context.Context, profile, error) {
+	name := m.activeName(ctx)
+	p := m.file.Profiles[name]
+	pat, err := m.token(ctx, name)
+	if err != nil {
+		return ctx, p, err
+	}
+	ctx = bitrise.ContextWithPAT(ctx, pat)
+	ctx = bitrise.ContextWithBaseURLs(ctx, bitrise.BaseURLs{
+		API:      p.APIBaseURL,
+		RM:       p.RMAPIBaseURL,
+		CodePush: p.CodePushAPIBaseURL,
+	})
+	if len(p.EnabledAPIGroups) > 0 {
+		ctx = bitrise.ContextWithEnabledGroups(ctx, p.EnabledAPIGroups)
+	}
+	return ctx, p, nil
+}
+
+// withDefaultWorkspace sets the workspace argument of a tool that takes one
+// when the call doesn't set it.
+func withDefaultWorkspace(request mcp.CallToolRequest, tool *server.ServerTool, workspace string) mcp.CallToolRequest {
+	if tool == nil {
+		return request
+	}
+	args := request.GetArguments()
+	for _, key := range []string{"workspace_slug", "organization_slug"} {
+		if _, ok := tool.Tool.InputSchema.Properties[key]; !ok {
+			continue
+		}
+		if v, ok := args[key].(string); ok && v != "" {
+			continue
+		}
+		updated := maps.Clone(args)
+		if updated == nil {
+			updated = map[string]any{}
+		}
+		updated[key] = workspace
+		request.Params.Arguments = updated
+		args = updated
+	}
+	return request
+}
+
+func (m *profileManager) names() []string {
+	names := make([]string, 0, len(m.file.Profiles))
+	for name := range m.file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// switchProfileTool returns the switch_profile tool. It is only registered
+// when profiles are configured.
+func (m *profileManager) switchProfileTool() (mcp.Tool, server.ToolHandlerFunc) {
+	definition := mcp.NewTool("switch_profile",
+		mcp.WithDescription(fmt.Sprintf(
+			"Switch the Bitrise account profile used by the following tool calls of this session, or show the active profile when no profile is given. Available profiles: %s.",
+			strings.Join(m.names(), ", "),
+		)),
+		mcp.WithString("profile",
+			mcp.Description("Name of the profile to switch to"),
+			mcp.Enum(m.names()...),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+	)
+	return definition, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if name := request.GetString("profile", ""); name != "" {
+			if _, ok := m.file.Profiles[name]; !ok {
+				return mcp.NewToolResultErrorf("unknown profile %q, available profiles: %s", name, strings.Join(m.names(), ", ")), nil
+			}
+			if _, err := m.token(ctx, name); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			m.active.Store(sessionID(ctx), name)
+			// The profile may enable different API groups.
+			_ = m.mcpServer.SendNotificationToClient(ctx, mcp.MethodNotificationToolsListChanged, nil)
+		}
+		name := m.activeName(ctx)
+		return mcp.NewToolResultStructuredOnly(map[string]any{
+			"active_profile":    name,
+			"default_workspace": m.file.Profiles[name].DefaultWorkspace,
+			"profiles":          m.names(),
+		}), nil
+	}
+}
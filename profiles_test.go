@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestLoadProfilesFile(t *testing.T) {
+	cases := map[string]struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		"toml": {
+			name: "config.toml",
+			content: `default_profile = "client"
+
+[profiles.personal]
+token_env = "PERSONAL_TOKEN"
+
+[profiles.client]
+token = "client-pat"
+api_base_url = "https://bitrise.example.com/v0.1"
+enabled_api_groups = ["apps", "builds"]
+default_workspace = "ws"
+`,
+		},
+		"yaml": {
+			name: "config.yml",
+			content: `default_profile: client
+profiles:
+  personal:
+    token_env: PERSONAL_TOKEN
+  client:
+    token: client-pat
+    api_base_url: https://bitrise.example.com/v0.1
+    enabled_api_groups: [apps, builds]
+    default_workspace: ws
+`,
+		},
+		"missing default profile": {
+			name:    "config.yaml",
+			content: "profiles:\n  a: {token: x}\n  b: {token: y}\n",
+			wantErr: "default_profile must be set",
+		},
+		"unknown extension": {
+			name:    "config.json",
+			content: "{}",
+			wantErr: "unsupported config file extension",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.name)
+			assert.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+
+			f, err := loadProfilesFile(path)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "client", f.DefaultProfile)
+			assert.Equal(t, profile{
+				Token:            "client-pat",
+				APIBaseURL:       "https://bitrise.example.com/v0.1",
+				EnabledAPIGroups: []string{"apps", "builds"},
+				DefaultWorkspace: "ws",
+			}, f.Profiles["client"])
+			assert.Equal(t, profile{TokenEnv: "PERSONAL_TOKEN"}, f.Profiles["personal"])
+		})
+	}
+}
+
+func TestProfileManager(t *testing.T) {
+	var gotAuth, gotPath string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotPath = r.Header.Get("Authorization"), r.URL.Path
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer api.Close()
+	t.Setenv("PERSONAL_TOKEN", "personal-pat")
+
+	mcpServer := server.NewMCPServer("test", "1.0")
+	m, err := newProfileManager(profilesFile{
+		DefaultProfile: "personal",
+		Profiles: map[string]profile{
+			"personal": {TokenEnv: "PERSONAL_TOKEN"},
+			"client":   {Token: "client-pat", APIBaseURL: api.URL, EnabledAPIGroups: []string{"apps"}, DefaultWorkspace: "ws"},
+			"broken":   {TokenEnv: "MISSING_TOKEN"},
+		},
+	}, nil, 0, mcpServer, zap.NewNop().Sugar())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var gotGroups []string
+	var gotWorkspace string
+	mcpServer.AddTool(mcp.NewTool("list_connected_apps", mcp.WithString("workspace_slug")), m.middleware(
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			gotGroups, _ = bitrise.EnabledGroupsFromCtx(ctx)
+			gotWorkspace = request.GetString("workspace_slug", "")
+			_, err := bitrise.CallAPI(ctx, bitrise.CallAPIParams{Method: http.MethodGet, API: bitrise.APIMain, Path: "/me"})
+			if err != nil {
+				return bitrise.NewToolResultErrorFromErr("call api", err), nil
+			}
+			return mcp.NewToolResultText("ok"), nil
+		},
+	))
+	_, switchProfile := m.switchProfileTool()
+	callTool := func(handler server.ToolHandlerFunc, name string, args map[string]any) *mcp.CallToolResult {
+		var request mcp.CallToolRequest
+		request.Params.Name = name
+		request.Params.Arguments = args
+		res, err := handler(t.Context(), request)
+		assert.NoError(t, err)
+		return res
+	}
+	listConnectedApps := mcpServer.GetTool("list_connected_apps").Handler
+
+	assert.Equal(t, "personal", m.activeName(t.Context()))
+	assert.Nil(t, m.enabledGroups(t.Context()))
+
+	res := callTool(switchProfile, "switch_profile", map[string]any{"profile": "broken"})
+	assert.True(t, res.IsError)
+	res = callTool(switchProfile, "switch_profile", map[string]any{"profile": "nope"})
+	assert.True(t, res.IsError)
+
+	res = callTool(switchProfile, "switch_profile", map[string]any{"profile": "client"})
+	assert.False(t, res.IsError)
+	assert.Equal(t, "client", res.StructuredContent.(map[string]any)["active_profile"])
+	assert.Equal(t, []string{"apps"}, m.enabledGroups(t.Context()))
+
+	res = callTool(listConnectedApps, "list_connected_apps", nil)
+	assert.False(t, res.IsError)
+	assert.Equal(t, "client-pat", gotAuth)
+	assert.Equal(t, "/me", gotPath)
+	assert.Equal(t, []string{"apps"}, gotGroups)
+	assert.Equal(t, "ws", gotWorkspace)
+
+	callTool(listConnectedApps, "list_connected_apps", map[string]any{"workspace_slug": "other"})
+	assert.Equal(t, "other", gotWorkspace)
+}
+
+func TestSwitchProfileReadOnlyMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := "default_profile = \"personal\"\n\n[profiles.personal]\ntoken = \"personal-pat\"\n\n[profiles.client]\ntoken = \"client-pat\"\n"
+	if !assert.NoError(t, os.WriteFile(path, []byte(content), 0o600)) {
+		return
+	}
+
+	mcpServer := server.NewMCPServer("test", "1.0", server.WithToolFilter(safetyToolFilter(safetyModeReadOnly)))
+	tool.NewBelt().RegisterAll(mcpServer, false)
+	m, err := loadProfiles(t.Context(), config{ConfigFile: path}, nil, tool.NewBelt(), mcpServer, zap.NewNop().Sugar())
+	if !assert.NoError(t, err) {
+		return
+	}
+	mcpServer.AddTool(m.switchProfileTool())
+	server.WithToolHandlerMiddleware(safetyMiddleware(registeredTools{mcpServer: mcpServer}.ReadOnly, safetyModeReadOnly))(mcpServer)
+
+	list := mcpServer.HandleMessage(t.Context(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	listResponse, ok := list.(mcp.JSONRPCResponse)
+	if !assert.True(t, ok) {
+		return
+	}
+	var names []string
+	for _, tool := range listResponse.Result.(mcp.ListToolsResult).Tools {
+		names = append(names, tool.Name)
+	}
+	assert.Contains(t, names, "switch_profile")
+	assert.Contains(t, names, "list_apps")
+	assert.NotContains(t, names, "delete_app")
+
+	call := mcpServer.HandleMessage(t.Context(), []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"switch_profile","arguments":{"profile":"client"}}}`))
+	callResponse, ok := call.(mcp.JSONRPCResponse)
+	if !assert.True(t, ok) {
+		return
+	}
+	res := callResponse.Result.(mcp.CallToolResult)
+	assert.False(t, res.IsError)
+	assert.Equal(t, "client", m.activeName(t.Context()))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimitIdleTimeout is how long the state of a client without calls
+	// is kept.
+	rateLimitIdleTimeout = 10 * time.Minute
+	// concurrencyRetryAfter is the retry hint of calls rejected because too
+	// many calls of the client are in flight.
+	concurrencyRetryAfter = time.Second
+)
+
+// rateLimiter limits the tool calls of each client, identified by the
+// fingerprint of its PAT or, without one, its IP address. Each client gets a
+// token bucket refilled at rps up to burst calls, and at most maxInFlight
+// concurrent calls. Zero rps or maxInFlight disables that limit. Calls of
+// long-running tools are capped at maxInFlight separately, so waiting doesn't
+// lock the client out of other tools.
+type rateLimiter struct {
+	rps         rate.Limit
+	burst       int
+	maxInFlight int
+	longRunning func(name string) bool
+	now         func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*clientLimit
+	swept   time.Time
+}
+
+type clientLimit struct {
+	limiter *rate.Limiter
+	// inFlight and inFlightLongRunning count the calls in flight of regular
+	// and long-running tools.
+	inFlight            int
+	inFlightLongRunning int
+	lastSeen            time.Time
+}
+
+func newRateLimiter(rps float64, burst, maxInFlight int, longRunning func(name string) bool) *rateLimiter {
+	return &rateLimiter{
+		rps:         rate.Limit(rps),
+		burst:       max(burst, 1),
+		maxInFlight: maxInFlight,
+		longRunning: longRunning,
+		now:         time.Now,
+		clients:     map[string]*clientLimit{},
+	}
+}
+
+// clientKey identifies the client of a tool call.
+func clientKey(ctx context.Context) string {
+	if fingerprint := bitrise.PATFingerprint(ctx); fingerprint != "" {
+		return "pat:" + fingerprint
+	}
+	return "ip:" + bitrise.ClientIPFromCtx(ctx)
+}
+
+// acquire reserves a call for the client. It returns a release function, or
+// how long to wait before retrying when the client is over its limits.
+// Long-running calls are counted separately from the others.
+func (l *rateLimiter) acquire(key string, longRunning bool) (func(), time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &clientLimit{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+	inFlight := &c.inFlight
+	if longRunning {
+		inFlight = &c.inFlightLongRunning
+	}
+	if l.maxInFlight > 0 && *inFlight >= l.maxInFlight {
+		return nil, concurrencyRetryAfter
+	}
+	if l.rps > 0 {
+		reservation := c.limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			return nil, delay
+		}
+	}
+	*inFlight++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		*inFlight--
+		c.lastSeen = l.now()
+	}, 0
+}
+
+// sweep forgets idle clients, at most once a minute. Must be called with
+// l.mu held.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	for key, c := range l.clients {
+		if c.inFlight == 0 && c.inFlightLongRunning == 0 && now.Sub(c.lastSeen) >= rateLimitIdleTimeout {
+			delete(l.clients, key)
+		}
+	}
+	l.swept = now
+}
+
+// middleware rejects the calls of clients over their limits with an error
+// result telling when to retry, also set as retry_after_seconds in _meta.
+func (l *rateLimiter) middleware(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		release, retryAfter := l.acquire(clientKey(ctx), l.longRunning(request.Params.Name))
+		if release == nil {
+			return rateLimitedResult(retryAfter), nil
+		}
+		defer release()
+		return fn(ctx, request)
+	}
+}
+
+func rateLimitedResult(retryAfter time.Duration) *mcp.CallToolResult {
+	seconds := math.Ceil(retryAfter.Seconds()*10) / 10
+	result := mcp.NewToolResultError(fmt.Sprintf(
+		"rate limit exceeded: too many tool calls from this client, retry after %.1f seconds", seconds))
+	result.Meta = &mcp.Meta{AdditionalFields: map[string]any{"retry_after_seconds": seconds}}
+	return result
+}
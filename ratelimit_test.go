@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterAcquire(t *testing.T) {
+	cases := map[string]struct {
+		rps            float64
+		burst          int
+		maxInFlight    int
+		calls          int
+		keepInFlight   bool
+		longRunning    bool
+		wantAllowed    int
+		wantRetryAfter time.Duration
+	}{
+		"within burst":       {rps: 1, burst: 3, calls: 3, wantAllowed: 3},
+		"over burst":         {rps: 2, burst: 3, calls: 5, wantAllowed: 3, wantRetryAfter: 500 * time.Millisecond},
+		"concurrency cap":    {maxInFlight: 2, calls: 4, keepInFlight: true, wantAllowed: 2, wantRetryAfter: concurrencyRetryAfter},
+		"released calls":     {maxInFlight: 2, calls: 4, wantAllowed: 4},
+		"rate and cap unset": {calls: 100, keepInFlight: true, wantAllowed: 100},
+		"long-running calls": {maxInFlight: 2, calls: 3, keepInFlight: true, longRunning: true, wantAllowed: 2, wantRetryAfter: concurrencyRetryAfter},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			l := newRateLimiter(tc.rps, tc.burst, tc.maxInFlight, nil)
+			l.now = func() time.Time { return now }
+
+			allowed, retryAfter := 0, time.Duration(0)
+			for range tc.calls {
+				release, wait := l.acquire("client", tc.longRunning)
+				if release == nil {
+					retryAfter = wait
+					continue
+				}
+				allowed++
+				if !tc.keepInFlight {
+					release()
+				}
+			}
+			assert.Equal(t, tc.wantAllowed, allowed)
+			assert.Equal(t, tc.wantRetryAfter, retryAfter)
+		})
+	}
+}
+
+func TestRateLimiterLongRunning(t *testing.T) {
+	l := newRateLimiter(0, 0, 1, nil)
+
+	releaseWait, _ := l.acquire("client", true)
+	if !assert.NotNil(t, releaseWait) {
+		return
+	}
+	release, _ := l.acquire("client", false)
+	if !assert.NotNil(t, release, "waiting doesn't lock the client out of other tools") {
+		return
+	}
+	_, retryAfter := l.acquire("client", true)
+	assert.Equal(t, concurrencyRetryAfter, retryAfter, "long-running calls have their own cap")
+	_, retryAfter = l.acquire("client", false)
+	assert.Equal(t, concurrencyRetryAfter, retryAfter)
+
+	releaseWait()
+	releaseWait, _ = l.acquire("client", true)
+	assert.NotNil(t, releaseWait)
+}
+
+func TestRateLimiterClients(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(1, 1, 0, nil)
+	l.now = func() time.Time { return now }
+
+	releaseA, _ := l.acquire("a", false)
+	assert.NotNil(t, releaseA)
+	release, _ := l.acquire("a", false)
+	assert.Nil(t, release)
+	releaseB, _ := l.acquire("b", false)
+	if !assert.NotNil(t, releaseB, "clients have their own buckets") {
+		return
+	}
+	releaseA()
+
+	now = now.Add(rateLimitIdleTimeout)
+	l.acquire("c", false)
+	assert.Len(t, l.clients, 2, "clients with calls in flight are kept")
+
+	releaseB()
+	now = now.Add(rateLimitIdleTimeout)
+	l.acquire("c", false)
+	assert.Len(t, l.clients, 1, "idle clients are forgotten")
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	l := newRateLimiter(0.5, 1, 0, func(string) bool { return false })
+	handler := l.middleware(func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	pat := bitrise.ContextWithPAT(t.Context(), "pat")
+	ip := bitrise.ContextWithClientIP(t.Context(), "192.0.2.1")
+
+	res, err := handler(pat, mcp.CallToolRequest{})
+	assert.NoError(t, err)
+	assert.False(t, res.IsError)
+
+	res, err = handler(pat, mcp.CallToolRequest{})
+	assert.NoError(t, err)
+	if !assert.True(t, res.IsError) {
+		return
+	}
+	assert.Contains(t, res.Content[0].(mcp.TextContent).Text, "retry after 2.0 seconds") //nolint:forcetypeassert
+	assert.InDelta(t, 2.0, res.Meta.AdditionalFields["retry_after_seconds"], 0.1)
+
+	res, _ = handler(ip, mcp.CallToolRequest{})
+	assert.False(t, res.IsError, "clients without a PAT are keyed by IP address")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Safety modes, from least to most restrictive.
+const (
+	// safetyModeFull runs every tool as requested.
+	safetyModeFull = "full"
+	// safetyModeDryRun runs read-only tools, while mutating tools return the
+	// request they would send instead of calling Bitrise.
+	safetyModeDryRun = "dry-run"
+	// safetyModeReadOnly hides and rejects every tool that is not read-only.
+	safetyModeReadOnly = "read-only"
+)
+
+var safetyModeRank = map[string]int{ //nolint:gochecknoglobals
+	safetyModeFull:     0,
+	safetyModeDryRun:   1,
+	safetyModeReadOnly: 2,
+}
+
+func validateSafetyMode(mode string) error {
+	if _, ok := safetyModeRank[mode]; !ok {
+		return fmt.Errorf("invalid safety mode %q: must be one of %s, %s, %s", mode, safetyModeFull, safetyModeDryRun, safetyModeReadOnly)
+	}
+	return nil
+}
+
+// effectiveSafetyMode returns the safety mode for a request. A mode requested
+// through the HTTP header can only make the configured mode stricter.
+func effectiveSafetyMode(ctx context.Context, configured string) string {
+	requested, err := bitrise.SafetyModeFromCtx(ctx) // http transport only
+	if err != nil {
+		return configured
+	}
+	if rank, ok := safetyModeRank[requested]; ok && rank > safetyModeRank[configured] {
+		return requested
+	}
+	return configured
+}
+
+// registeredTools reads the annotations of the tools registered on the
+// server, which include the tools outside the belt such as switch_profile.
+type registeredTools struct {
+	mcpServer *server.MCPServer
+}
+
+// ReadOnly reports whether the tool is annotated as not modifying its
+// environment. Unknown tools and tools without the annotation are not
+// read-only.
+func (t registeredTools) ReadOnly(name string) bool {
+	tool := t.mcpServer.GetTool(name)
+	return tool != nil && readOnlyTool(tool.Tool)
+}
+
+// Destructive reports whether the tool is annotated as potentially
+// destructive.
+func (t registeredTools) Destructive(name string) bool {
+	tool := t.mcpServer.GetTool(name)
+	if tool == nil {
+		return false
+	}
+	hint := tool.Tool.Annotations.DestructiveHint
+	return hint != nil && *hint
+}
+
+// Definition returns the definition of the registered tool.
+func (t registeredTools) Definition(name string) (mcp.Tool, bool) {
+	tool := t.mcpServer.GetTool(name)
+	if tool == nil {
+		return mcp.Tool{}, false
+	}
+	return tool.Tool, true
+}
+
+func readOnlyTool(tool mcp.Tool) bool {
+	hint := tool.Annotations.ReadOnlyHint
+	return hint != nil && *hint
+}
+
+// safetyToolFilter hides the tools that are not read-only in read-only mode.
+func safetyToolFilter(configured string) server.ToolFilterFunc {
+	return func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+		if effectiveSafetyMode(ctx, configured) != safetyModeReadOnly {
+			return tools
+		}
+		var filtered []mcp.Tool
+		for _, tool := range tools {
+			if readOnlyTool(tool) {
+				filtered = append(filtered, tool)
+			}
+		}
+		return filtered
+	}
+}
+
+// safetyMiddleware enforces the safety mode based on the tools' read-only
+// annotations.
+func safetyMiddleware(readOnly func(name string) bool, configured string) server.ToolHandlerMiddleware {
+	return func(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if readOnly(request.Params.Name) {
+				return fn(ctx, request)
+			}
+			switch effectiveSafetyMode(ctx, configured) {
+			case safetyModeReadOnly:
+				return mcp.NewToolResultErrorf("tool %q modifies data and is disabled because the server is in read-only mode", request.Params.Name), nil
+			case safetyModeDryRun:
+				return fn(bitrise.ContextWithDryRun(ctx), request)
+			}
+			return fn(ctx, request)
+		}
+	}
+}
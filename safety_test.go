@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveSafetyMode(t *testing.T) {
+	cases := map[string]struct {
+		configured string
+		header     string
+		want       string
+	}{
+		"no header uses configured mode":   {configured: safetyModeDryRun, want: safetyModeDryRun},
+		"header can tighten":               {configured: safetyModeFull, header: safetyModeReadOnly, want: safetyModeReadOnly},
+		"header cannot loosen":             {configured: safetyModeReadOnly, header: safetyModeFull, want: safetyModeReadOnly},
+		"unknown header value is ignored":  {configured: safetyModeDryRun, header: "yolo", want: safetyModeDryRun},
+		"header dry-run over full applies": {configured: safetyModeFull, header: safetyModeDryRun, want: safetyModeDryRun},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			if tc.header != "" {
+				ctx = bitrise.ContextWithSafetyMode(ctx, tc.header)
+			}
+			assert.Equal(t, tc.want, effectiveSafetyMode(ctx, tc.configured))
+		})
+	}
+}
+
+func TestSafetyMiddleware(t *testing.T) {
+	readOnly := func(name string) bool { return name == "list_apps" }
+	var called bool
+	next := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = true
+		return mcp.NewToolResultText("ok"), nil
+	}
+	call := func(mode, tool string) *mcp.CallToolResult {
+		called = false
+		var request mcp.CallToolRequest
+		request.Params.Name = tool
+		res, err := safetyMiddleware(readOnly, mode)(next)(t.Context(), request)
+		assert.NoError(t, err)
+		return res
+	}
+
+	t.Run("read-only mode rejects mutating tools", func(t *testing.T) {
+		res := call(safetyModeReadOnly, "delete_app")
+		assert.True(t, res.IsError)
+		assert.False(t, called)
+	})
+
+	t.Run("read-only mode allows read-only tools", func(t *testing.T) {
+		res := call(safetyModeReadOnly, "list_apps")
+		assert.False(t, res.IsError)
+		assert.True(t, called)
+	})
+
+	t.Run("full mode allows mutating tools", func(t *testing.T) {
+		res := call(safetyModeFull, "delete_app")
+		assert.False(t, res.IsError)
+		assert.True(t, called)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/resource"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/subscription"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// subscriptions handles resources/subscribe and resources/unsubscribe, which
+// the interceptor answers in front of the stateful transports. Subscribed
+// resources are polled by reading them through the MCP server, so the same
+// resource middlewares apply as to the client's own reads.
+type subscriptions struct {
+	mcpServer *server.MCPServer
+	scheduler *subscription.Scheduler
+}
+
+func newSubscriptions(mcpServer *server.MCPServer, hooks *server.Hooks, minInterval, maxInterval time.Duration) *subscriptions {
+	s := &subscriptions{mcpServer: mcpServer}
+	s.scheduler = subscription.NewScheduler(s.poll, s.notify, minInterval, maxInterval)
+	hooks.AddOnUnregisterSession(func(_ context.Context, session server.ClientSession) {
+		s.scheduler.EndSession(session.SessionID())
+	})
+	return s
+}
+
+// Close stops polling.
+func (s *subscriptions) Close() {
+	s.scheduler.Close()
+}
+
+// handle subscribes the session to a resource or unsubscribes it.
+func (s *subscriptions) handle(ctx context.Context, sessionID string, request interceptedRequest) mcp.JSONRPCMessage {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(request.Params, &params); err != nil || params.URI == "" {
+		return mcp.NewJSONRPCError(request.ID, mcp.INVALID_PARAMS, "missing uri", nil)
+	}
+	uri := params.URI
+	if request.Method == methodResourcesUnsubscribe {
+		s.scheduler.Unsubscribe(sessionID, uri)
+		return mcp.NewJSONRPCResultResponse(request.ID, mcp.EmptyResult{})
+	}
+	if err := s.scheduler.Subscribe(ctx, sessionID, uri); err != nil {
+		return mcp.NewJSONRPCError(request.ID, mcp.INVALID_PARAMS, err.Error(), nil)
+	}
+	return mcp.NewJSONRPCResultResponse(request.ID, mcp.EmptyResult{})
+}
+
+// poll reads a resource through the MCP server and returns its status.
+func (s *subscriptions) poll(ctx context.Context, uri string) (string, bool, error) {
+	template, ok := resource.Match(uri)
+	if !ok || template.Status == nil {
+		return "", false, fmt.Errorf("resource %s can't be subscribed to", uri)
+	}
+	message, err := json.Marshal(map[string]any{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"id":      0,
+		"method":  string(mcp.MethodResourcesRead),
+		"params":  map[string]any{"uri": uri},
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("marshal read request: %w", err)
+	}
+	switch res := s.mcpServer.HandleMessage(ctx, message).(type) {
+	case mcp.JSONRPCResponse:
+		if result, ok := res.Result.(mcp.ReadResourceResult); ok && len(result.Contents) > 0 {
+			if contents, ok := result.Contents[0].(mcp.TextResourceContents); ok {
+				return template.Status(contents.Text)
+			}
+		}
+	case mcp.JSONRPCError:
+		return "", false, errors.New(res.Error.Message)
+	}
+	return "", false, fmt.Errorf("unexpected response reading %s", uri)
+}
+
+func (s *subscriptions) notify(sessionID, uri string) error {
+	return s.mcpServer.SendNotificationToSpecificClient(sessionID, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+}
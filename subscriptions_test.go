@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/resource"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionsStdio(t *testing.T) {
+	var finished atomic.Bool
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apps/app1/builds/build1" {
+			http.NotFound(w, r)
+			return
+		}
+		if finished.Load() {
+			fmt.Fprint(w, `{"data":{"status":1,"status_text":"success"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"status":0,"status_text":"in-progress"}}`)
+	}))
+	t.Cleanup(api.Close)
+
+	hooks := &server.Hooks{}
+	mcpServer := server.NewMCPServer("test", "1", server.WithResourceCapabilities(true, false), server.WithHooks(hooks))
+	resource.RegisterAll(mcpServer)
+	subs := newSubscriptions(mcpServer, hooks, 10*time.Millisecond, 10*time.Millisecond)
+	t.Cleanup(subs.Close)
+
+	ctx := bitrise.ContextWithPAT(t.Context(), "pat")
+	ctx = bitrise.ContextWithBaseURLs(ctx, bitrise.BaseURLs{API: api.URL})
+	stdinReader, stdin := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	out := &stdioOutput{w: stdoutWriter}
+	go func() {
+		_ = server.NewStdioServer(mcpServer).Listen(ctx, (&interceptor{subs: subs}).stdioInput(ctx, stdinReader, out), out)
+	}()
+	t.Cleanup(func() { _ = stdin.Close() })
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stdoutReader)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	send := func(message string) {
+		_, err := fmt.Fprintln(stdin, message)
+		assert.NoError(t, err)
+	}
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message")
+			return ""
+		}
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	initialized := next()
+	assert.Contains(t, initialized, `"subscribe":true`)
+	assert.Contains(t, initialized, `"completions":{}`)
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	send(`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"bitrise://apps/app1/builds/build1/log"}}`)
+	assert.Contains(t, next(), `"error"`, "only builds and pipelines can be subscribed to")
+	send(`{"jsonrpc":"2.0","id":3,"method":"resources/subscribe","params":{"uri":"bitrise://apps/unknown/builds/build1"}}`)
+	assert.Contains(t, next(), `"error"`, "the resource must be readable")
+
+	send(`{"jsonrpc":"2.0","id":4,"method":"resources/subscribe","params":{"uri":"bitrise://apps/app1/builds/build1"}}`)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":4,"result":{}}`, next())
+	finished.Store(true)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"bitrise://apps/app1/builds/build1"}}`, next())
+
+	send(`{"jsonrpc":"2.0","id":5,"method":"ping"}`)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":5,"result":{}}`, next(), "other messages reach the stdio server")
+}
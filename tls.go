@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tlsReloadCheckInterval limits how often the certificate files are checked
+// for changes.
+const tlsReloadCheckInterval = 10 * time.Second
+
+// newTLSConfig creates the TLS configuration of the HTTP transport. The
+// certificate is reloaded when its files change, e.g. when cert-manager or
+// certbot renews it. With clientCAFile, clients are verified against the CA
+// bundle, clientAuth tells whether a client certificate is "require"d or
+// "optional".
+func newTLSConfig(certFile, keyFile, clientCAFile, clientAuth string, logger *zap.SugaredLogger) (*tls.Config, error) {
+	reloader, err := newCertReloader(certFile, keyFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle %s", clientCAFile)
+	}
+	config.ClientCAs = pool
+	switch clientAuth {
+	case "require":
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("invalid TLS_CLIENT_AUTH %q: use require or optional", clientAuth)
+	}
+	return config, nil
+}
+
+// certReloader serves a certificate and reloads it when the modification
+// time of its files changes. A certificate failing to load is logged and the
+// previous one is kept.
+type certReloader struct {
+	certFile, keyFile string
+	logger            *zap.SugaredLogger
+	now               func() time.Time
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger *zap.SugaredLogger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger, now: time.Now}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := r.now(); now.Sub(r.checkedAt) >= tlsReloadCheckInterval {
+		r.checkedAt = now
+		modTime, err := r.latestModTime()
+		switch {
+		case err != nil:
+			r.logger.Warnw("check TLS certificate", "error", err)
+		case !modTime.Equal(r.modTime):
+			if err := r.load(modTime); err != nil {
+				r.logger.Warnw("reload TLS certificate, keeping the previous one", "error", err)
+			} else {
+				r.logger.Infow("reloaded TLS certificate", "cert_file", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// load must be called with r.mu held, or before r is shared.
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	r.cert, r.modTime = &cert, modTime
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("stat TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
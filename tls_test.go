@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// testCert is a certificate signed by parent, or self-signed without one.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, commonName string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Bitrise"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:     []string{"localhost"},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) writeFiles(t *testing.T, dir, name string) (string, string) {
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDER, _ := x509.MarshalECPrivateKey(c.key)
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCert(t, "first", nil)
+	certFile, keyFile := first.writeFiles(t, dir, "server")
+
+	r, err := newCertReloader(certFile, keyFile, zap.NewNop().Sugar())
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	cert, _ := r.GetCertificate(nil)
+	assert.Equal(t, first.der, cert.Certificate[0])
+
+	second := newTestCert(t, "second", nil)
+	second.writeFiles(t, dir, "server")
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, future, future))
+
+	cert, _ = r.GetCertificate(nil)
+	assert.Equal(t, first.der, cert.Certificate[0], "files are checked at most every tlsReloadCheckInterval")
+
+	now = now.Add(tlsReloadCheckInterval)
+	cert, _ = r.GetCertificate(nil)
+	assert.Equal(t, second.der, cert.Certificate[0])
+
+	// A broken certificate keeps the previous one.
+	assert.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0o600))
+	later := future.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, later, later))
+	now = now.Add(tlsReloadCheckInterval)
+	cert, _ = r.GetCertificate(nil)
+	assert.Equal(t, second.der, cert.Certificate[0])
+}
+
+func TestNewTLSConfigMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Test CA", nil)
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	serverCert := newTestCert(t, "server", ca)
+	certFile, keyFile := serverCert.writeFiles(t, dir, "server")
+	clientCert := newTestCert(t, "ci-runner", ca)
+	untrusted := newTestCert(t, "intruder", newTestCert(t, "Other CA", nil))
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+
+	cases := map[string]struct {
+		clientAuth  string
+		clientCert  *testCert
+		wantErr     bool
+		wantSubject string
+	}{
+		"required and given": {clientAuth: "require", clientCert: clientCert, wantSubject: "CN=ci-runner,O=Bitrise"},
+		"required, missing":  {clientAuth: "require", wantErr: true},
+		"untrusted":          {clientAuth: "optional", clientCert: untrusted, wantErr: true},
+		"optional, missing":  {clientAuth: "optional"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			config, err := newTLSConfig(certFile, keyFile, caFile, tc.clientAuth, zap.NewNop().Sugar())
+			if !assert.NoError(t, err) {
+				return
+			}
+			var gotSubject string
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(r.TLS.PeerCertificates) > 0 {
+					gotSubject = r.TLS.PeerCertificates[0].Subject.String()
+				}
+			}))
+			srv.TLS = config
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0) // failed handshakes are expected
+			srv.StartTLS()
+			defer srv.Close()
+
+			// With SNI, the server uses GetCertificate over the test certificate
+			// httptest installs.
+			clientTLS := &tls.Config{RootCAs: rootCAs, ServerName: "localhost", MinVersion: tls.VersionTLS12}
+			if tc.clientCert != nil {
+				// Sent even when it doesn't match the server's CAs.
+				cert := tc.clientCert.tlsCertificate()
+				clientTLS.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &cert, nil }
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			res, err := client.Get(srv.URL)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			res.Body.Close()
+			assert.Equal(t, tc.wantSubject, gotSubject)
+		})
+	}
+
+	_, err := newTLSConfig(certFile, keyFile, caFile, "sometimes", zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/resource"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+// toolAccess decides which tools are enabled for a request. A tool must
+// belong to an enabled API group and be allowed by the configured tool
+// selection. In HTTP transport the x-bitrise-enabled-tools and
+// x-bitrise-disabled-tools headers can only narrow the selection further.
+type toolAccess struct {
+	belt      *tool.Belt
+	groups    []string
+	selection tool.Selection
+	// profileGroups returns the API groups of the active profile, if any.
+	profileGroups func(ctx context.Context) []string
+}
+
+// newToolAccess parses the configured groups and tool patterns, and logs the
+// ones that don't match any tool.
+func newToolAccess(belt *tool.Belt, groups, enabledTools, disabledTools string, logger *zap.SugaredLogger) (*toolAccess, error) {
+	selection, err := tool.ParseSelection(enabledTools, disabledTools)
+	if err != nil {
+		return nil, err
+	}
+	a := &toolAccess{belt: belt, groups: strings.Split(groups, ","), selection: selection}
+	if unknown := belt.UnknownGroups(tool.SplitList(groups)); len(unknown) > 0 {
+		logger.Warnw("unknown API groups in ENABLED_API_GROUPS", "groups", unknown)
+	}
+	if unknown := belt.UnknownPatterns(selection); len(unknown) > 0 {
+		logger.Warnw("tool patterns in ENABLED_TOOLS/DISABLED_TOOLS don't match any tool", "patterns", unknown)
+	}
+	return a, nil
+}
+
+func (a *toolAccess) enabled(ctx context.Context, name string) bool {
+	groups, err := bitrise.EnabledGroupsFromCtx(ctx) // http transport only
+	if err != nil {
+		// stdio transport/no tool filtering in http transport
+		groups = a.groups
+		if a.profileGroups != nil {
+			if profileGroups := a.profileGroups(ctx); len(profileGroups) > 0 {
+				groups = profileGroups
+			}
+		}
+	}
+	// Tools outside the belt (e.g. switch_profile) don't belong to API groups.
+	if _, ok := a.belt.Definition(name); ok && !a.belt.ToolEnabled(name, groups) {
+		return false
+	}
+	if !a.selection.Allows(name) {
+		return false
+	}
+	enabled, _ := bitrise.EnabledToolsFromCtx(ctx)   // http transport only
+	disabled, _ := bitrise.DisabledToolsFromCtx(ctx) // http transport only
+	if len(enabled) == 0 && len(disabled) == 0 {
+		return true
+	}
+	requested, err := tool.NewSelection(enabled, disabled)
+	if err != nil {
+		// Don't expose tools the client may have meant to disable.
+		return false
+	}
+	return requested.Allows(name)
+}
+
+// filter hides the tools that aren't enabled from tools/list.
+func (a *toolAccess) filter(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	var filtered []mcp.Tool
+	for _, tool := range tools {
+		if a.enabled(ctx, tool.Name) {
+			filtered = append(filtered, tool)
+		}
+	}
+	return filtered
+}
+
+// middleware rejects calls of tools that aren't enabled, as hiding them from
+// tools/list doesn't prevent clients from calling them.
+func (a *toolAccess) middleware(fn server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !a.enabled(ctx, request.Params.Name) {
+			return mcp.NewToolResultError(fmt.Sprintf("tool %q is not enabled on this server", request.Params.Name)), nil
+		}
+		return fn(ctx, request)
+	}
+}
+
+// resourceMiddleware rejects reads of resources whose tool isn't enabled, so
+// resources don't bypass the tool selection.
+func (a *toolAccess) resourceMiddleware(fn server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		if t, ok := resource.Match(request.Params.URI); ok && !a.enabled(ctx, t.Tool) {
+			return nil, fmt.Errorf("resource %q is not enabled on this server: it requires the %s tool", request.Params.URI, t.Tool)
+		}
+		return fn(ctx, request)
+	}
+}
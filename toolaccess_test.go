@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/bitrise"
+	"github.com/bitrise-io/bitrise-mcp/v2/internal/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestToolAccess(t *testing.T) {
+	a, err := newToolAccess(tool.NewBelt(), "apps,builds", "", "delete_*", zap.NewNop().Sugar())
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		ctx     func(ctx context.Context) context.Context
+		enabled []string
+		hidden  []string
+	}{
+		"configuration": {
+			enabled: []string{"list_apps", "trigger_bitrise_build"},
+			hidden:  []string{"delete_app", "list_pipelines"},
+		},
+		"group header replaces configured groups": {
+			ctx: func(ctx context.Context) context.Context {
+				return bitrise.ContextWithEnabledGroups(ctx, []string{"pipelines"})
+			},
+			enabled: []string{"list_pipelines"},
+			hidden:  []string{"list_apps"},
+		},
+		"tool headers narrow the configuration": {
+			ctx: func(ctx context.Context) context.Context {
+				ctx = bitrise.ContextWithEnabledTools(ctx, []string{"*_app", "list_*"})
+				return bitrise.ContextWithDisabledTools(ctx, []string{"list_builds"})
+			},
+			enabled: []string{"get_app", "list_apps"},
+			hidden:  []string{"delete_app", "list_builds", "trigger_bitrise_build"},
+		},
+		"invalid header pattern hides everything": {
+			ctx: func(ctx context.Context) context.Context {
+				return bitrise.ContextWithDisabledTools(ctx, []string{"delete_["})
+			},
+			hidden: []string{"list_apps"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			if tc.ctx != nil {
+				ctx = tc.ctx(ctx)
+			}
+			for _, name := range tc.enabled {
+				assert.True(t, a.enabled(ctx, name), name)
+			}
+			for _, name := range tc.hidden {
+				assert.False(t, a.enabled(ctx, name), name)
+			}
+		})
+	}
+
+	t.Run("middleware rejects disabled tools", func(t *testing.T) {
+		var called bool
+		handler := a.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			called = true
+			return mcp.NewToolResultText("ok"), nil
+		})
+		var request mcp.CallToolRequest
+		request.Params.Name = "delete_app"
+		res, err := handler(t.Context(), request)
+		assert.NoError(t, err)
+		assert.True(t, res.IsError)
+		assert.False(t, called)
+	})
+
+	_, err = newToolAccess(tool.NewBelt(), "apps", "[", "", zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
+
+func TestToolAccessResources(t *testing.T) {
+	a, err := newToolAccess(tool.NewBelt(), "apps,builds", "", "get_build_log", zap.NewNop().Sugar())
+	if !assert.NoError(t, err) {
+		return
+	}
+	read := a.resourceMiddleware(func(context.Context, mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return nil, nil
+	})
+	cases := map[string]struct {
+		ctx     func(ctx context.Context) context.Context
+		uri     string
+		wantErr bool
+	}{
+		"enabled tool":  {uri: "bitrise://apps/app1/bitrise.yml"},
+		"disabled tool": {uri: "bitrise://apps/app1/builds/build1/log", wantErr: true},
+		"group header": {
+			ctx: func(ctx context.Context) context.Context {
+				return bitrise.ContextWithEnabledGroups(ctx, []string{"pipelines"})
+			},
+			uri:     "bitrise://apps/app1/bitrise.yml",
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			if tc.ctx != nil {
+				ctx = tc.ctx(ctx)
+			}
+			var request mcp.ReadResourceRequest
+			request.Params.URI = tc.uri
+			_, err := read(ctx, request)
+			if tc.wantErr {
+				assert.ErrorContains(t, err, "is not enabled")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}